@@ -2,7 +2,9 @@ package main
 
 import (
 	"auth/internal/app"
+	"auth/pkg/jwt"
 	"auth/pkg/logging"
+	"auth/pkg/mailer"
 	"auth/pkg/pgs"
 	"auth/pkg/rds"
 	"crypto/tls"
@@ -17,6 +19,9 @@ type (
 		PgsAuth pgs.PostgresConfig `json:"pgs-1/auth"`
 		Rds0    rds.RedisConfig    `json:"rds-1/0"`
 		Rds1    rds.RedisConfig    `json:"rds-1/1"`
+		Mailer  mailer.Config      `json:"mailer"`
+		Jwt     jwt.KeyRingConfig  `json:"jwt"`
+		App     app.Config         `json:"app"`
 	}
 )
 
@@ -56,6 +61,21 @@ func main() {
 	}
 	defer rds1.Close()
 
+	m, err := mailer.NewMailer(config.Mailer)
+	if err != nil {
+		log.Fatalf("MAILER ERROR: %v", err)
+	}
+
+	jwtKeys, err := jwt.NewKeyRing(config.Jwt)
+	if err != nil {
+		log.Fatalf("JWT KEYS ERROR: %v", err)
+	}
+
+	jwtKeysSource := func() (jwt.KeyRingConfig, error) {
+		config, err := ReadConfig("./config.json")
+		return config.Jwt, err
+	}
+
 	logsPath := os.Getenv("LOGS_PATH")
 	if logsPath == "" {
 		logsPath = "./logs"
@@ -85,7 +105,7 @@ func main() {
 		log.Fatalf("LISTENER ERROR: %v", err)
 	}
 
-	srv, err := app.NewApp("API-GO-AUTH", l, pgsAuth, rds0, rds1, lis)
+	srv, err := app.NewApp("API-GO-AUTH", config.App, l, pgsAuth, rds0, rds1, m, jwtKeys, jwtKeysSource, lis)
 	if err != nil {
 		log.Fatalf("APP ERROR: %v", err)
 	}
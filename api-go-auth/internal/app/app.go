@@ -2,20 +2,27 @@ package app
 
 import (
 	"auth/internal/models"
+	"auth/pkg/jwt"
 	"auth/pkg/logging"
+	"auth/pkg/mailer"
+	"auth/pkg/oidc"
 	"auth/pkg/pgs"
+	"auth/pkg/ratelimit"
 	"auth/pkg/rds"
-	"auth/pkg/utils"
+	"auth/pkg/webauthn"
 	"context"
 	"errors"
+	"fmt"
 	"github.com/fasthttp/router"
 	"github.com/valyala/fasthttp"
 	"log"
 	"net"
+	"net/url"
 	"os"
 	"os/signal"
+	"strings"
+	"sync"
 	"syscall"
-	"time"
 )
 
 const (
@@ -23,31 +30,147 @@ const (
 )
 
 type (
+	Config struct {
+		RefreshTokenKey      string                `json:"refreshTokenKey"`
+		OAuthClientSecretKey string                `json:"oauthClientSecretKey"`
+		OAuthNativeSchemes   []string              `json:"oauthNativeSchemes"`
+		TotpKey              string                `json:"totpKey"`
+		TotpIssuer           string                `json:"totpIssuer"`
+		Webauthn             webauthn.Config       `json:"webauthn"`
+		AccessToken          jwt.Validator         `json:"accessToken"`
+		IdentityProviders    []oidc.ProviderConfig `json:"identityProviders"`
+		RealIpHeader         string                `json:"realIpHeader"`
+		TrustedProxies       []string              `json:"trustedProxies"`
+		RateLimits           RateLimitsConfig      `json:"rateLimits"`
+	}
+
+	// RateLimitsConfig describes limits of unauthenticated endpoints. Ip limit is applied per route,
+	// Email and Login limits are applied per identifier from request body
+	RateLimitsConfig struct {
+		Ip      ratelimit.Limit         `json:"ip"`
+		Email   ratelimit.Limit         `json:"email"`
+		Login   ratelimit.Limit         `json:"login"`
+		Lockout ratelimit.LockoutConfig `json:"lockout"`
+	}
+
+	// JwtKeysSource provides actual key ring configuration on reload
+	JwtKeysSource func() (jwt.KeyRingConfig, error)
+
 	Application struct {
-		logger     *logging.Logger
-		pgsPool    *pgs.Postgres
-		rdsClient0 *rds.Redis
-		rdsClient1 *rds.Redis
-		server     *fasthttp.Server
-		lis        net.Listener
-		rnd        *utils.Random
+		config            Config
+		logger            *logging.Logger
+		pgsPool           *pgs.Postgres
+		rdsClient0        *rds.Redis
+		rdsClient1        *rds.Redis
+		mailer            mailer.Mailer
+		jwtKeys           *jwt.KeyRing
+		jwtKeysSource     JwtKeysSource
+		identityProviders map[string]*oidc.Provider
+		trustedProxies    []net.IP
+		checkEmailLimiter *ratelimit.Limiter
+		registerLimiter   *ratelimit.Limiter
+		loginLimiter      *ratelimit.Limiter
+		loginLockout      *ratelimit.Lockout
+		server            *fasthttp.Server
+		lis               net.Listener
+		mails             sync.WaitGroup
 	}
 )
 
-func NewApp(serverName string, logger *logging.Logger, pgsPool *pgs.Postgres, rdsClient0, rdsClient1 *rds.Redis, lis net.Listener) (*Application, error) {
-	if logger == nil || pgsPool == nil || rdsClient0 == nil || rdsClient1 == nil || lis == nil {
+func NewApp(serverName string, config Config, logger *logging.Logger, pgsPool *pgs.Postgres, rdsClient0, rdsClient1 *rds.Redis, m mailer.Mailer,
+	jwtKeys *jwt.KeyRing, jwtKeysSource JwtKeysSource, lis net.Listener) (*Application, error) {
+	if logger == nil || pgsPool == nil || rdsClient0 == nil || rdsClient1 == nil || m == nil ||
+		jwtKeys == nil || jwtKeysSource == nil || lis == nil {
 		return nil, errors.New("nil arguments passed to app builder")
 	}
 
+	if config.RefreshTokenKey == "" {
+		return nil, errors.New("refresh token key is not specified")
+	}
+
+	if config.OAuthClientSecretKey == "" {
+		return nil, errors.New("oauth client secret key is not specified")
+	}
+
+	for _, scheme := range config.OAuthNativeSchemes {
+		if scheme == "" || scheme == "http" || scheme == "https" || strings.ToLower(scheme) != scheme {
+			return nil, errors.New("oauth native schemes must be lowercase private-use schemes")
+		}
+	}
+
+	if config.TotpKey == "" {
+		return nil, errors.New("totp key is not specified")
+	}
+
+	if config.TotpIssuer == "" {
+		config.TotpIssuer = serverName
+	}
+
+	if config.Webauthn.RpId == "" || len(config.Webauthn.Origins) == 0 {
+		return nil, errors.New("webauthn relying party is not specified")
+	}
+
+	if config.AccessToken.Issuer == "" {
+		return nil, errors.New("access token issuer is not specified")
+	}
+
+	issuerUrl, err := url.Parse(config.AccessToken.Issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.Webauthn.RpName == "" {
+		config.Webauthn.RpName = serverName
+	}
+
+	identityProviders := make(map[string]*oidc.Provider, len(config.IdentityProviders))
+	for _, providerConfig := range config.IdentityProviders {
+		if !validIdentityProviderName(providerConfig.Name) {
+			return nil, fmt.Errorf("invalid identity provider name %q", providerConfig.Name)
+		}
+		if _, ok := identityProviders[providerConfig.Name]; ok {
+			return nil, fmt.Errorf("duplicate identity provider %q", providerConfig.Name)
+		}
+
+		provider, err := oidc.NewProvider(providerConfig, nil)
+		if err != nil {
+			return nil, err
+		}
+		identityProviders[providerConfig.Name] = provider
+	}
+
+	// Real ip header can be forged by anyone, so it is trusted only in requests coming from proxies
+	if config.RealIpHeader != "" && len(config.TrustedProxies) == 0 {
+		return nil, errors.New("trusted proxies are not specified for real ip header")
+	}
+	trustedProxies := make([]net.IP, 0, len(config.TrustedProxies))
+	for _, proxy := range config.TrustedProxies {
+		ip := net.ParseIP(proxy)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid trusted proxy address %q", proxy)
+		}
+		trustedProxies = append(trustedProxies, ip)
+	}
+
 	app := &Application{
-		logger:     logger,
-		pgsPool:    pgsPool,
-		rdsClient0: rdsClient0,
-		rdsClient1: rdsClient1,
-		lis:        lis,
-		rnd:        utils.NewRandom(time.Now().Unix()),
+		config:            config,
+		logger:            logger,
+		pgsPool:           pgsPool,
+		rdsClient0:        rdsClient0,
+		rdsClient1:        rdsClient1,
+		mailer:            m,
+		jwtKeys:           jwtKeys,
+		jwtKeysSource:     jwtKeysSource,
+		identityProviders: identityProviders,
+		trustedProxies:    trustedProxies,
+		lis:               lis,
 	}
 
+	app.checkEmailLimiter = ratelimit.NewLimiter(rdsClient0.Client(), "CHECK_EMAIL", config.RateLimits.Email)
+	app.registerLimiter = ratelimit.NewLimiter(rdsClient0.Client(), "REGISTER", config.RateLimits.Email)
+	app.loginLimiter = ratelimit.NewLimiter(rdsClient0.Client(), "LOGIN", config.RateLimits.Login)
+	app.loginLockout = ratelimit.NewLockout(rdsClient0.Client(), "LOGIN", config.RateLimits.Lockout)
+
 	r := router.New()
 	r.RedirectTrailingSlash = false
 	r.RedirectFixedPath = false
@@ -56,15 +179,47 @@ func NewApp(serverName string, logger *logging.Logger, pgsPool *pgs.Postgres, rd
 	r.MethodNotAllowed = app.set405
 
 	r.GET(V1+"/", app.status)
-	r.POST(V1+"/checkEmail", app.checkEmail)
-	r.POST(V1+"/register", app.register)
-	r.POST(V1+"/login", app.login)
-	r.POST(V1+"/refresh", app.refresh)
+	r.GET(V1+"/.well-known/jwks.json", app.jwks)
+	r.GET(strings.TrimSuffix(issuerUrl.Path, "/")+OidcDiscoveryPath, app.openidConfiguration)
+	r.POST(V1+"/checkEmail", withMiddlewares(app.checkEmail, app.limitByIp("CHECK_EMAIL")))
+	r.POST(V1+"/register", withMiddlewares(app.register, app.limitByIp("REGISTER")))
+	r.POST(V1+"/password/forgot", withMiddlewares(app.forgotPassword, app.limitByIp("FORGOT_PASSWORD")))
+	r.POST(V1+"/password/reset", withMiddlewares(app.resetPassword, app.hideRequestBody, app.limitByIp("RESET_PASSWORD")))
+	r.POST(V1+"/login", withMiddlewares(app.login, app.limitByIp("LOGIN")))
+	r.POST(V1+"/login/mfa", withMiddlewares(app.loginMfa, app.hideRequestBody, app.limitByIp("LOGIN_MFA")))
+	r.POST(V1+"/login/external/{provider}", withMiddlewares(app.externalLoginBegin, app.limitByIp("EXTERNAL_LOGIN_BEGIN")))
+	r.POST(V1+"/login/external/{provider}/callback", withMiddlewares(app.externalLoginFinish, app.limitByIp("EXTERNAL_LOGIN_FINISH")))
+	r.POST(V1+"/webauthn/login/begin", withMiddlewares(app.webauthnLoginBegin, app.limitByIp("WEBAUTHN_LOGIN_BEGIN")))
+	r.POST(V1+"/webauthn/login/finish", withMiddlewares(app.webauthnLoginFinish, app.limitByIp("WEBAUTHN_LOGIN_FINISH")))
+	r.POST(V1+"/webauthn/register/begin", withMiddlewares(app.webauthnRegisterBegin, app.authorize))
+	r.POST(V1+"/webauthn/register/finish", withMiddlewares(app.webauthnRegisterFinish, app.authorize))
+	r.POST(V1+"/refresh", withMiddlewares(app.refresh, app.limitByIp("REFRESH")))
 	r.DELETE(V1+"/refresh", withMiddlewares(app.revoke, app.authorize))
 	r.GET(V1+"/me/accessToken", withMiddlewares(app.jwtInfo, app.authorize))
+	r.POST(V1+"/me/email", withMiddlewares(app.changeEmail, app.authorize, app.limitByIp("CHANGE_EMAIL")))
+	r.POST(V1+"/me/email/confirm", withMiddlewares(app.confirmEmail, app.authorize, app.limitByIp("CONFIRM_EMAIL")))
+	r.POST(V1+"/me/totp", withMiddlewares(app.enrollTotp, app.hideResponseBody, app.authorize))
+	r.POST(V1+"/me/totp/confirm", withMiddlewares(app.confirmTotp, app.hideRequestBody, app.hideResponseBody, app.authorize, app.limitByIp("CONFIRM_TOTP")))
+	r.DELETE(V1+"/me/totp", withMiddlewares(app.disableTotp, app.hideRequestBody, app.authorize, app.limitByIp("DISABLE_TOTP")))
+	r.PATCH(V1+"/me/password", withMiddlewares(app.changePassword, app.hideRequestBody, app.authorize, app.limitByIp("CHANGE_PASSWORD")))
+	r.GET(V1+"/me/sessions", withMiddlewares(app.getSessions, app.authorize))
+	r.DELETE(V1+"/me/sessions/{id}", withMiddlewares(app.deleteSession, app.authorize))
+	r.GET(V1+"/users", withMiddlewares(app.getUsers, app.authorizeRoles(models.RoleCreator, models.RoleAdministrator, models.RoleModerator)))
+	r.GET(V1+"/user/{id}", withMiddlewares(app.getUser, app.authorizeRoles(models.RoleCreator, models.RoleAdministrator, models.RoleModerator)))
+	r.GET(V1+"/user/{id}/bans", withMiddlewares(app.getUserBans, app.authorizeRoles(models.RoleCreator, models.RoleAdministrator, models.RoleModerator)))
 	r.POST(V1+"/user/{id}/ban", withMiddlewares(app.ban, app.authorizeRoles(models.RoleCreator, models.RoleAdministrator)))
+	r.PATCH(V1+"/user/{id}/ban", withMiddlewares(app.editBan, app.authorizeRoles(models.RoleCreator, models.RoleAdministrator)))
 	r.DELETE(V1+"/user/{id}/ban", withMiddlewares(app.unban, app.authorizeRoles(models.RoleCreator, models.RoleAdministrator)))
 	r.PATCH(V1+"/user/{id}/role", withMiddlewares(app.changeRole, app.authorizeRoles(models.RoleCreator, models.RoleAdministrator)))
+	r.GET(V1+"/audit", withMiddlewares(app.getAudit, app.authorizeRoles(models.RoleCreator, models.RoleAdministrator)))
+	r.POST(V1+"/oauth/clients", withMiddlewares(app.createOAuthClient, app.hideResponseBody, app.authorizeRoles(models.RoleCreator)))
+	r.GET(V1+"/oauth/authorize", withMiddlewares(app.oauthAuthorize, app.authorize))
+	r.POST(V1+"/oauth/token", withMiddlewares(app.oauthToken, app.hideRequestBody, app.hideResponseBody, app.limitByIp("OAUTH_TOKEN")))
+	r.POST(V1+"/introspect", withMiddlewares(app.oauthIntrospect, app.hideRequestBody, app.limitByIp("INTROSPECT")))
+	r.POST(V1+"/revoke", withMiddlewares(app.oauthRevoke, app.hideRequestBody, app.limitByIp("REVOKE")))
+	r.GET(V1+"/userinfo", withMiddlewares(app.userInfo, app.authorizeScope(OidcScopeOpenId)))
+	r.POST(V1+"/userinfo", withMiddlewares(app.userInfo, app.authorizeScope(OidcScopeOpenId)))
+	r.POST(V1+"/keys/reload", withMiddlewares(app.reloadKeys, app.authorizeRoles(models.RoleCreator)))
 
 	app.server = &fasthttp.Server{
 		Handler: app.logMiddleware(r.Handler),
@@ -75,8 +230,8 @@ func NewApp(serverName string, logger *logging.Logger, pgsPool *pgs.Postgres, rd
 }
 
 func (a *Application) Serve() {
-	sigChan := make(chan os.Signal)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -91,11 +246,25 @@ func (a *Application) Serve() {
 
 	var err error
 
-	select {
-	case <-ctx.Done():
-		log.Println("SERVER STOPPED")
-	case <-sigChan:
-		log.Println("SHUTTING DOWN...")
+loop:
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("SERVER STOPPED")
+			break loop
+		case sig := <-sigChan:
+			if sig == syscall.SIGHUP {
+				err = a.reloadJwtKeys()
+				if err != nil {
+					log.Printf("JWT KEYS RELOAD ERROR: %v\n", err)
+				} else {
+					log.Println("JWT KEYS RELOADED")
+				}
+				continue
+			}
+			log.Println("SHUTTING DOWN...")
+			break loop
+		}
 	}
 
 	err = a.server.Shutdown()
@@ -103,6 +272,9 @@ func (a *Application) Serve() {
 		log.Printf("SHUT DOWN ERROR: %v\n", err)
 	}
 
+	// Mails sent in background may still write errors to log
+	a.mails.Wait()
+
 	err = a.logger.Close()
 	if err != nil {
 		log.Printf("ERROR SAVING LOG: %v\n", err)
@@ -110,3 +282,13 @@ func (a *Application) Serve() {
 
 	log.Println("SHUT DOWN OK")
 }
+
+// reloadJwtKeys replaces key ring contents with actual configuration. Current keys are kept on failure
+func (a *Application) reloadJwtKeys() error {
+	config, err := a.jwtKeysSource()
+	if err != nil {
+		return err
+	}
+
+	return a.jwtKeys.Reload(config)
+}
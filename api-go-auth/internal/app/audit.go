@@ -0,0 +1,169 @@
+package app
+
+import (
+	"auth/internal/models"
+	"auth/internal/storages"
+	"auth/pkg/jwt"
+	"auth/pkg/utils"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/jackc/pgtype/pgxtype"
+	"github.com/valyala/fasthttp"
+	"strconv"
+	"time"
+)
+
+// getAudit returns page of audit log, the latest records go first. Next page is requested with cursor of previous one
+func (a *Application) getAudit(ctx *fasthttp.RequestCtx) {
+	query, requestError := parseAuditQuery(ctx.QueryArgs())
+	if requestError != nil {
+		a.setCustomError(ctx, requestError)
+		return
+	}
+
+	conn, err := a.pgsPool.AcquireConnection(context.Background())
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	defer conn.Release()
+
+	// One more record is requested to find out whether next page exists
+	limit := query.Limit
+	query.Limit++
+
+	records, err := storages.NewAuditStorage(conn).Search(query)
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+
+	response := auditResponse{
+		Records: make([]auditRecordResponse, 0, limit),
+	}
+	for i, record := range records {
+		if i == limit {
+			response.NextCursor = strconv.FormatInt(records[i-1].Id, 10)
+			break
+		}
+		response.Records = append(response.Records, auditRecordResponse{
+			Id:        record.Id,
+			ActorId:   record.ActorId,
+			ActorRole: string(record.ActorRole),
+			TargetId:  record.TargetId,
+			Action:    record.Action,
+			OldValue:  record.OldValue,
+			NewValue:  record.NewValue,
+			Ip:        record.Ip,
+			RequestId: record.RequestId,
+			CreatedAt: record.CreatedAt.Unix(),
+		})
+	}
+
+	_ = json.NewEncoder(ctx).Encode(response)
+	ctx.SetContentType("application/json")
+}
+
+// audit records privileged action of user that made request. Values are marshalled to JSON, nil value means
+// that entity did not exist before or after action
+func (a *Application) audit(ctx *fasthttp.RequestCtx, q pgxtype.Querier, targetId int64, action string,
+	oldValue, newValue interface{}) error {
+	claims, ok := ctx.UserValue(JwtContext).(jwt.Claims)
+	if !ok {
+		return errors.New("access token error")
+	}
+	requestId, _ := ctx.UserValue(RequestIdContext).(string)
+
+	record := models.AuditRecord{
+		ActorId:   claims.Sub,
+		ActorRole: models.UserRole(claims.Rol),
+		TargetId:  targetId,
+		Action:    action,
+		Ip:        a.clientDevice(ctx).Ip,
+		RequestId: requestId,
+	}
+
+	var err error
+	if oldValue != nil {
+		record.OldValue, err = json.Marshal(oldValue)
+		if err != nil {
+			return err
+		}
+	}
+	if newValue != nil {
+		record.NewValue, err = json.Marshal(newValue)
+		if err != nil {
+			return err
+		}
+	}
+
+	return storages.NewAuditStorage(q).CreateAndStore(record)
+}
+
+// auditBan describes ban in audit log. Nil is returned for absent ban, so it is stored as absent value
+func auditBan(ban *models.Ban) interface{} {
+	if ban == nil {
+		return nil
+	}
+	return newBanResponse(*ban)
+}
+
+// auditRole describes role of user in audit log
+func auditRole(role models.UserRole) interface{} {
+	return auditRoleValue{Role: string(role)}
+}
+
+// parseAuditQuery builds audit log filter from query string
+func parseAuditQuery(args *fasthttp.Args) (models.AuditQuery, *models.Error) {
+	query := models.AuditQuery{
+		Limit: DefaultAuditPageLimit,
+	}
+
+	for name, value := range map[string]*int64{"actorId": &query.ActorId, "targetId": &query.TargetId} {
+		if !args.Has(name) {
+			continue
+		}
+		id, err := strconv.ParseInt(string(args.Peek(name)), 10, 64)
+		if err != nil || id <= 0 {
+			return query, models.InvalidAuditQueryError
+		}
+		*value = id
+	}
+
+	if args.Has("action") {
+		query.Action = string(args.Peek("action"))
+		if !utils.ExistsIn(auditActions, query.Action) {
+			return query, models.InvalidAuditQueryError
+		}
+	}
+
+	for name, value := range map[string]*time.Time{"from": &query.CreatedFrom, "till": &query.CreatedTill} {
+		if !args.Has(name) {
+			continue
+		}
+		unix, err := strconv.ParseInt(string(args.Peek(name)), 10, 64)
+		if err != nil || unix < 0 {
+			return query, models.InvalidAuditQueryError
+		}
+		*value = time.Unix(unix, 0).UTC()
+	}
+
+	if args.Has("limit") {
+		limit, err := strconv.Atoi(string(args.Peek("limit")))
+		if err != nil || limit < 1 || limit > MaxAuditPageLimit {
+			return query, models.InvalidAuditQueryError
+		}
+		query.Limit = limit
+	}
+
+	if args.Has("cursor") {
+		beforeId, err := strconv.ParseInt(string(args.Peek("cursor")), 10, 64)
+		if err != nil || beforeId <= 0 {
+			return query, models.InvalidPageCursorError
+		}
+		query.BeforeId = beforeId
+	}
+
+	return query, nil
+}
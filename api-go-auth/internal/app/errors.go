@@ -9,6 +9,9 @@ import (
 	"fmt"
 	"github.com/valyala/fasthttp"
 	"log"
+	"math"
+	"strconv"
+	"time"
 )
 
 type (
@@ -27,6 +30,11 @@ func (a *Application) setCustomError(ctx *fasthttp.RequestCtx, err *models.Error
 	ctx.SetStatusCode(e.StatusCode)
 }
 
+func (a *Application) set429(ctx *fasthttp.RequestCtx, err *models.Error, retryAfter time.Duration) {
+	ctx.Response.Header.Set("Retry-After", strconv.FormatInt(int64(math.Ceil(retryAfter.Seconds())), 10))
+	a.setCustomError(ctx, err)
+}
+
 func (a *Application) set400(ctx *fasthttp.RequestCtx) {
 	_ = json.NewEncoder(ctx).Encode(appError{
 		StatusCode: fasthttp.StatusBadRequest,
@@ -60,7 +68,12 @@ func (a *Application) set403(ctx *fasthttp.RequestCtx) {
 
 func (a *Application) set403Banned(ctx *fasthttp.RequestCtx, ban *models.Ban) {
 	var usrMsg string
-	if ban != nil {
+	if ban != nil && ban.IsPermanent() {
+		usrMsg = fmt.Sprintf("Your account was permanently banned (%s) by user #%d with reason: %s",
+			ban.At.Format("15:04 02-01-2006"),
+			ban.ByUserId,
+			ban.Reason)
+	} else if ban != nil {
 		usrMsg = fmt.Sprintf("Your account was banned (%s - %s) by user #%d with reason: %s",
 			ban.At.Format("15:04 02-01-2006"),
 			ban.Until.Format("15:04 02-01-2006"),
@@ -149,3 +162,30 @@ func (a *Application) set500Fatal(ctx *fasthttp.RequestCtx, i interface{}) {
 	ctx.SetContentType("application/json")
 	ctx.SetStatusCode(fasthttp.StatusInternalServerError)
 }
+
+// setOAuthError responds in format defined by RFC 6749 section 5.2. Token endpoint must not use appError
+func (a *Application) setOAuthError(ctx *fasthttp.RequestCtx, statusCode int, code, description string) {
+	if statusCode == fasthttp.StatusUnauthorized {
+		ctx.Response.Header.Set("WWW-Authenticate", `Basic realm="oauth"`)
+	}
+	_ = json.NewEncoder(ctx).Encode(oauthError{
+		Error:            code,
+		ErrorDescription: description,
+	})
+	ctx.SetContentType("application/json")
+	ctx.SetStatusCode(statusCode)
+}
+
+func (a *Application) logError(err error) {
+	logErr := a.logger.WriteError(err, logging.LevelError)
+	if logErr != nil {
+		log.Printf("LOG ERROR: %v\n", logErr)
+	}
+}
+
+func (a *Application) logSecurityEvent(event string) {
+	err := a.logger.WriteError(errors.New(event), logging.LevelSecurity)
+	if err != nil {
+		log.Printf("LOG ERROR: %v\n", err)
+	}
+}
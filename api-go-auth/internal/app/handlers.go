@@ -4,12 +4,16 @@ import (
 	"auth/internal/models"
 	"auth/internal/storages"
 	"auth/pkg/jwt"
+	"auth/pkg/totp"
 	"auth/pkg/utils"
+	"auth/pkg/webauthn"
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/valyala/fasthttp"
 	"strconv"
+	"time"
 )
 
 func (a *Application) status(ctx *fasthttp.RequestCtx) {
@@ -35,6 +39,16 @@ func (a *Application) checkEmail(ctx *fasthttp.RequestCtx) {
 		return
 	}
 
+	ok, retryAfter, err := a.checkEmailLimiter.Allow(request.Email)
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	if !ok {
+		a.set429(ctx, models.TooManyRequestsError, retryAfter)
+		return
+	}
+
 	conn, err := a.pgsPool.AcquireConnection(context.Background())
 	if err != nil {
 		a.set500(ctx, err)
@@ -52,10 +66,38 @@ func (a *Application) checkEmail(ctx *fasthttp.RequestCtx) {
 		return
 	}
 
-	code := a.rnd.Code(VerificationCodeLength)
-	err = storages.NewCodeStorage(a.rdsClient1.Client()).CreateAndStore(request.Email, code, VerificationCodeLifetime)
+	codes := storages.NewCodeStorage(a.rdsClient1.Client(), storages.CodePurposeEmail)
+
+	wait, err := codes.Cooldown(request.Email, VerificationCodeResendCooldown)
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	if wait > 0 {
+		a.set429(ctx, models.CodeResendCooldownError, wait)
+		return
+	}
+
+	code, err := utils.SecureCode(VerificationCodeLength)
 	if err != nil {
 		a.set500(ctx, err)
+		return
+	}
+
+	err = codes.CreateAndStore(request.Email, code, VerificationCodeLifetime)
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+
+	err = a.sendMail(request.Email, verificationCodeMail, codeMailData{
+		Code:     code,
+		Lifetime: int(VerificationCodeLifetime / time.Minute),
+	})
+	if err != nil {
+		// Code was not delivered, so user must be able to request it again right away
+		_ = codes.ReleaseCooldown(request.Email)
+		a.set500(ctx, err)
 	}
 }
 
@@ -77,13 +119,13 @@ func (a *Application) register(ctx *fasthttp.RequestCtx) {
 		return
 	}
 
-	ok, err := storages.NewCodeStorage(a.rdsClient1.Client()).VerifyCode(request.Email, request.Code)
+	ok, retryAfter, err := a.registerLimiter.Allow(request.Email)
 	if err != nil {
 		a.set500(ctx, err)
 		return
 	}
 	if !ok {
-		a.setCustomError(ctx, models.WrongCodeError)
+		a.set429(ctx, models.TooManyRequestsError, retryAfter)
 		return
 	}
 
@@ -106,6 +148,24 @@ func (a *Application) register(ctx *fasthttp.RequestCtx) {
 		return
 	}
 
+	// Code is consumed here, so all checks that do not require it must be done before
+	status, err := storages.NewCodeStorage(a.rdsClient1.Client(), storages.CodePurposeEmail).VerifyCode(request.Email, request.Code, VerificationCodeMaxAttempts)
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	switch status {
+	case models.CodeStatusWrong:
+		a.setCustomError(ctx, models.WrongCodeError)
+		return
+	case models.CodeStatusAttemptsExceeded:
+		a.setCustomError(ctx, models.CodeAttemptsExceededError)
+		return
+	case models.CodeStatusNotFound:
+		a.setCustomError(ctx, models.CodeExpiredError)
+		return
+	}
+
 	err = users.CreateAndStore(request.Email, request.Login, request.Password)
 	if err != nil {
 		a.set500(ctx, err)
@@ -115,8 +175,8 @@ func (a *Application) register(ctx *fasthttp.RequestCtx) {
 	ctx.SetStatusCode(fasthttp.StatusCreated)
 }
 
-func (a *Application) login(ctx *fasthttp.RequestCtx) {
-	var request loginRequest
+func (a *Application) forgotPassword(ctx *fasthttp.RequestCtx) {
+	var request forgotPasswordRequest
 	err := json.Unmarshal(ctx.Request.Body(), &request)
 	if err != nil {
 		a.set400(ctx)
@@ -133,6 +193,16 @@ func (a *Application) login(ctx *fasthttp.RequestCtx) {
 		return
 	}
 
+	ok, retryAfter, err := a.checkEmailLimiter.Allow(request.Email)
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	if !ok {
+		a.set429(ctx, models.TooManyRequestsError, retryAfter)
+		return
+	}
+
 	conn, err := a.pgsPool.AcquireConnection(context.Background())
 	if err != nil {
 		a.set500(ctx, err)
@@ -140,44 +210,49 @@ func (a *Application) login(ctx *fasthttp.RequestCtx) {
 	}
 	defer conn.Release()
 
-	user, err := storages.NewUserStorage(conn).GetByCredentials(models.UserCredentials{
-		Login:    request.Login,
-		Password: request.Password,
-	})
+	// Response must not reveal whether email is registered, so cooldown is applied to any email
+	// and mail is sent in background
+	codes := storages.NewCodeStorage(a.rdsClient1.Client(), storages.CodePurposePasswordReset)
+
+	wait, err := codes.Cooldown(request.Email, VerificationCodeResendCooldown)
 	if err != nil {
 		a.set500(ctx, err)
 		return
 	}
-	if user == nil {
-		a.setCustomError(ctx, models.WrongCredentialsError)
+	if wait > 0 {
+		a.set429(ctx, models.CodeResendCooldownError, wait)
 		return
 	}
 
-	ban, err := storages.NewBanStorage(a.rdsClient0.Client()).Get(user.Id)
+	user, err := storages.NewUserStorage(conn).GetByEmail(request.Email)
 	if err != nil {
 		a.set500(ctx, err)
 		return
 	}
-	if ban != nil {
-		a.set403Banned(ctx, ban)
+	if user == nil {
+		return
+	}
+
+	code, err := utils.SecureCode(VerificationCodeLength)
+	if err != nil {
+		a.set500(ctx, err)
 		return
 	}
 
-	refreshToken := a.rnd.String(RefreshTokenLength, RefreshTokenAlphabet)
-	err = storages.NewRefreshTokenStorage(conn).CreateAndStore(user.Id, refreshToken)
+	err = codes.CreateAndStore(request.Email, code, PasswordResetCodeLifetime)
 	if err != nil {
 		a.set500(ctx, err)
 		return
 	}
 
-	_ = json.NewEncoder(ctx).Encode(loginResponse{
-		RefreshToken: refreshToken,
+	a.sendMailInBackground(request.Email, passwordResetMail, codeMailData{
+		Code:     code,
+		Lifetime: int(PasswordResetCodeLifetime / time.Minute),
 	})
-	ctx.SetContentType("application/json")
 }
 
-func (a *Application) refresh(ctx *fasthttp.RequestCtx) {
-	var request refreshRequest
+func (a *Application) resetPassword(ctx *fasthttp.RequestCtx) {
+	var request resetPasswordRequest
 	err := json.Unmarshal(ctx.Request.Body(), &request)
 	if err != nil {
 		a.set400(ctx)
@@ -201,29 +276,62 @@ func (a *Application) refresh(ctx *fasthttp.RequestCtx) {
 	}
 	defer conn.Release()
 
-	refreshToken, err := storages.NewRefreshTokenStorage(conn).Get(request.RefreshToken, RefreshTokenLifePeriod)
+	users := storages.NewUserStorage(conn)
+
+	user, err := users.GetByEmail(request.Email)
 	if err != nil {
 		a.set500(ctx, err)
 		return
 	}
-	if refreshToken == nil {
-		a.setCustomError(ctx, models.WrongRefreshTokenError)
+	if user == nil {
+		a.setCustomError(ctx, models.CodeExpiredError)
 		return
 	}
 
-	accessToken, exp, iat := jwt.Create(refreshToken.User.Id, string(refreshToken.User.Role))
-	response := refreshResponse{
-		AccessToken: accessToken,
-		ExpiresAt:   exp,
-		IssuedAt:    iat,
+	status, err := storages.NewCodeStorage(a.rdsClient1.Client(), storages.CodePurposePasswordReset).
+		VerifyCode(request.Email, request.Code, VerificationCodeMaxAttempts)
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	switch status {
+	case models.CodeStatusWrong:
+		a.setCustomError(ctx, models.WrongCodeError)
+		return
+	case models.CodeStatusAttemptsExceeded:
+		a.setCustomError(ctx, models.CodeAttemptsExceededError)
+		return
+	case models.CodeStatusNotFound:
+		a.setCustomError(ctx, models.CodeExpiredError)
+		return
 	}
 
-	_ = json.NewEncoder(ctx).Encode(response)
-	ctx.SetContentType("application/json")
+	err = users.SetPassword(user.Id, request.Password)
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+
+	err = storages.NewRefreshTokenStorage(conn, []byte(a.config.RefreshTokenKey)).RevokeAllByUserId(user.Id)
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+
+	err = a.invalidateAccessTokens(user.Id)
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+
+	err = a.loginLockout.Reset(user.Login)
+	if err != nil {
+		a.set500(ctx, err)
+	}
 }
 
-func (a *Application) revoke(ctx *fasthttp.RequestCtx) {
-	var request refreshRequest
+func (a *Application) login(ctx *fasthttp.RequestCtx) {
+	var request loginRequest
 	err := json.Unmarshal(ctx.Request.Body(), &request)
 	if err != nil {
 		a.set400(ctx)
@@ -240,10 +348,23 @@ func (a *Application) revoke(ctx *fasthttp.RequestCtx) {
 		return
 	}
 
-	revokeType := string(ctx.QueryArgs().Peek("type"))
+	ok, retryAfter, err := a.loginLimiter.Allow(request.Login)
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	if !ok {
+		a.set429(ctx, models.TooManyRequestsError, retryAfter)
+		return
+	}
 
-	if !utils.ExistsIn(revokeTypes, revokeType) {
-		a.setCustomError(ctx, models.InvalidRevokeTypeError)
+	lockedFor, err := a.loginLockout.Locked(request.Login)
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	if lockedFor > 0 {
+		a.set429(ctx, models.AccountTemporarilyLockedError, lockedFor)
 		return
 	}
 
@@ -254,46 +375,51 @@ func (a *Application) revoke(ctx *fasthttp.RequestCtx) {
 	}
 	defer conn.Release()
 
-	refTokens := storages.NewRefreshTokenStorage(conn)
+	user, err := storages.NewUserStorage(conn).GetByCredentials(models.UserCredentials{
+		Login:    request.Login,
+		Password: request.Password,
+	})
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	if user == nil {
+		lockedFor, err = a.loginLockout.Fail(request.Login)
+		if err != nil {
+			a.set500(ctx, err)
+			return
+		}
+		if lockedFor > 0 {
+			a.set429(ctx, models.AccountTemporarilyLockedError, lockedFor)
+			return
+		}
 
-	switch revokeType {
-	case RefreshTokenRevokeTypeCurrent:
-		err = refTokens.Revoke(request.RefreshToken)
-	case RefreshTokenRevokeTypeAll:
-		err = refTokens.RevokeAll(request.RefreshToken)
-	case RefreshTokenRevokeTypeAllExceptCurrent:
-		err = refTokens.RevokeAllExceptCurrent(request.RefreshToken)
-	default:
-		a.setCustomError(ctx, models.InvalidRevokeTypeError)
+		a.setCustomError(ctx, models.WrongCredentialsError)
 		return
 	}
 
+	// Lockout is not reset until second factor is passed, otherwise it could be brute forced with known password
+	challenged, err := a.challengeSecondFactor(ctx, conn, user.Id)
 	if err != nil {
 		a.set500(ctx, err)
+		return
 	}
-}
-
-func (a *Application) jwtInfo(ctx *fasthttp.RequestCtx) {
-	claims, ok := ctx.UserValue(JwtContext).(jwt.Claims)
-	if !ok {
-		a.set500(ctx, errors.New("access token error"))
+	if challenged {
 		return
 	}
 
-	_ = json.NewEncoder(ctx).Encode(claims)
-	ctx.SetContentType("application/json")
-}
-
-func (a *Application) ban(ctx *fasthttp.RequestCtx) {
-	userIdFromRequest, _ := ctx.UserValue("id").(string)
-	userId, err := strconv.ParseInt(userIdFromRequest, 10, 64)
+	err = a.loginLockout.Reset(request.Login)
 	if err != nil {
-		a.set400(ctx)
+		a.set500(ctx, err)
 		return
 	}
 
-	var request banRequest
-	err = json.Unmarshal(ctx.Request.Body(), &request)
+	a.completeLogin(ctx, conn, user.Id)
+}
+
+func (a *Application) loginMfa(ctx *fasthttp.RequestCtx) {
+	var request loginMfaRequest
+	err := json.Unmarshal(ctx.Request.Body(), &request)
 	if err != nil {
 		a.set400(ctx)
 		return
@@ -309,6 +435,18 @@ func (a *Application) ban(ctx *fasthttp.RequestCtx) {
 		return
 	}
 
+	challenges := storages.NewMfaChallengeStorage(a.rdsClient0.Client())
+
+	userId, err := challenges.Get(request.MfaToken)
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	if userId == 0 {
+		a.setCustomError(ctx, models.WrongMfaTokenError)
+		return
+	}
+
 	conn, err := a.pgsPool.AcquireConnection(context.Background())
 	if err != nil {
 		a.set500(ctx, err)
@@ -322,94 +460,102 @@ func (a *Application) ban(ctx *fasthttp.RequestCtx) {
 		return
 	}
 	if user == nil {
-		a.setCustomError(ctx, models.WrongUserIdError)
+		a.setCustomError(ctx, models.WrongMfaTokenError)
 		return
 	}
 
-	jwtToken, ok := ctx.UserValue(JwtContext).(jwt.Claims)
-	if !ok {
-		a.set500(ctx, errors.New("access token error"))
+	lockedFor, err := a.loginLockout.Locked(user.Login)
+	if err != nil {
+		a.set500(ctx, err)
 		return
 	}
-
-	myRole, ok := models.ToRole(jwtToken.Rol)
-	if !ok {
-		a.setCustomError(ctx, models.InvalidMyRoleError)
+	if lockedFor > 0 {
+		a.set429(ctx, models.AccountTemporarilyLockedError, lockedFor)
 		return
 	}
 
-	if !myRole.IsHigher(user.Role) {
-		a.setCustomError(ctx, models.NoPermissionToBanUserError)
-		return
-	}
+	totps := storages.NewTotpStorage(conn, []byte(a.config.TotpKey))
 
-	err = storages.NewBanStorage(a.rdsClient0.Client()).CreateAndStore(userId, request.Reason, request.Until, jwtToken.Sub)
+	userTotp, err := totps.Get(user.Id)
 	if err != nil {
 		a.set500(ctx, err)
 		return
 	}
-
-	_ = storages.NewRefreshTokenStorage(conn).RevokeAllByUserId(userId)
-}
-
-func (a *Application) unban(ctx *fasthttp.RequestCtx) {
-	userIdFromRequest, _ := ctx.UserValue("id").(string)
-	userId, err := strconv.ParseInt(userIdFromRequest, 10, 64)
-	if err != nil {
-		a.set400(ctx)
+	if userTotp == nil || !userTotp.IsEnabled {
+		a.setCustomError(ctx, models.WrongMfaTokenError)
 		return
 	}
 
-	conn, err := a.pgsPool.AcquireConnection(context.Background())
+	ok, err := a.verifySecondFactor(totps, userTotp, request.Code)
 	if err != nil {
 		a.set500(ctx, err)
 		return
 	}
-	defer conn.Release()
+	if !ok {
+		lockedFor, err = a.loginLockout.Fail(user.Login)
+		if err != nil {
+			a.set500(ctx, err)
+			return
+		}
+		if lockedFor > 0 {
+			a.set429(ctx, models.AccountTemporarilyLockedError, lockedFor)
+			return
+		}
 
-	user, err := storages.NewUserStorage(conn).GetById(userId)
-	if err != nil {
-		a.set500(ctx, err)
+		a.setCustomError(ctx, models.WrongMfaCodeError)
 		return
 	}
-	if user == nil {
-		a.setCustomError(ctx, models.WrongUserIdError)
+
+	ok, err = challenges.Consume(request.MfaToken)
+	if err != nil {
+		a.set500(ctx, err)
 		return
 	}
-
-	jwtToken, ok := ctx.UserValue(JwtContext).(jwt.Claims)
 	if !ok {
-		a.set500(ctx, errors.New("access token error"))
+		a.setCustomError(ctx, models.WrongMfaTokenError)
 		return
 	}
 
-	myRole, ok := models.ToRole(jwtToken.Rol)
-	if !ok {
-		a.setCustomError(ctx, models.InvalidMyRoleError)
+	err = a.loginLockout.Reset(user.Login)
+	if err != nil {
+		a.set500(ctx, err)
 		return
 	}
 
-	if !myRole.IsHigher(user.Role) {
-		a.setCustomError(ctx, models.NoPermissionToUnbanUserError)
+	a.completeLogin(ctx, conn, user.Id)
+}
+
+func (a *Application) webauthnLoginBegin(ctx *fasthttp.RequestCtx) {
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		a.set500(ctx, err)
 		return
 	}
 
-	err = storages.NewBanStorage(a.rdsClient0.Client()).Delete(userId)
+	sessionId, err := utils.SecureString(WebauthnSessionIdLength, RefreshTokenAlphabet)
 	if err != nil {
 		a.set500(ctx, err)
+		return
 	}
-}
 
-func (a *Application) changeRole(ctx *fasthttp.RequestCtx) {
-	userIdFromRequest, _ := ctx.UserValue("id").(string)
-	userId, err := strconv.ParseInt(userIdFromRequest, 10, 64)
+	err = storages.NewWebauthnSessionStorage(a.rdsClient0.Client()).CreateAndStore(sessionId, models.WebauthnSession{
+		Challenge: challenge,
+	}, WebauthnCeremonyTimeout)
 	if err != nil {
-		a.set400(ctx)
+		a.set500(ctx, err)
 		return
 	}
 
-	var request changeRoleRequest
-	err = json.Unmarshal(ctx.Request.Body(), &request)
+	_ = json.NewEncoder(ctx).Encode(webauthnLoginBeginResponse{
+		SessionId: sessionId,
+		PublicKey: a.config.Webauthn.RequestOptions(challenge, WebauthnCeremonyTimeout),
+	})
+	ctx.SetContentType("application/json")
+}
+
+func (a *Application) webauthnLoginFinish(ctx *fasthttp.RequestCtx) {
+	var request webauthnLoginFinishRequest
+	err := json.Unmarshal(ctx.Request.Body(), &request)
 	if err != nil {
 		a.set400(ctx)
 		return
@@ -425,6 +571,22 @@ func (a *Application) changeRole(ctx *fasthttp.RequestCtx) {
 		return
 	}
 
+	session, err := storages.NewWebauthnSessionStorage(a.rdsClient0.Client()).Consume(request.SessionId)
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	if session == nil || session.UserId != 0 {
+		a.setCustomError(ctx, models.WrongWebauthnSessionError)
+		return
+	}
+
+	credentialId, err := webauthn.DecodeId(request.Credential.RawId)
+	if err != nil {
+		a.setCustomError(ctx, models.WrongCredentialsError)
+		return
+	}
+
 	conn, err := a.pgsPool.AcquireConnection(context.Background())
 	if err != nil {
 		a.set500(ctx, err)
@@ -432,32 +594,1208 @@ func (a *Application) changeRole(ctx *fasthttp.RequestCtx) {
 	}
 	defer conn.Release()
 
-	users := storages.NewUserStorage(conn)
+	credentials := storages.NewWebauthnCredentialStorage(conn)
 
-	user, err := users.GetById(userId)
+	credential, err := credentials.Get(credentialId)
 	if err != nil {
 		a.set500(ctx, err)
 		return
 	}
-	if user == nil {
-		a.setCustomError(ctx, models.WrongUserIdError)
+	if credential == nil {
+		a.setCustomError(ctx, models.WrongCredentialsError)
 		return
 	}
 
-	jwtToken, ok := ctx.UserValue(JwtContext).(jwt.Claims)
-	if !ok {
-		a.set500(ctx, errors.New("access token error"))
+	if request.Credential.Response.UserHandle != "" &&
+		request.Credential.Response.UserHandle != webauthnUserHandle(credential.UserId) {
+		a.setCustomError(ctx, models.WrongCredentialsError)
 		return
 	}
 
-	myRole, ok := models.ToRole(jwtToken.Rol)
-	if !ok {
-		a.setCustomError(ctx, models.InvalidMyRoleError)
+	signCount, err := a.config.Webauthn.VerifyAssertion(session.Challenge, request.Credential, credential.PublicKey,
+		uint32(credential.SignCount))
+	if err != nil {
+		if errors.Is(err, webauthn.ErrSignCountNotGreater) {
+			a.logSecurityEvent(fmt.Sprintf("webauthn credential clone suspected: user #%d, credential %s",
+				credential.UserId, webauthn.EncodeId(credential.Id)))
+		}
+		a.setCustomError(ctx, models.WrongCredentialsError)
 		return
 	}
 
-	requestRole, ok := models.ToRole(request.Role)
-	if !ok {
+	err = credentials.UpdateSignCount(credential.Id, int64(signCount))
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+
+	a.completeLogin(ctx, conn, credential.UserId)
+}
+
+func (a *Application) refresh(ctx *fasthttp.RequestCtx) {
+	var request refreshRequest
+	err := json.Unmarshal(ctx.Request.Body(), &request)
+	if err != nil {
+		a.set400(ctx)
+		return
+	}
+
+	requestError, err := request.Validate()
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	if requestError != nil {
+		a.setCustomError(ctx, requestError)
+		return
+	}
+
+	conn, err := a.pgsPool.AcquireConnection(context.Background())
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	defer conn.Release()
+
+	refTokens := storages.NewRefreshTokenStorage(conn, []byte(a.config.RefreshTokenKey))
+
+	newRefreshToken, err := utils.SecureString(RefreshTokenLength, RefreshTokenAlphabet)
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+
+	refreshToken, err := refTokens.Rotate(request.RefreshToken, newRefreshToken, "", a.clientDevice(ctx), RefreshTokenLifePeriod)
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	if refreshToken == nil {
+		rotatedToken, err := refTokens.GetRotated(request.RefreshToken)
+		if err != nil {
+			a.set500(ctx, err)
+			return
+		}
+
+		if rotatedToken != nil {
+			err = a.revokeSession(refTokens, rotatedToken.SessionId)
+			if err != nil {
+				a.set500(ctx, err)
+				return
+			}
+
+			a.logSecurityEvent(fmt.Sprintf("refresh token reuse detected: user #%d, session %s has been revoked",
+				rotatedToken.User.Id, rotatedToken.SessionId))
+		}
+
+		a.setCustomError(ctx, models.WrongRefreshTokenError)
+		return
+	}
+
+	ban, err := a.getActiveBan(conn, refreshToken.User.Id)
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	if ban != nil {
+		a.set403Banned(ctx, ban)
+		return
+	}
+
+	accessToken, claims, err := a.createAccessToken(refreshToken.User.Id, refreshToken.User.Role, refreshToken.SessionId)
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+
+	response := refreshResponse{
+		RefreshToken: newRefreshToken,
+		AccessToken:  accessToken,
+		ExpiresAt:    claims.Exp,
+		IssuedAt:     claims.Iat,
+	}
+
+	_ = json.NewEncoder(ctx).Encode(response)
+	ctx.SetContentType("application/json")
+}
+
+func (a *Application) revoke(ctx *fasthttp.RequestCtx) {
+	var request refreshRequest
+	err := json.Unmarshal(ctx.Request.Body(), &request)
+	if err != nil {
+		a.set400(ctx)
+		return
+	}
+
+	requestError, err := request.Validate()
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	if requestError != nil {
+		a.setCustomError(ctx, requestError)
+		return
+	}
+
+	revokeType := string(ctx.QueryArgs().Peek("type"))
+
+	if !utils.ExistsIn(revokeTypes, revokeType) {
+		a.setCustomError(ctx, models.InvalidRevokeTypeError)
+		return
+	}
+
+	conn, err := a.pgsPool.AcquireConnection(context.Background())
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	defer conn.Release()
+
+	refTokens := storages.NewRefreshTokenStorage(conn, []byte(a.config.RefreshTokenKey))
+
+	jwtToken, ok := ctx.UserValue(JwtContext).(jwt.Claims)
+	if !ok {
+		a.set500(ctx, errors.New("access token error"))
+		return
+	}
+
+	accessTokens := storages.NewAccessTokenStorage(a.rdsClient0.Client())
+
+	switch revokeType {
+	case RefreshTokenRevokeTypeCurrent:
+		err = refTokens.Revoke(request.RefreshToken)
+		if err == nil {
+			err = accessTokens.Revoke(jwtToken.Jti, jwtToken.Exp)
+		}
+	case RefreshTokenRevokeTypeAll:
+		err = refTokens.RevokeAll(request.RefreshToken)
+		if err == nil {
+			err = accessTokens.RevokeAllByUserId(jwtToken.Sub, "")
+		}
+	case RefreshTokenRevokeTypeAllExceptCurrent:
+		err = refTokens.RevokeAllExceptCurrent(request.RefreshToken)
+		if err == nil {
+			err = accessTokens.RevokeAllByUserId(jwtToken.Sub, jwtToken.Jti)
+		}
+	default:
+		a.setCustomError(ctx, models.InvalidRevokeTypeError)
+		return
+	}
+
+	if err != nil {
+		a.set500(ctx, err)
+	}
+}
+
+func (a *Application) changePassword(ctx *fasthttp.RequestCtx) {
+	var request changePasswordRequest
+	err := json.Unmarshal(ctx.Request.Body(), &request)
+	if err != nil {
+		a.set400(ctx)
+		return
+	}
+
+	requestError, err := request.Validate()
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	if requestError != nil {
+		a.setCustomError(ctx, requestError)
+		return
+	}
+
+	jwtToken, ok := ctx.UserValue(JwtContext).(jwt.Claims)
+	if !ok {
+		a.set500(ctx, errors.New("access token error"))
+		return
+	}
+
+	conn, err := a.pgsPool.AcquireConnection(context.Background())
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	defer conn.Release()
+
+	refTokens := storages.NewRefreshTokenStorage(conn, []byte(a.config.RefreshTokenKey))
+
+	// Refresh token is checked before password is changed, so request can be safely repeated
+	if request.RevokeOtherSessions {
+		refreshToken, err := refTokens.Get(request.RefreshToken, RefreshTokenLifePeriod)
+		if err != nil {
+			a.set500(ctx, err)
+			return
+		}
+		if refreshToken == nil || refreshToken.User.Id != jwtToken.Sub {
+			a.setCustomError(ctx, models.WrongRefreshTokenError)
+			return
+		}
+	}
+
+	ok, err = storages.NewUserStorage(conn).ChangePassword(jwtToken.Sub, request.OldPassword, request.NewPassword)
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	if !ok {
+		a.setCustomError(ctx, models.WrongPasswordError)
+		return
+	}
+
+	// Access tokens issued before change are invalidated anyway, caller gets fresh one in response
+	err = a.invalidateAccessTokens(jwtToken.Sub)
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+
+	if request.RevokeOtherSessions {
+		err = refTokens.RevokeAllExceptCurrent(request.RefreshToken)
+		if err != nil {
+			a.set500(ctx, err)
+			return
+		}
+	}
+
+	accessToken, claims, err := a.createAccessToken(jwtToken.Sub, models.UserRole(jwtToken.Rol), jwtToken.Sid)
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+
+	_ = json.NewEncoder(ctx).Encode(changePasswordResponse{
+		AccessToken: accessToken,
+		ExpiresAt:   claims.Exp,
+		IssuedAt:    claims.Iat,
+	})
+	ctx.SetContentType("application/json")
+}
+
+func (a *Application) changeEmail(ctx *fasthttp.RequestCtx) {
+	var request changeEmailRequest
+	err := json.Unmarshal(ctx.Request.Body(), &request)
+	if err != nil {
+		a.set400(ctx)
+		return
+	}
+
+	requestError, err := request.Validate()
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	if requestError != nil {
+		a.setCustomError(ctx, requestError)
+		return
+	}
+
+	jwtToken, ok := ctx.UserValue(JwtContext).(jwt.Claims)
+	if !ok {
+		a.set500(ctx, errors.New("access token error"))
+		return
+	}
+
+	ok, retryAfter, err := a.checkEmailLimiter.Allow(request.Email)
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	if !ok {
+		a.set429(ctx, models.TooManyRequestsError, retryAfter)
+		return
+	}
+
+	conn, err := a.pgsPool.AcquireConnection(context.Background())
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	defer conn.Release()
+
+	exists, err := storages.NewUserStorage(conn).EmailExists(request.Email)
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	if exists {
+		a.setCustomError(ctx, models.EmailExistsError)
+		return
+	}
+
+	codes := storages.NewCodeStorage(a.rdsClient1.Client(), storages.CodePurposeEmailChange)
+	identifier := emailChangeCodeIdentifier(jwtToken.Sub, request.Email)
+
+	wait, err := codes.Cooldown(identifier, VerificationCodeResendCooldown)
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	if wait > 0 {
+		a.set429(ctx, models.CodeResendCooldownError, wait)
+		return
+	}
+
+	code, err := utils.SecureCode(VerificationCodeLength)
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+
+	err = codes.CreateAndStore(identifier, code, VerificationCodeLifetime)
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+
+	err = a.sendMail(request.Email, verificationCodeMail, codeMailData{
+		Code:     code,
+		Lifetime: int(VerificationCodeLifetime / time.Minute),
+	})
+	if err != nil {
+		_ = codes.ReleaseCooldown(identifier)
+		a.set500(ctx, err)
+	}
+}
+
+func (a *Application) confirmEmail(ctx *fasthttp.RequestCtx) {
+	var request confirmEmailRequest
+	err := json.Unmarshal(ctx.Request.Body(), &request)
+	if err != nil {
+		a.set400(ctx)
+		return
+	}
+
+	requestError, err := request.Validate()
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	if requestError != nil {
+		a.setCustomError(ctx, requestError)
+		return
+	}
+
+	jwtToken, ok := ctx.UserValue(JwtContext).(jwt.Claims)
+	if !ok {
+		a.set500(ctx, errors.New("access token error"))
+		return
+	}
+
+	conn, err := a.pgsPool.AcquireConnection(context.Background())
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	defer conn.Release()
+
+	users := storages.NewUserStorage(conn)
+
+	// Code is consumed here, so all checks that do not require it must be done before
+	exists, err := users.EmailExists(request.Email)
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	if exists {
+		a.setCustomError(ctx, models.EmailExistsError)
+		return
+	}
+
+	status, err := storages.NewCodeStorage(a.rdsClient1.Client(), storages.CodePurposeEmailChange).
+		VerifyCode(emailChangeCodeIdentifier(jwtToken.Sub, request.Email), request.Code, VerificationCodeMaxAttempts)
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	switch status {
+	case models.CodeStatusWrong:
+		a.setCustomError(ctx, models.WrongCodeError)
+		return
+	case models.CodeStatusAttemptsExceeded:
+		a.setCustomError(ctx, models.CodeAttemptsExceededError)
+		return
+	case models.CodeStatusNotFound:
+		a.setCustomError(ctx, models.CodeExpiredError)
+		return
+	}
+
+	oldEmail, err := users.ChangeEmail(jwtToken.Sub, request.Email)
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	if oldEmail == "" {
+		a.setCustomError(ctx, models.EmailExistsError)
+		return
+	}
+
+	// Email is already changed and code is used, so failed notification must not fail request
+	err = a.sendMail(oldEmail, emailChangedMail, emailChangedMailData{
+		Email: request.Email,
+	})
+	if err != nil {
+		a.logError(err)
+	}
+}
+
+func (a *Application) enrollTotp(ctx *fasthttp.RequestCtx) {
+	jwtToken, ok := ctx.UserValue(JwtContext).(jwt.Claims)
+	if !ok {
+		a.set500(ctx, errors.New("access token error"))
+		return
+	}
+
+	conn, err := a.pgsPool.AcquireConnection(context.Background())
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	defer conn.Release()
+
+	user, err := storages.NewUserStorage(conn).GetById(jwtToken.Sub)
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	if user == nil {
+		a.setCustomError(ctx, models.WrongUserIdError)
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+
+	created, err := storages.NewTotpStorage(conn, []byte(a.config.TotpKey)).CreateAndStore(user.Id, secret)
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	if !created {
+		a.setCustomError(ctx, models.TotpAlreadyEnabledError)
+		return
+	}
+
+	_ = json.NewEncoder(ctx).Encode(enrollTotpResponse{
+		Secret: totp.EncodeSecret(secret),
+		Uri:    totp.URI(a.config.TotpIssuer, user.Login, secret, totp.DefaultParams),
+	})
+	ctx.SetContentType("application/json")
+}
+
+func (a *Application) confirmTotp(ctx *fasthttp.RequestCtx) {
+	var request totpCodeRequest
+	err := json.Unmarshal(ctx.Request.Body(), &request)
+	if err != nil {
+		a.set400(ctx)
+		return
+	}
+
+	requestError, err := request.Validate()
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	if requestError != nil {
+		a.setCustomError(ctx, requestError)
+		return
+	}
+
+	jwtToken, ok := ctx.UserValue(JwtContext).(jwt.Claims)
+	if !ok {
+		a.set500(ctx, errors.New("access token error"))
+		return
+	}
+
+	conn, err := a.pgsPool.AcquireConnection(context.Background())
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	defer conn.Release()
+
+	totps := storages.NewTotpStorage(conn, []byte(a.config.TotpKey))
+
+	userTotp, err := totps.Get(jwtToken.Sub)
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	if userTotp == nil {
+		a.setCustomError(ctx, models.TotpNotEnabledError)
+		return
+	}
+	if userTotp.IsEnabled {
+		a.setCustomError(ctx, models.TotpAlreadyEnabledError)
+		return
+	}
+
+	ok, step := totp.DefaultParams.Validate(userTotp.Secret, request.Code, time.Now())
+	if ok {
+		ok, err = totps.UseStep(userTotp.UserId, step)
+		if err != nil {
+			a.set500(ctx, err)
+			return
+		}
+	}
+	if !ok {
+		a.setCustomError(ctx, models.WrongMfaCodeError)
+		return
+	}
+
+	recoveryCodes := make([]string, RecoveryCodesCount)
+	for i := range recoveryCodes {
+		recoveryCodes[i], err = utils.SecureString(RecoveryCodeLength, RecoveryCodeAlphabet)
+		if err != nil {
+			a.set500(ctx, err)
+			return
+		}
+	}
+
+	enabled, err := totps.Enable(userTotp.UserId, recoveryCodes)
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	if !enabled {
+		a.setCustomError(ctx, models.TotpAlreadyEnabledError)
+		return
+	}
+
+	_ = json.NewEncoder(ctx).Encode(confirmTotpResponse{
+		RecoveryCodes: recoveryCodes,
+	})
+	ctx.SetContentType("application/json")
+}
+
+func (a *Application) disableTotp(ctx *fasthttp.RequestCtx) {
+	var request totpCodeRequest
+	err := json.Unmarshal(ctx.Request.Body(), &request)
+	if err != nil {
+		a.set400(ctx)
+		return
+	}
+
+	requestError, err := request.Validate()
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	if requestError != nil {
+		a.setCustomError(ctx, requestError)
+		return
+	}
+
+	jwtToken, ok := ctx.UserValue(JwtContext).(jwt.Claims)
+	if !ok {
+		a.set500(ctx, errors.New("access token error"))
+		return
+	}
+
+	conn, err := a.pgsPool.AcquireConnection(context.Background())
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	defer conn.Release()
+
+	user, err := storages.NewUserStorage(conn).GetById(jwtToken.Sub)
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	if user == nil {
+		a.setCustomError(ctx, models.InvalidAccessTokenClaimsError)
+		return
+	}
+
+	// Disabling shares lockout with login, otherwise stolen access token would allow to brute force second factor
+	lockedFor, err := a.loginLockout.Locked(user.Login)
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	if lockedFor > 0 {
+		a.set429(ctx, models.AccountTemporarilyLockedError, lockedFor)
+		return
+	}
+
+	totps := storages.NewTotpStorage(conn, []byte(a.config.TotpKey))
+
+	userTotp, err := totps.Get(user.Id)
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	if userTotp == nil || !userTotp.IsEnabled {
+		a.setCustomError(ctx, models.TotpNotEnabledError)
+		return
+	}
+
+	ok, err = a.verifySecondFactor(totps, userTotp, request.Code)
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	if !ok {
+		lockedFor, err = a.loginLockout.Fail(user.Login)
+		if err != nil {
+			a.set500(ctx, err)
+			return
+		}
+		if lockedFor > 0 {
+			a.set429(ctx, models.AccountTemporarilyLockedError, lockedFor)
+			return
+		}
+
+		a.setCustomError(ctx, models.WrongMfaCodeError)
+		return
+	}
+
+	err = totps.Disable(userTotp.UserId)
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+
+	err = a.loginLockout.Reset(user.Login)
+	if err != nil {
+		a.set500(ctx, err)
+	}
+}
+
+func (a *Application) webauthnRegisterBegin(ctx *fasthttp.RequestCtx) {
+	jwtToken, ok := ctx.UserValue(JwtContext).(jwt.Claims)
+	if !ok {
+		a.set500(ctx, errors.New("access token error"))
+		return
+	}
+
+	conn, err := a.pgsPool.AcquireConnection(context.Background())
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	defer conn.Release()
+
+	user, err := storages.NewUserStorage(conn).GetById(jwtToken.Sub)
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	if user == nil {
+		a.setCustomError(ctx, models.WrongUserIdError)
+		return
+	}
+
+	registered, err := storages.NewWebauthnCredentialStorage(conn).GetByUserId(user.Id)
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+
+	exclude := make([][]byte, len(registered))
+	for i, credential := range registered {
+		exclude[i] = credential.Id
+	}
+
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+
+	sessionId, err := utils.SecureString(WebauthnSessionIdLength, RefreshTokenAlphabet)
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+
+	err = storages.NewWebauthnSessionStorage(a.rdsClient0.Client()).CreateAndStore(sessionId, models.WebauthnSession{
+		Challenge: challenge,
+		UserId:    user.Id,
+	}, WebauthnCeremonyTimeout)
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+
+	_ = json.NewEncoder(ctx).Encode(webauthnRegisterBeginResponse{
+		SessionId: sessionId,
+		PublicKey: a.config.Webauthn.CreationOptions(challenge, webauthn.User{
+			Id:          webauthnUserHandle(user.Id),
+			Name:        user.Login,
+			DisplayName: user.Login,
+		}, exclude, WebauthnCeremonyTimeout),
+	})
+	ctx.SetContentType("application/json")
+}
+
+func (a *Application) webauthnRegisterFinish(ctx *fasthttp.RequestCtx) {
+	var request webauthnRegisterFinishRequest
+	err := json.Unmarshal(ctx.Request.Body(), &request)
+	if err != nil {
+		a.set400(ctx)
+		return
+	}
+
+	requestError, err := request.Validate()
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	if requestError != nil {
+		a.setCustomError(ctx, requestError)
+		return
+	}
+
+	jwtToken, ok := ctx.UserValue(JwtContext).(jwt.Claims)
+	if !ok {
+		a.set500(ctx, errors.New("access token error"))
+		return
+	}
+
+	session, err := storages.NewWebauthnSessionStorage(a.rdsClient0.Client()).Consume(request.SessionId)
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	if session == nil || session.UserId != jwtToken.Sub {
+		a.setCustomError(ctx, models.WrongWebauthnSessionError)
+		return
+	}
+
+	credential, err := a.config.Webauthn.VerifyRegistration(session.Challenge, request.Credential)
+	if err != nil {
+		a.setCustomError(ctx, models.InvalidWebauthnCredentialError)
+		return
+	}
+
+	conn, err := a.pgsPool.AcquireConnection(context.Background())
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	defer conn.Release()
+
+	created, err := storages.NewWebauthnCredentialStorage(conn).CreateAndStore(jwtToken.Sub, credential.Id, credential.PublicKey,
+		int64(credential.SignCount))
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	if !created {
+		a.setCustomError(ctx, models.WebauthnCredentialExistsError)
+		return
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusCreated)
+}
+
+func (a *Application) jwks(ctx *fasthttp.RequestCtx) {
+	_ = json.NewEncoder(ctx).Encode(a.jwtKeys.JWKS())
+	ctx.Response.Header.Set("Cache-Control", JwksCacheControl)
+	ctx.SetContentType("application/json")
+}
+
+func (a *Application) jwtInfo(ctx *fasthttp.RequestCtx) {
+	claims, ok := ctx.UserValue(JwtContext).(jwt.Claims)
+	if !ok {
+		a.set500(ctx, errors.New("access token error"))
+		return
+	}
+
+	_ = json.NewEncoder(ctx).Encode(claims)
+	ctx.SetContentType("application/json")
+}
+
+func (a *Application) ban(ctx *fasthttp.RequestCtx) {
+	userIdFromRequest, _ := ctx.UserValue("id").(string)
+	userId, err := strconv.ParseInt(userIdFromRequest, 10, 64)
+	if err != nil {
+		a.set400(ctx)
+		return
+	}
+
+	var request banRequest
+	err = json.Unmarshal(ctx.Request.Body(), &request)
+	if err != nil {
+		a.set400(ctx)
+		return
+	}
+
+	requestError, err := request.Validate()
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	if requestError != nil {
+		a.setCustomError(ctx, requestError)
+		return
+	}
+
+	conn, err := a.pgsPool.AcquireConnection(context.Background())
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	defer conn.Release()
+
+	jwtToken, ok := ctx.UserValue(JwtContext).(jwt.Claims)
+	if !ok {
+		a.set500(ctx, errors.New("access token error"))
+		return
+	}
+
+	myRole, ok := models.ToRole(jwtToken.Rol)
+	if !ok {
+		a.setCustomError(ctx, models.InvalidMyRoleError)
+		return
+	}
+
+	// Ban is stored along with audit record, so one is never done without another
+	tx, err := conn.Begin(context.Background())
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	defer func() { _ = tx.Rollback(context.Background()) }()
+
+	// Row of user is locked, so concurrent changes of the same ban are checked against policy one by one
+	user, err := storages.NewUserStorage(tx).GetByIdForUpdate(userId)
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	if user == nil {
+		a.setCustomError(ctx, models.WrongUserIdError)
+		return
+	}
+
+	if !myRole.IsHigher(user.Role) {
+		a.setCustomError(ctx, models.NoPermissionToBanUserError)
+		return
+	}
+
+	bans := storages.NewBanStorage(tx)
+
+	activeBan, err := bans.GetActive(userId)
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+
+	until := banUntil(request.Until, request.Permanent)
+
+	requestError = checkBanPolicy(myRole, activeBan, until)
+	if requestError != nil {
+		a.setCustomError(ctx, requestError)
+		return
+	}
+
+	ban, err := bans.CreateAndStore(userId, request.Reason, until, jwtToken.Sub, banIssuerRole(myRole, activeBan))
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+
+	err = a.audit(ctx, tx, userId, models.AuditActionBan, auditBan(activeBan), auditBan(ban))
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+
+	err = tx.Commit(context.Background())
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+
+	// Ban is already stored, so user must lose access even if caching fails
+	cacheErr := storages.NewBanCacheStorage(a.rdsClient0.Client()).Store(*ban)
+
+	_ = storages.NewRefreshTokenStorage(conn, []byte(a.config.RefreshTokenKey)).RevokeAllByUserId(userId)
+
+	err = a.invalidateAccessTokens(userId)
+	if err == nil {
+		err = cacheErr
+	}
+	if err != nil {
+		a.set500(ctx, err)
+	}
+}
+
+// editBan replaces active ban with changed one, so previous terms stay in ban history
+func (a *Application) editBan(ctx *fasthttp.RequestCtx) {
+	userIdFromRequest, _ := ctx.UserValue("id").(string)
+	userId, err := strconv.ParseInt(userIdFromRequest, 10, 64)
+	if err != nil {
+		a.set400(ctx)
+		return
+	}
+
+	var request editBanRequest
+	err = json.Unmarshal(ctx.Request.Body(), &request)
+	if err != nil {
+		a.set400(ctx)
+		return
+	}
+
+	requestError, err := request.Validate()
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	if requestError != nil {
+		a.setCustomError(ctx, requestError)
+		return
+	}
+
+	conn, err := a.pgsPool.AcquireConnection(context.Background())
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	defer conn.Release()
+
+	jwtToken, ok := ctx.UserValue(JwtContext).(jwt.Claims)
+	if !ok {
+		a.set500(ctx, errors.New("access token error"))
+		return
+	}
+
+	myRole, ok := models.ToRole(jwtToken.Rol)
+	if !ok {
+		a.setCustomError(ctx, models.InvalidMyRoleError)
+		return
+	}
+
+	tx, err := conn.Begin(context.Background())
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	defer func() { _ = tx.Rollback(context.Background()) }()
+
+	// Row of user is locked, so concurrent changes of the same ban are checked against policy one by one
+	user, err := storages.NewUserStorage(tx).GetByIdForUpdate(userId)
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	if user == nil {
+		a.setCustomError(ctx, models.WrongUserIdError)
+		return
+	}
+
+	if !myRole.IsHigher(user.Role) {
+		a.setCustomError(ctx, models.NoPermissionToBanUserError)
+		return
+	}
+
+	bans := storages.NewBanStorage(tx)
+
+	activeBan, err := bans.GetActive(userId)
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	if activeBan == nil {
+		a.setCustomError(ctx, models.NoActiveBanError)
+		return
+	}
+
+	reason, until := activeBan.Reason, activeBan.Until
+	if request.Reason != "" {
+		reason = request.Reason
+	}
+	if request.Until != 0 || request.Permanent {
+		until = banUntil(request.Until, request.Permanent)
+	}
+
+	requestError = checkBanPolicy(myRole, activeBan, until)
+	if requestError != nil {
+		a.setCustomError(ctx, requestError)
+		return
+	}
+
+	ban, err := bans.CreateAndStore(userId, reason, until, jwtToken.Sub, banIssuerRole(myRole, activeBan))
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+
+	err = a.audit(ctx, tx, userId, models.AuditActionEditBan, auditBan(activeBan), auditBan(ban))
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+
+	err = tx.Commit(context.Background())
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+
+	err = storages.NewBanCacheStorage(a.rdsClient0.Client()).Store(*ban)
+	if err != nil {
+		a.set500(ctx, err)
+	}
+}
+
+func (a *Application) unban(ctx *fasthttp.RequestCtx) {
+	userIdFromRequest, _ := ctx.UserValue("id").(string)
+	userId, err := strconv.ParseInt(userIdFromRequest, 10, 64)
+	if err != nil {
+		a.set400(ctx)
+		return
+	}
+
+	conn, err := a.pgsPool.AcquireConnection(context.Background())
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	defer conn.Release()
+
+	jwtToken, ok := ctx.UserValue(JwtContext).(jwt.Claims)
+	if !ok {
+		a.set500(ctx, errors.New("access token error"))
+		return
+	}
+
+	myRole, ok := models.ToRole(jwtToken.Rol)
+	if !ok {
+		a.setCustomError(ctx, models.InvalidMyRoleError)
+		return
+	}
+
+	tx, err := conn.Begin(context.Background())
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	defer func() { _ = tx.Rollback(context.Background()) }()
+
+	// Row of user is locked, so concurrent changes of the same ban are checked against policy one by one
+	user, err := storages.NewUserStorage(tx).GetByIdForUpdate(userId)
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	if user == nil {
+		a.setCustomError(ctx, models.WrongUserIdError)
+		return
+	}
+
+	if !myRole.IsHigher(user.Role) {
+		a.setCustomError(ctx, models.NoPermissionToUnbanUserError)
+		return
+	}
+
+	bans := storages.NewBanStorage(tx)
+
+	activeBan, err := bans.GetActive(userId)
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+
+	// Lifting is the weakest possible ban: it ends right now
+	now := time.Now()
+	requestError := checkBanPolicy(myRole, activeBan, &now)
+	if requestError != nil {
+		a.setCustomError(ctx, requestError)
+		return
+	}
+
+	lifted, err := bans.Lift(userId, jwtToken.Sub)
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+
+	if lifted {
+		err = a.audit(ctx, tx, userId, models.AuditActionUnban, auditBan(activeBan), nil)
+		if err != nil {
+			a.set500(ctx, err)
+			return
+		}
+	}
+
+	err = tx.Commit(context.Background())
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+
+	err = storages.NewBanCacheStorage(a.rdsClient0.Client()).Delete(userId)
+	if err != nil {
+		a.set500(ctx, err)
+	}
+}
+
+func (a *Application) changeRole(ctx *fasthttp.RequestCtx) {
+	userIdFromRequest, _ := ctx.UserValue("id").(string)
+	userId, err := strconv.ParseInt(userIdFromRequest, 10, 64)
+	if err != nil {
+		a.set400(ctx)
+		return
+	}
+
+	var request changeRoleRequest
+	err = json.Unmarshal(ctx.Request.Body(), &request)
+	if err != nil {
+		a.set400(ctx)
+		return
+	}
+
+	requestError, err := request.Validate()
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	if requestError != nil {
+		a.setCustomError(ctx, requestError)
+		return
+	}
+
+	conn, err := a.pgsPool.AcquireConnection(context.Background())
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	defer conn.Release()
+
+	users := storages.NewUserStorage(conn)
+
+	user, err := users.GetById(userId)
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	if user == nil {
+		a.setCustomError(ctx, models.WrongUserIdError)
+		return
+	}
+
+	jwtToken, ok := ctx.UserValue(JwtContext).(jwt.Claims)
+	if !ok {
+		a.set500(ctx, errors.New("access token error"))
+		return
+	}
+
+	myRole, ok := models.ToRole(jwtToken.Rol)
+	if !ok {
+		a.setCustomError(ctx, models.InvalidMyRoleError)
+		return
+	}
+
+	requestRole, ok := models.ToRole(request.Role)
+	if !ok {
 		a.setCustomError(ctx, models.InvalidRoleError)
 		return
 	}
@@ -472,8 +1810,45 @@ func (a *Application) changeRole(ctx *fasthttp.RequestCtx) {
 		return
 	}
 
-	err = users.ChangeRole(userId, request.Role)
+	// Role is changed along with audit record, so one is never done without another
+	tx, err := conn.Begin(context.Background())
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	defer func() { _ = tx.Rollback(context.Background()) }()
+
+	err = storages.NewUserStorage(tx).ChangeRole(userId, request.Role)
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+
+	err = a.audit(ctx, tx, userId, models.AuditActionChangeRole, auditRole(user.Role), auditRole(requestRole))
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+
+	err = tx.Commit(context.Background())
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+
+	err = a.invalidateAccessTokens(userId)
 	if err != nil {
 		a.set500(ctx, err)
 	}
 }
+
+func (a *Application) reloadKeys(ctx *fasthttp.RequestCtx) {
+	err := a.reloadJwtKeys()
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+
+	_ = json.NewEncoder(ctx).Encode(a.jwtKeys.JWKS())
+	ctx.SetContentType("application/json")
+}
@@ -0,0 +1,270 @@
+package app
+
+import (
+	"auth/internal/models"
+	"auth/internal/storages"
+	"auth/pkg/oidc"
+	"auth/pkg/utils"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/valyala/fasthttp"
+	"strings"
+)
+
+func (a *Application) externalLoginBegin(ctx *fasthttp.RequestCtx) {
+	providerName, _ := ctx.UserValue("provider").(string)
+	provider, ok := a.identityProviders[providerName]
+	if !ok {
+		a.setCustomError(ctx, models.UnknownIdentityProviderError)
+		return
+	}
+
+	state, err := utils.SecureString(ExternalLoginStateLength, RefreshTokenAlphabet)
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+
+	session := models.ExternalLoginSession{
+		Provider: provider.Name(),
+	}
+
+	session.Nonce, err = utils.SecureString(ExternalLoginNonceLength, RefreshTokenAlphabet)
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+
+	session.CodeVerifier, err = utils.SecureString(ExternalLoginCodeVerifierLength, RefreshTokenAlphabet)
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+
+	redirectTo, err := provider.AuthCodeURL(state, session.Nonce, session.CodeVerifier)
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+
+	err = storages.NewExternalLoginSessionStorage(a.rdsClient0.Client()).CreateAndStore(state, session, ExternalLoginLifetime)
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+
+	_ = json.NewEncoder(ctx).Encode(externalLoginResponse{
+		RedirectTo: redirectTo,
+		State:      state,
+	})
+	ctx.SetContentType("application/json")
+}
+
+// externalLoginFinish exchanges authorization code of external provider and signs user in. Unknown identities are
+// linked to account with the same verified email only if provider is trusted to assert it, account is created if
+// there is no such one
+func (a *Application) externalLoginFinish(ctx *fasthttp.RequestCtx) {
+	providerName, _ := ctx.UserValue("provider").(string)
+	provider, ok := a.identityProviders[providerName]
+	if !ok {
+		a.setCustomError(ctx, models.UnknownIdentityProviderError)
+		return
+	}
+
+	var request externalLoginCallbackRequest
+	err := json.Unmarshal(ctx.Request.Body(), &request)
+	if err != nil {
+		a.set400(ctx)
+		return
+	}
+
+	requestError, err := request.Validate()
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	if requestError != nil {
+		a.setCustomError(ctx, requestError)
+		return
+	}
+
+	session, err := storages.NewExternalLoginSessionStorage(a.rdsClient0.Client()).Consume(request.State)
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	if session == nil || session.Provider != provider.Name() {
+		a.setCustomError(ctx, models.WrongExternalLoginStateError)
+		return
+	}
+
+	identity, err := provider.Exchange(request.Code, session.CodeVerifier, session.Nonce)
+	if err != nil {
+		if errors.Is(err, oidc.ErrInvalidIdToken) || errors.Is(err, oidc.ErrNonceMismatch) {
+			a.logSecurityEvent(fmt.Sprintf("invalid ID token received from identity provider %s: %v", provider.Name(), err))
+		}
+		if errors.Is(err, oidc.ErrTokenExchange) || errors.Is(err, oidc.ErrInvalidIdToken) || errors.Is(err, oidc.ErrNonceMismatch) {
+			a.setCustomError(ctx, models.ExternalLoginFailedError)
+			return
+		}
+
+		a.set500(ctx, err)
+		return
+	}
+
+	conn, err := a.pgsPool.AcquireConnection(context.Background())
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	defer conn.Release()
+
+	identities := storages.NewIdentityStorage(conn)
+
+	linked, err := identities.Get(provider.Name(), identity.Subject)
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+
+	var userId int64
+	if linked != nil {
+		userId = linked.UserId
+	} else {
+		email := strings.ToLower(identity.Email)
+		if !identity.EmailVerified || email == "" {
+			a.setCustomError(ctx, models.UnverifiedExternalEmailError)
+			return
+		}
+		if !(validEmail(email) && len(email) >= 10 && len(email) <= EmailMaxLength) {
+			a.setCustomError(ctx, models.InvalidEmailError)
+			return
+		}
+
+		users := storages.NewUserStorage(conn)
+
+		user, err := users.GetByEmail(email)
+		if err != nil {
+			a.set500(ctx, err)
+			return
+		}
+		if user == nil {
+			login, err := a.externalLogin(users, identity, email)
+			if err != nil {
+				a.set500(ctx, err)
+				return
+			}
+
+			// Password is unknown to anyone, it can be set later with password reset
+			password, err := utils.SecureString(ExternalLoginPasswordLength, RefreshTokenAlphabet)
+			if err != nil {
+				a.set500(ctx, err)
+				return
+			}
+
+			err = users.CreateAndStore(email, login, password)
+			if err != nil {
+				a.set500(ctx, err)
+				return
+			}
+
+			user, err = users.GetByEmail(email)
+			if err != nil {
+				a.set500(ctx, err)
+				return
+			}
+			if user == nil {
+				a.set500(ctx, errors.New("created user not found"))
+				return
+			}
+		} else {
+			// Otherwise anyone who controls identity with this email at provider would take over account
+			if !provider.TrustsEmail() {
+				a.setCustomError(ctx, models.ExternalEmailTakenError)
+				return
+			}
+
+			a.logSecurityEvent(fmt.Sprintf("identity %s of provider %s linked to existing user #%d by email",
+				identity.Subject, provider.Name(), user.Id))
+		}
+
+		created, err := identities.CreateAndStore(provider.Name(), identity.Subject, user.Id, email)
+		if err != nil {
+			a.set500(ctx, err)
+			return
+		}
+		if !created {
+			// Concurrent callback has already linked identity, possibly to another account
+			linked, err = identities.Get(provider.Name(), identity.Subject)
+			if err != nil {
+				a.set500(ctx, err)
+				return
+			}
+			if linked == nil {
+				a.set500(ctx, errors.New("linked identity not found"))
+				return
+			}
+			user.Id = linked.UserId
+		}
+
+		userId = user.Id
+	}
+
+	challenged, err := a.challengeSecondFactor(ctx, conn, userId)
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	if challenged {
+		return
+	}
+
+	a.completeLogin(ctx, conn, userId)
+}
+
+// externalLogin derives free login for provisioned account from preferred username or email of identity.
+// Random digits are appended if derived login is taken
+func (a *Application) externalLogin(users models.UserStorage, identity *oidc.Identity, email string) (string, error) {
+	source := identity.PreferredUsername
+	if source == "" {
+		source, _, _ = strings.Cut(email, "@")
+	}
+
+	var base strings.Builder
+	for _, r := range strings.ToLower(source) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9' && base.Len() > 0) {
+			base.WriteRune(r)
+		}
+	}
+
+	login := base.String()
+	if len(login) > MaxExternalLoginLength-ExternalLoginSuffixLength {
+		login = login[:MaxExternalLoginLength-ExternalLoginSuffixLength]
+	}
+	if len(login) < MinExternalLoginLength {
+		login = "user" + login
+	}
+
+	candidate := login
+	for i := 0; i < ExternalLoginAttempts; i++ {
+		if validLogin(candidate) {
+			exists, err := users.LoginExists(candidate)
+			if err != nil {
+				return "", err
+			}
+			if !exists {
+				return candidate, nil
+			}
+		}
+
+		suffix, err := utils.SecureString(ExternalLoginSuffixLength, ExternalLoginSuffixAlphabet)
+		if err != nil {
+			return "", err
+		}
+		candidate = login + suffix
+	}
+
+	return "", errors.New("unable to find free login")
+}
@@ -0,0 +1,65 @@
+package app
+
+import (
+	"auth/pkg/mailer"
+)
+
+type (
+	codeMailData struct {
+		Code     string
+		Lifetime int
+	}
+
+	emailChangedMailData struct {
+		Email string
+	}
+)
+
+var (
+	verificationCodeMail = mailer.MustTemplate(
+		"Verification code: {{.Code}}",
+		`Hello!
+
+Your verification code is {{.Code}}. It is valid for {{.Lifetime}} minutes.
+
+If you did not request this code, just ignore this email.`)
+
+	passwordResetMail = mailer.MustTemplate(
+		"Password reset code: {{.Code}}",
+		`Hello!
+
+Your password reset code is {{.Code}}. It is valid for {{.Lifetime}} minutes.
+
+If you did not request password reset, just ignore this email. Your password will not be changed.`)
+
+	emailChangedMail = mailer.MustTemplate(
+		"Email was changed",
+		`Hello!
+
+Email of your account was changed to {{.Email}}. This address will no longer receive any emails.
+
+If you did not do it, change your password immediately and contact support.`)
+)
+
+func (a *Application) sendMail(to string, tmpl *mailer.Template, data interface{}) error {
+	message, err := tmpl.Render(to, data)
+	if err != nil {
+		return err
+	}
+
+	return a.mailer.Send(message)
+}
+
+// sendMailInBackground sends mail off request path, so response time does not depend on mail server.
+// Errors are only logged
+func (a *Application) sendMailInBackground(to string, tmpl *mailer.Template, data interface{}) {
+	a.mails.Add(1)
+	go func() {
+		defer a.mails.Done()
+
+		err := a.sendMail(to, tmpl, data)
+		if err != nil {
+			a.logError(err)
+		}
+	}()
+}
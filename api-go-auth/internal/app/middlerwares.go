@@ -5,6 +5,7 @@ import (
 	"auth/internal/storages"
 	"auth/pkg/jwt"
 	"auth/pkg/logging"
+	"auth/pkg/ratelimit"
 	"auth/pkg/utils"
 	"github.com/valyala/fasthttp"
 	"log"
@@ -13,12 +14,29 @@ import (
 )
 
 const (
-	JwtContext = "JWT_CONTEXT"
+	JwtContext              = "JWT_CONTEXT"
+	RequestIdContext        = "REQUEST_ID_CONTEXT"
+	HideRequestBodyContext  = "HIDE_REQUEST_BODY_CONTEXT"
+	HideResponseBodyContext = "HIDE_RESPONSE_BODY_CONTEXT"
+	RequestIdHeader         = "X-Request-Id"
 )
 
+// logMiddleware writes request and response to log. Every request gets an id that is returned in RequestIdHeader,
+// so log records and audit log can be matched. Bodies marked by hideRequestBody and hideResponseBody and credentials
+// of Authorization header are not written
 func (a *Application) logMiddleware(handler fasthttp.RequestHandler) fasthttp.RequestHandler {
 	return func(ctx *fasthttp.RequestCtx) {
+		requestId, err := utils.SecureString(RequestIdLength, RefreshTokenAlphabet)
+		if err != nil {
+			a.set500(ctx, err)
+			return
+		}
+
+		ctx.SetUserValue(RequestIdContext, requestId)
+		ctx.Response.Header.Set(RequestIdHeader, requestId)
+
 		req := logging.Request{
+			Id:        requestId,
 			Timestamp: time.Now().Unix(),
 			Method:    utils.BytesToString(ctx.Request.Header.Method()),
 			Path:      utils.BytesToString(ctx.Path()),
@@ -26,6 +44,14 @@ func (a *Application) logMiddleware(handler fasthttp.RequestHandler) fasthttp.Re
 			Body:      utils.BytesToString(ctx.Request.Body()),
 		}
 		req.Headers = strings.Split(strings.Trim(ctx.Request.Header.String(), "\r\n"), "\r\n")[1:]
+		for i, header := range req.Headers {
+			// Authorization carries access tokens and client credentials, so only its scheme is written
+			name, value, _ := strings.Cut(header, ": ")
+			if strings.EqualFold(name, fasthttp.HeaderAuthorization) {
+				scheme, _, _ := strings.Cut(value, " ")
+				req.Headers[i] = name + ": " + scheme + " [REDACTED]"
+			}
+		}
 
 		t1 := time.Now()
 		handler(ctx)
@@ -39,30 +65,97 @@ func (a *Application) logMiddleware(handler fasthttp.RequestHandler) fasthttp.Re
 			ExecutionTime: t2.Sub(t1).Milliseconds(),
 		}
 		res.Headers = strings.Split(strings.Trim(ctx.Response.Header.String(), "\r\n"), "\r\n")[1:]
+		if hide, _ := ctx.UserValue(HideRequestBodyContext).(bool); hide {
+			req.Body = ""
+		}
+		if hide, _ := ctx.UserValue(HideResponseBodyContext).(bool); hide {
+			res.Body = ""
+		}
 
-		err := a.logger.WriteServerRequest(req, res)
+		err = a.logger.WriteServerRequest(req, res)
 		if err != nil {
 			log.Printf("LOG ERROR: %v\n", err)
 		}
 	}
 }
 
+// hideRequestBody keeps request body out of log. It is used for requests that contain passwords, codes or tokens
+func (a *Application) hideRequestBody(handler fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		ctx.SetUserValue(HideRequestBodyContext, true)
+		handler(ctx)
+	}
+}
+
+// hideResponseBody keeps response body out of log. It is used for responses that contain secrets
+func (a *Application) hideResponseBody(handler fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		ctx.SetUserValue(HideResponseBodyContext, true)
+		handler(ctx)
+	}
+}
+
+// parseAccessToken extracts and validates bearer token from Authorization header and checks it is neither revoked
+// nor issued before last privilege change of its owner
+func (a *Application) parseAccessToken(ctx *fasthttp.RequestCtx) (jwt.Claims, *models.Error, error) {
+	authorization := string(ctx.Request.Header.Peek("Authorization"))
+	_, bearerToken, ok := strings.Cut(authorization, "Bearer ")
+	if !ok {
+		return jwt.Claims{}, models.MissingAccessTokenError, nil
+	}
+
+	return a.validateAccessToken(bearerToken)
+}
+
+// validateAccessToken validates access token and checks it is neither revoked nor outdated
+func (a *Application) validateAccessToken(accessToken string) (jwt.Claims, *models.Error, error) {
+	_, claims, err := jwt.Parse(accessToken, a.jwtKeys, a.config.AccessToken)
+	if err != nil {
+		return jwt.Claims{}, convertJwtError(err), nil
+	}
+
+	if claims.Jti == "" {
+		return jwt.Claims{}, models.AccessTokenRevokedError, nil
+	}
+
+	revoked, err := storages.NewAccessTokenStorage(a.rdsClient0.Client()).IsRevoked(claims.Jti)
+	if err != nil {
+		return jwt.Claims{}, nil, err
+	}
+	if revoked {
+		return jwt.Claims{}, models.AccessTokenRevokedError, nil
+	}
+
+	version, err := storages.NewTokenVersionStorage(a.rdsClient0.Client()).Get(claims.Sub)
+	if err != nil {
+		return jwt.Claims{}, nil, err
+	}
+	if claims.Ver != version {
+		return jwt.Claims{}, models.AccessTokenOutdatedError, nil
+	}
+
+	return claims, nil, nil
+}
+
+// authorize accepts access tokens issued by login. Bans are checked in cache only, since access tokens are short-lived
+// and issuing new ones checks ban storage
 func (a *Application) authorize(handler fasthttp.RequestHandler) fasthttp.RequestHandler {
 	return func(ctx *fasthttp.RequestCtx) {
-		authorization := string(ctx.Request.Header.Peek("Authorization"))
-		_, bearerToken, ok := strings.Cut(authorization, "Bearer ")
-		if !ok {
-			a.set401(ctx)
+		claims, tokenError, err := a.parseAccessToken(ctx)
+		if err != nil {
+			a.set500(ctx, err)
 			return
 		}
-
-		_, claims, err := jwt.Parse(bearerToken)
-		if err != nil {
-			a.set401(ctx)
+		if tokenError != nil {
+			a.setCustomError(ctx, tokenError)
+			return
+		}
+		if claims.ClientId != "" {
+			a.setCustomError(ctx, models.InvalidAccessTokenClaimsError)
 			return
 		}
 
-		ban, err := storages.NewBanStorage(a.rdsClient0.Client()).Get(claims.Sub)
+		ban, err := storages.NewBanCacheStorage(a.rdsClient0.Client()).Get(claims.Sub)
 		if err != nil {
 			a.set500(ctx, err)
 			return
@@ -77,19 +170,58 @@ func (a *Application) authorize(handler fasthttp.RequestHandler) fasthttp.Reques
 	}
 }
 
-func (a *Application) authorizeRoles(roles ...models.UserRole) middleware {
+// authorizeScope accepts only access tokens issued to OAuth clients with required scope
+func (a *Application) authorizeScope(scope string) middleware {
 	return func(handler fasthttp.RequestHandler) fasthttp.RequestHandler {
 		return func(ctx *fasthttp.RequestCtx) {
-			authorization := string(ctx.Request.Header.Peek("Authorization"))
-			_, bearerToken, ok := strings.Cut(authorization, "Bearer ")
-			if !ok {
-				a.set401(ctx)
+			claims, tokenError, err := a.parseAccessToken(ctx)
+			if err != nil {
+				a.set500(ctx, err)
+				return
+			}
+			if tokenError != nil {
+				a.setCustomError(ctx, tokenError)
+				return
+			}
+			if claims.ClientId == "" || claims.Sub == 0 {
+				a.setCustomError(ctx, models.InvalidAccessTokenClaimsError)
+				return
+			}
+			if !hasScope(claims.Scope, scope) {
+				a.setCustomError(ctx, models.InsufficientScopeError)
 				return
 			}
 
-			_, claims, err := jwt.Parse(bearerToken)
+			ban, err := storages.NewBanCacheStorage(a.rdsClient0.Client()).Get(claims.Sub)
 			if err != nil {
-				a.set401(ctx)
+				a.set500(ctx, err)
+				return
+			}
+			if ban != nil {
+				a.set403Banned(ctx, ban)
+				return
+			}
+
+			ctx.SetUserValue(JwtContext, claims)
+			handler(ctx)
+		}
+	}
+}
+
+func (a *Application) authorizeRoles(roles ...models.UserRole) middleware {
+	return func(handler fasthttp.RequestHandler) fasthttp.RequestHandler {
+		return func(ctx *fasthttp.RequestCtx) {
+			claims, tokenError, err := a.parseAccessToken(ctx)
+			if err != nil {
+				a.set500(ctx, err)
+				return
+			}
+			if tokenError != nil {
+				a.setCustomError(ctx, tokenError)
+				return
+			}
+			if claims.ClientId != "" {
+				a.setCustomError(ctx, models.InvalidAccessTokenClaimsError)
 				return
 			}
 
@@ -111,7 +243,7 @@ func (a *Application) authorizeRoles(roles ...models.UserRole) middleware {
 				return
 			}
 
-			ban, err := storages.NewBanStorage(a.rdsClient0.Client()).Get(claims.Sub)
+			ban, err := storages.NewBanCacheStorage(a.rdsClient0.Client()).Get(claims.Sub)
 			if err != nil {
 				a.set500(ctx, err)
 				return
@@ -126,3 +258,24 @@ func (a *Application) authorizeRoles(roles ...models.UserRole) middleware {
 		}
 	}
 }
+
+// limitByIp rejects requests from client that exceeded per IP limit. Name separates counters of different routes
+func (a *Application) limitByIp(name string) middleware {
+	limiter := ratelimit.NewLimiter(a.rdsClient0.Client(), name+"_IP", a.config.RateLimits.Ip)
+
+	return func(handler fasthttp.RequestHandler) fasthttp.RequestHandler {
+		return func(ctx *fasthttp.RequestCtx) {
+			ok, retryAfter, err := limiter.Allow(a.clientIp(ctx))
+			if err != nil {
+				a.set500(ctx, err)
+				return
+			}
+			if !ok {
+				a.set429(ctx, models.TooManyRequestsError, retryAfter)
+				return
+			}
+
+			handler(ctx)
+		}
+	}
+}
@@ -0,0 +1,700 @@
+package app
+
+import (
+	"auth/internal/models"
+	"auth/internal/storages"
+	"auth/pkg/jwt"
+	"auth/pkg/utils"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgtype/pgxtype"
+	"github.com/valyala/fasthttp"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+func (a *Application) createOAuthClient(ctx *fasthttp.RequestCtx) {
+	var request createOAuthClientRequest
+	err := json.Unmarshal(ctx.Request.Body(), &request)
+	if err != nil {
+		a.set400(ctx)
+		return
+	}
+
+	requestError, err := request.Validate()
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	if requestError != nil {
+		a.setCustomError(ctx, requestError)
+		return
+	}
+	for _, redirectUri := range request.RedirectUris {
+		if !validRedirectUri(redirectUri, a.config.OAuthNativeSchemes) {
+			a.setCustomError(ctx, models.InvalidRedirectUriError)
+			return
+		}
+	}
+
+	conn, err := a.pgsPool.AcquireConnection(context.Background())
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	defer conn.Release()
+
+	var secret string
+	if request.Confidential {
+		secret, err = utils.SecureString(OAuthClientSecretLength, RefreshTokenAlphabet)
+		if err != nil {
+			a.set500(ctx, err)
+			return
+		}
+	}
+
+	clientId, err := utils.SecureString(OAuthClientIdLength, RefreshTokenAlphabet)
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+
+	client := models.OAuthClient{
+		Id:           clientId,
+		Name:         request.Name,
+		RedirectUris: request.RedirectUris,
+		Scopes:       request.Scopes,
+		GrantTypes:   request.GrantTypes,
+	}
+	if client.RedirectUris == nil {
+		client.RedirectUris = []string{}
+	}
+
+	err = storages.NewOAuthClientStorage(conn, []byte(a.config.OAuthClientSecretKey)).CreateAndStore(client, secret)
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+
+	_ = json.NewEncoder(ctx).Encode(createOAuthClientResponse{
+		ClientId:     client.Id,
+		ClientSecret: secret,
+	})
+	ctx.SetContentType("application/json")
+	ctx.SetStatusCode(fasthttp.StatusCreated)
+}
+
+// oauthAuthorize issues authorization code to client on behalf of current user. Consent must be obtained by caller.
+// Errors related to client or redirect URI are returned directly, others are passed to client through redirect
+func (a *Application) oauthAuthorize(ctx *fasthttp.RequestCtx) {
+	jwtToken, ok := ctx.UserValue(JwtContext).(jwt.Claims)
+	if !ok {
+		a.set500(ctx, errors.New("access token error"))
+		return
+	}
+
+	query := ctx.QueryArgs()
+	clientId := string(query.Peek("client_id"))
+	redirectUri := string(query.Peek("redirect_uri"))
+	state := string(query.Peek("state"))
+
+	conn, err := a.pgsPool.AcquireConnection(context.Background())
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	defer conn.Release()
+
+	client, err := storages.NewOAuthClientStorage(conn, []byte(a.config.OAuthClientSecretKey)).Get(clientId)
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	if client == nil {
+		a.setCustomError(ctx, models.WrongOAuthClientError)
+		return
+	}
+	if !client.AllowsRedirectUri(redirectUri) {
+		a.setCustomError(ctx, models.InvalidRedirectUriError)
+		return
+	}
+
+	params := url.Values{}
+	if state != "" {
+		params.Set("state", state)
+	}
+
+	respond := func() {
+		_ = json.NewEncoder(ctx).Encode(oauthAuthorizeResponse{
+			RedirectTo: appendQuery(redirectUri, params),
+		})
+		ctx.SetContentType("application/json")
+	}
+
+	if string(query.Peek("response_type")) != OAuthResponseTypeCode {
+		params.Set("error", OAuthErrorResponseType)
+		respond()
+		return
+	}
+
+	if !client.AllowsGrant(models.GrantTypeAuthorizationCode) {
+		params.Set("error", OAuthErrorUnauthorized)
+		respond()
+		return
+	}
+
+	scopes := strings.Fields(string(query.Peek("scope")))
+	if len(scopes) == 0 {
+		scopes = client.Scopes
+	}
+	if !client.AllowsScopes(scopes) {
+		params.Set("error", OAuthErrorInvalidScope)
+		respond()
+		return
+	}
+
+	codeChallenge := string(query.Peek("code_challenge"))
+	if string(query.Peek("code_challenge_method")) != OAuthCodeChallengeMethod || !validCodeVerifier(codeChallenge) {
+		params.Set("error", OAuthErrorInvalidRequest)
+		params.Set("error_description", "PKCE with S256 method is required")
+		respond()
+		return
+	}
+
+	code, err := utils.SecureString(OAuthCodeLength, RefreshTokenAlphabet)
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+
+	err = storages.NewOAuthCodeStorage(a.rdsClient0.Client()).CreateAndStore(code, models.OAuthCode{
+		ClientId:      client.Id,
+		UserId:        jwtToken.Sub,
+		RedirectUri:   redirectUri,
+		Scope:         strings.Join(scopes, " "),
+		CodeChallenge: codeChallenge,
+		Nonce:         string(query.Peek("nonce")),
+	}, OAuthCodeLifetime)
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+
+	params.Set("code", code)
+	respond()
+}
+
+func (a *Application) oauthToken(ctx *fasthttp.RequestCtx) {
+	ctx.Response.Header.Set("Cache-Control", OAuthTokenCacheControl)
+	ctx.Response.Header.Set("Pragma", "no-cache")
+
+	args := ctx.PostArgs()
+
+	conn, err := a.pgsPool.AcquireConnection(context.Background())
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	defer conn.Release()
+
+	client := a.authenticateOAuthClient(ctx, conn)
+	if client == nil {
+		return
+	}
+
+	grantType := string(args.Peek("grant_type"))
+	if !utils.ExistsIn(grantTypes, grantType) {
+		a.setOAuthError(ctx, fasthttp.StatusBadRequest, OAuthErrorUnsupportedType, "")
+		return
+	}
+	if !client.AllowsGrant(grantType) {
+		a.setOAuthError(ctx, fasthttp.StatusBadRequest, OAuthErrorUnauthorized, "")
+		return
+	}
+
+	var user *models.User
+	var scope string
+	var nonce string
+	var sessionId string
+	var withRefreshToken bool
+	var response oauthTokenResponse
+
+	switch grantType {
+	case models.GrantTypeAuthorizationCode:
+		code, err := storages.NewOAuthCodeStorage(a.rdsClient0.Client()).Consume(string(args.Peek("code")))
+		if err != nil {
+			a.set500(ctx, err)
+			return
+		}
+		if code == nil || code.ClientId != client.Id || code.RedirectUri != string(args.Peek("redirect_uri")) {
+			a.setOAuthError(ctx, fasthttp.StatusBadRequest, OAuthErrorInvalidGrant, "")
+			return
+		}
+
+		verifier := string(args.Peek("code_verifier"))
+		challenge := sha256.Sum256([]byte(verifier))
+		if !validCodeVerifier(verifier) ||
+			subtle.ConstantTimeCompare([]byte(base64.RawURLEncoding.EncodeToString(challenge[:])), []byte(code.CodeChallenge)) != 1 {
+			a.setOAuthError(ctx, fasthttp.StatusBadRequest, OAuthErrorInvalidGrant, "PKCE verification failed")
+			return
+		}
+
+		user, err = storages.NewUserStorage(conn).GetById(code.UserId)
+		if err != nil {
+			a.set500(ctx, err)
+			return
+		}
+		if user == nil {
+			a.setOAuthError(ctx, fasthttp.StatusBadRequest, OAuthErrorInvalidGrant, "")
+			return
+		}
+
+		scope = code.Scope
+		nonce = code.Nonce
+		withRefreshToken = client.AllowsGrant(models.GrantTypeRefreshToken)
+
+	case models.GrantTypeRefreshToken:
+		refTokens := storages.NewRefreshTokenStorage(conn, []byte(a.config.RefreshTokenKey))
+
+		oldRefreshToken := string(args.Peek("refresh_token"))
+		response.RefreshToken, err = utils.SecureString(RefreshTokenLength, RefreshTokenAlphabet)
+		if err != nil {
+			a.set500(ctx, err)
+			return
+		}
+
+		refreshToken, err := refTokens.Rotate(oldRefreshToken, response.RefreshToken, client.Id, a.clientDevice(ctx), RefreshTokenLifePeriod)
+		if err != nil {
+			a.set500(ctx, err)
+			return
+		}
+		if refreshToken == nil {
+			rotatedToken, err := refTokens.GetRotated(oldRefreshToken)
+			if err != nil {
+				a.set500(ctx, err)
+				return
+			}
+
+			if rotatedToken != nil && rotatedToken.ClientId == client.Id {
+				err = a.revokeSession(refTokens, rotatedToken.SessionId)
+				if err != nil {
+					a.set500(ctx, err)
+					return
+				}
+
+				a.logSecurityEvent(fmt.Sprintf("refresh token reuse detected: user #%d, client %s, session %s has been revoked",
+					rotatedToken.User.Id, client.Id, rotatedToken.SessionId))
+			}
+
+			a.setOAuthError(ctx, fasthttp.StatusBadRequest, OAuthErrorInvalidGrant, "")
+			return
+		}
+
+		user = &refreshToken.User
+		scope = refreshToken.Scope
+		sessionId = refreshToken.SessionId
+
+		// Access token can be requested with narrower scope, refresh token keeps the original one
+		requested := strings.Fields(string(args.Peek("scope")))
+		if len(requested) > 0 {
+			if !(&models.OAuthClient{Scopes: strings.Fields(scope)}).AllowsScopes(requested) {
+				a.setOAuthError(ctx, fasthttp.StatusBadRequest, OAuthErrorInvalidScope, "")
+				return
+			}
+			scope = strings.Join(requested, " ")
+		}
+
+	case models.GrantTypeClientCredentials:
+		if !client.IsConfidential {
+			a.setOAuthError(ctx, fasthttp.StatusBadRequest, OAuthErrorUnauthorized, "")
+			return
+		}
+
+		scopes := strings.Fields(string(args.Peek("scope")))
+		if len(scopes) == 0 {
+			scopes = client.Scopes
+		}
+		if !client.AllowsScopes(scopes) {
+			a.setOAuthError(ctx, fasthttp.StatusBadRequest, OAuthErrorInvalidScope, "")
+			return
+		}
+
+		scope = strings.Join(scopes, " ")
+	}
+
+	var userId int64
+	var role models.UserRole
+	if user != nil {
+		ban, err := a.getActiveBan(conn, user.Id)
+		if err != nil {
+			a.set500(ctx, err)
+			return
+		}
+		if ban != nil {
+			a.setOAuthError(ctx, fasthttp.StatusBadRequest, OAuthErrorInvalidGrant, "user is banned")
+			return
+		}
+
+		userId, role = user.Id, user.Role
+	}
+
+	// Refresh token starts session, so it is issued first for access token to refer to that session
+	if withRefreshToken {
+		response.RefreshToken, sessionId, err = a.issueRefreshToken(ctx, conn, userId, client.Id, scope)
+		if err != nil {
+			a.set500(ctx, err)
+			return
+		}
+	}
+
+	accessToken, claims, err := a.createClientAccessToken(userId, role, sessionId, client.Id, scope)
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+
+	if user != nil && hasScope(scope, OidcScopeOpenId) {
+		response.IdToken, err = a.createIdToken(user, client.Id, scope, nonce)
+		if err != nil {
+			a.set500(ctx, err)
+			return
+		}
+	}
+
+	response.AccessToken = accessToken
+	response.TokenType = OAuthTokenType
+	response.ExpiresIn = claims.Exp - claims.Iat
+	response.Scope = scope
+
+	_ = json.NewEncoder(ctx).Encode(response)
+	ctx.SetContentType("application/json")
+}
+
+// oauthIntrospect reports state of access or refresh token to confidential client. Access tokens issued to anyone
+// can be introspected, refresh tokens only by client they were issued to
+func (a *Application) oauthIntrospect(ctx *fasthttp.RequestCtx) {
+	ctx.Response.Header.Set("Cache-Control", OAuthTokenCacheControl)
+
+	args := ctx.PostArgs()
+	token := string(args.Peek("token"))
+	if token == "" {
+		a.setOAuthError(ctx, fasthttp.StatusBadRequest, OAuthErrorInvalidRequest, "token is required")
+		return
+	}
+
+	conn, err := a.pgsPool.AcquireConnection(context.Background())
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	defer conn.Release()
+
+	client := a.authenticateOAuthClient(ctx, conn)
+	if client == nil {
+		return
+	}
+	if !client.IsConfidential {
+		a.setOAuthError(ctx, fasthttp.StatusUnauthorized, OAuthErrorInvalidClient, "introspection is available for confidential clients only")
+		return
+	}
+
+	var response introspectionResponse
+	if string(args.Peek("token_type_hint")) == TokenTypeRefreshToken {
+		response, err = a.introspectRefreshToken(conn, client, token)
+		if err == nil && !response.Active {
+			response, err = a.introspectAccessToken(conn, token)
+		}
+	} else {
+		response, err = a.introspectAccessToken(conn, token)
+		if err == nil && !response.Active {
+			response, err = a.introspectRefreshToken(conn, client, token)
+		}
+	}
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+
+	_ = json.NewEncoder(ctx).Encode(response)
+	ctx.SetContentType("application/json")
+}
+
+func (a *Application) introspectAccessToken(q pgxtype.Querier, token string) (introspectionResponse, error) {
+	claims, tokenError, err := a.validateAccessToken(token)
+	if err != nil || tokenError != nil {
+		return introspectionResponse{}, err
+	}
+
+	if claims.Sub != 0 {
+		ban, err := a.getActiveBan(q, claims.Sub)
+		if err != nil || ban != nil {
+			return introspectionResponse{}, err
+		}
+	}
+
+	return introspectionResponse{
+		Active:    true,
+		TokenType: TokenTypeAccessToken,
+		Scope:     claims.Scope,
+		ClientId:  claims.ClientId,
+		Sub:       strconv.FormatInt(claims.Sub, 10),
+		Rol:       claims.Rol,
+		Aud:       claims.Aud,
+		Iss:       claims.Iss,
+		Exp:       claims.Exp,
+		Iat:       claims.Iat,
+		Nbf:       claims.Nbf,
+		Jti:       claims.Jti,
+	}, nil
+}
+
+func (a *Application) introspectRefreshToken(q pgxtype.Querier, client *models.OAuthClient, token string) (introspectionResponse, error) {
+	refreshToken, err := storages.NewRefreshTokenStorage(q, []byte(a.config.RefreshTokenKey)).Find(token, RefreshTokenLifePeriod)
+	if err != nil || refreshToken == nil || refreshToken.ClientId != client.Id {
+		return introspectionResponse{}, err
+	}
+
+	ban, err := a.getActiveBan(q, refreshToken.User.Id)
+	if err != nil || ban != nil {
+		return introspectionResponse{}, err
+	}
+
+	return introspectionResponse{
+		Active:    true,
+		TokenType: TokenTypeRefreshToken,
+		Scope:     refreshToken.Scope,
+		ClientId:  refreshToken.ClientId,
+		Username:  refreshToken.User.Login,
+		Sub:       strconv.FormatInt(refreshToken.User.Id, 10),
+		Rol:       string(refreshToken.User.Role),
+		Iss:       a.config.AccessToken.Issuer,
+		Exp:       refreshToken.LastUsedAt.Add(RefreshTokenLifePeriod).Unix(),
+		Iat:       refreshToken.IssuedAt.Unix(),
+	}, nil
+}
+
+// oauthRevoke revokes token issued to client as described in RFC 7009. Refresh token is revoked with whole session.
+// Invalid and expired tokens are ignored
+func (a *Application) oauthRevoke(ctx *fasthttp.RequestCtx) {
+	args := ctx.PostArgs()
+	token := string(args.Peek("token"))
+	if token == "" {
+		a.setOAuthError(ctx, fasthttp.StatusBadRequest, OAuthErrorInvalidRequest, "token is required")
+		return
+	}
+
+	conn, err := a.pgsPool.AcquireConnection(context.Background())
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	defer conn.Release()
+
+	client := a.authenticateOAuthClient(ctx, conn)
+	if client == nil {
+		return
+	}
+
+	// Token type is detected by format, so hint is not needed: access tokens are JWT, refresh tokens are hex strings
+	if strings.Count(token, ".") == 2 {
+		claims, tokenError, err := a.validateAccessToken(token)
+		if err != nil {
+			a.set500(ctx, err)
+			return
+		}
+		if tokenError != nil {
+			return
+		}
+		if claims.ClientId != client.Id {
+			a.setOAuthError(ctx, fasthttp.StatusBadRequest, OAuthErrorUnauthorized, "token was issued to another client")
+			return
+		}
+
+		err = storages.NewAccessTokenStorage(a.rdsClient0.Client()).Revoke(claims.Jti, claims.Exp)
+		if err != nil {
+			a.set500(ctx, err)
+		}
+		return
+	}
+
+	refTokens := storages.NewRefreshTokenStorage(conn, []byte(a.config.RefreshTokenKey))
+
+	refreshToken, err := refTokens.Find(token, RefreshTokenLifePeriod)
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	if refreshToken == nil {
+		return
+	}
+	if refreshToken.ClientId != client.Id {
+		a.setOAuthError(ctx, fasthttp.StatusBadRequest, OAuthErrorUnauthorized, "token was issued to another client")
+		return
+	}
+
+	err = a.revokeSession(refTokens, refreshToken.SessionId)
+	if err != nil {
+		a.set500(ctx, err)
+	}
+}
+
+func (a *Application) openidConfiguration(ctx *fasthttp.RequestCtx) {
+	issuer := strings.TrimSuffix(a.config.AccessToken.Issuer, "/")
+
+	_ = json.NewEncoder(ctx).Encode(openidConfiguration{
+		Issuer:                            a.config.AccessToken.Issuer,
+		AuthorizationEndpoint:             issuer + V1 + "/oauth/authorize",
+		TokenEndpoint:                     issuer + V1 + "/oauth/token",
+		UserinfoEndpoint:                  issuer + V1 + "/userinfo",
+		JwksUri:                           issuer + V1 + "/.well-known/jwks.json",
+		IntrospectionEndpoint:             issuer + V1 + "/introspect",
+		RevocationEndpoint:                issuer + V1 + "/revoke",
+		ScopesSupported:                   []string{OidcScopeOpenId, OidcScopeProfile, OidcScopeEmail},
+		ResponseTypesSupported:            []string{OAuthResponseTypeCode},
+		GrantTypesSupported:               grantTypes,
+		SubjectTypesSupported:             []string{"public"},
+		IdTokenSigningAlgValuesSupported:  []string{a.jwtKeys.Signing().Alg()},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{OAuthCodeChallengeMethod},
+		ClaimsSupported:                   []string{"iss", "sub", "aud", "exp", "iat", "nonce", "email", "email_verified", "preferred_username"},
+	})
+	ctx.Response.Header.Set("Cache-Control", JwksCacheControl)
+	ctx.SetContentType("application/json")
+}
+
+func (a *Application) userInfo(ctx *fasthttp.RequestCtx) {
+	jwtToken, ok := ctx.UserValue(JwtContext).(jwt.Claims)
+	if !ok {
+		a.set500(ctx, errors.New("access token error"))
+		return
+	}
+
+	conn, err := a.pgsPool.AcquireConnection(context.Background())
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	defer conn.Release()
+
+	user, err := storages.NewUserStorage(conn).GetById(jwtToken.Sub)
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	if user == nil {
+		a.setCustomError(ctx, models.InvalidAccessTokenClaimsError)
+		return
+	}
+
+	response := userInfoResponse{
+		Sub: strconv.FormatInt(user.Id, 10),
+	}
+	if hasScope(jwtToken.Scope, OidcScopeEmail) {
+		response.Email = user.Email
+		response.EmailVerified = true
+	}
+	if hasScope(jwtToken.Scope, OidcScopeProfile) {
+		response.PreferredUsername = user.Login
+	}
+
+	_ = json.NewEncoder(ctx).Encode(response)
+	ctx.Response.Header.Set("Cache-Control", OAuthTokenCacheControl)
+	ctx.SetContentType("application/json")
+}
+
+// createIdToken creates OpenID Connect ID token for client. Claims are disclosed according to granted scope,
+// email is always verified because it is confirmed during registration
+func (a *Application) createIdToken(user *models.User, clientId, scope, nonce string) (string, error) {
+	claims := jwt.NewIdClaims(user.Id, clientId)
+	claims.Iss = a.config.AccessToken.Issuer
+	claims.Nonce = nonce
+
+	if hasScope(scope, OidcScopeEmail) {
+		claims.Email = user.Email
+		claims.EmailVerified = true
+	}
+	if hasScope(scope, OidcScopeProfile) {
+		claims.PreferredUsername = user.Login
+	}
+
+	return jwt.CreateIdToken(a.jwtKeys, claims)
+}
+
+// authenticateOAuthClient authenticates client of token endpoints. Nil is returned if error response is written
+func (a *Application) authenticateOAuthClient(ctx *fasthttp.RequestCtx, q pgxtype.Querier) *models.OAuthClient {
+	clientId, clientSecret, ok := oauthClientCredentials(ctx)
+	if !ok {
+		a.setOAuthError(ctx, fasthttp.StatusBadRequest, OAuthErrorInvalidRequest, "malformed client credentials")
+		return nil
+	}
+
+	client, err := storages.NewOAuthClientStorage(q, []byte(a.config.OAuthClientSecretKey)).Authenticate(clientId, clientSecret)
+	if err != nil {
+		a.set500(ctx, err)
+		return nil
+	}
+	if client == nil {
+		a.setOAuthError(ctx, fasthttp.StatusUnauthorized, OAuthErrorInvalidClient, "")
+		return nil
+	}
+
+	return client
+}
+
+// oauthClientCredentials extracts client credentials from HTTP Basic authorization or from request body.
+// Using both methods at once is not allowed
+func oauthClientCredentials(ctx *fasthttp.RequestCtx) (string, string, bool) {
+	args := ctx.PostArgs()
+	bodyId, bodySecret := string(args.Peek("client_id")), string(args.Peek("client_secret"))
+
+	authorization := string(ctx.Request.Header.Peek("Authorization"))
+	if !strings.HasPrefix(authorization, "Basic ") {
+		return bodyId, bodySecret, bodyId != ""
+	}
+	if bodySecret != "" {
+		return "", "", false
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(authorization, "Basic "))
+	if err != nil {
+		return "", "", false
+	}
+
+	id, secret, ok := strings.Cut(string(decoded), ":")
+	if !ok {
+		return "", "", false
+	}
+
+	id, err = url.QueryUnescape(id)
+	if err != nil {
+		return "", "", false
+	}
+	secret, err = url.QueryUnescape(secret)
+	if err != nil {
+		return "", "", false
+	}
+
+	if bodyId != "" && bodyId != id {
+		return "", "", false
+	}
+
+	return id, secret, id != ""
+}
+
+func appendQuery(uri string, params url.Values) string {
+	separator := "?"
+	if strings.Contains(uri, "?") {
+		separator = "&"
+	}
+	return uri + separator + params.Encode()
+}
+
+func hasScope(scope, required string) bool {
+	return utils.ExistsIn(strings.Fields(scope), required)
+}
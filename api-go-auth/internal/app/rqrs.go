@@ -2,15 +2,25 @@ package app
 
 import (
 	"auth/internal/models"
+	"auth/pkg/jwt"
+	"auth/pkg/totp"
+	"auth/pkg/utils"
+	"auth/pkg/webauthn"
+	"encoding/json"
+	"net"
+	"net/url"
 	"regexp"
 	"time"
 )
 
 const (
-	VerificationCodeLength   = 8
-	VerificationCodeLifetime = 5 * time.Minute
-	EmailMaxLength           = 64
-	EmailRegexp              = "^[a-z][a-z\\d-_.]{2,}@[a-z][a-z\\d-]+\\.[a-z][a-z\\d]+$"
+	VerificationCodeLength         = 8
+	VerificationCodeLifetime       = 5 * time.Minute
+	VerificationCodeMaxAttempts    = 5
+	VerificationCodeResendCooldown = time.Minute
+	PasswordResetCodeLifetime      = 15 * time.Minute
+	EmailMaxLength                 = 64
+	EmailRegexp                    = "^[a-z][a-z\\d-_.]{2,}@[a-z][a-z\\d-]+\\.[a-z][a-z\\d]+$"
 
 	LoginRegexp    = "^[a-z][a-z\\d]{4,32}$"
 	PasswordRegexp = "^[\\w!@#$%^&*\\-+=]{8,32}$"
@@ -23,9 +33,77 @@ const (
 	RefreshTokenAlphabet   = `1234567890abcdef`
 	RefreshTokenLifePeriod = 24 * time.Hour
 
+	SessionIdLength    = 32
+	MaxUserAgentLength = 256
+	MaxIpLength        = 64
+
+	MfaTokenLength       = 64
+	MfaTokenLifetime     = 5 * time.Minute
+	RecoveryCodesCount   = 10
+	RecoveryCodeLength   = 10
+	RecoveryCodeAlphabet = `abcdefghijkmnpqrstuvwxyz23456789`
+
+	WebauthnSessionIdLength = 64
+	WebauthnCeremonyTimeout = 5 * time.Minute
+
+	OAuthClientIdLength      = 32
+	OAuthClientSecretLength  = 64
+	OAuthCodeLength          = 64
+	OAuthCodeLifetime        = time.Minute
+	OAuthResponseTypeCode    = "code"
+	OAuthCodeChallengeMethod = "S256"
+	OAuthCodeVerifierRegexp  = `^[A-Za-z\d\-._~]{43,128}$`
+	OAuthScopeRegexp         = `^[\x21\x23-\x5b\x5d-\x7e]{1,64}$`
+	OAuthTokenType           = "Bearer"
+	MinOAuthClientNameLength = 3
+	MaxOAuthClientNameLength = 64
+	MaxOAuthClientListLength = 16
+	OAuthTokenCacheControl   = "no-store"
+
+	TokenTypeAccessToken  = "access_token"
+	TokenTypeRefreshToken = "refresh_token"
+
+	ExternalLoginStateLength        = 64
+	ExternalLoginNonceLength        = 32
+	ExternalLoginCodeVerifierLength = 64
+	ExternalLoginLifetime           = 10 * time.Minute
+	ExternalLoginPasswordLength     = 32
+	ExternalLoginAttempts           = 5
+	ExternalLoginSuffixLength       = 6
+	ExternalLoginSuffixAlphabet     = `1234567890`
+	MinExternalLoginLength          = 5
+	MaxExternalLoginLength          = 32
+	IdentityProviderNameRegexp      = `^[a-z][a-z\d\-]{0,31}$`
+
+	OidcScopeOpenId   = "openid"
+	OidcScopeProfile  = "profile"
+	OidcScopeEmail    = "email"
+	OidcDiscoveryPath = "/.well-known/openid-configuration"
+
+	OAuthErrorInvalidRequest  = "invalid_request"
+	OAuthErrorInvalidClient   = "invalid_client"
+	OAuthErrorInvalidGrant    = "invalid_grant"
+	OAuthErrorUnauthorized    = "unauthorized_client"
+	OAuthErrorUnsupportedType = "unsupported_grant_type"
+	OAuthErrorInvalidScope    = "invalid_scope"
+	OAuthErrorResponseType    = "unsupported_response_type"
+
+	DefaultUsersPageLimit     = 20
+	MaxUsersPageLimit         = 100
+	MaxUserSearchPrefixLength = EmailMaxLength
+	UsersOrderAsc             = "asc"
+	UsersOrderDesc            = "desc"
+
 	MinBanReasonLength = 3
 	MaxBanReasonLength = 256
 	MinBanDuration     = 5 * time.Minute
+
+	RequestIdLength = 32
+
+	DefaultAuditPageLimit = 50
+	MaxAuditPageLimit     = 200
+
+	JwksCacheControl = "public, max-age=300"
 )
 
 type (
@@ -40,44 +118,283 @@ type (
 		Password string `json:"password"`
 	}
 
+	forgotPasswordRequest struct {
+		Email string `json:"email"`
+	}
+
+	resetPasswordRequest struct {
+		Email    string `json:"email"`
+		Code     string `json:"code"`
+		Password string `json:"password"`
+	}
+
 	loginRequest struct {
 		Login    string `json:"login"`
 		Password string `json:"password"`
 	}
 
+	loginMfaRequest struct {
+		MfaToken string `json:"mfaToken"`
+		Code     string `json:"code"`
+	}
+
+	totpCodeRequest struct {
+		Code string `json:"code"`
+	}
+
+	webauthnRegisterFinishRequest struct {
+		SessionId  string                       `json:"sessionId"`
+		Credential webauthn.AttestationResponse `json:"credential"`
+	}
+
+	webauthnLoginFinishRequest struct {
+		SessionId  string                     `json:"sessionId"`
+		Credential webauthn.AssertionResponse `json:"credential"`
+	}
+
+	createOAuthClientRequest struct {
+		Name         string   `json:"name"`
+		RedirectUris []string `json:"redirectUris"`
+		Scopes       []string `json:"scopes"`
+		GrantTypes   []string `json:"grantTypes"`
+		Confidential bool     `json:"confidential"`
+	}
+
+	externalLoginCallbackRequest struct {
+		Code  string `json:"code"`
+		State string `json:"state"`
+	}
+
 	refreshRequest struct {
 		RefreshToken string `json:"refreshToken"`
 	}
 
+	// banRequest bans user until given unix time. Until should be omitted for permanent ban
 	banRequest struct {
-		Reason string `json:"reason"`
-		Until  int64  `json:"until"`
+		Reason    string `json:"reason"`
+		Until     int64  `json:"until"`
+		Permanent bool   `json:"permanent"`
+	}
+
+	// editBanRequest changes active ban. Omitted fields are kept as they are
+	editBanRequest struct {
+		Reason    string `json:"reason"`
+		Until     int64  `json:"until"`
+		Permanent bool   `json:"permanent"`
 	}
 
 	changeRoleRequest struct {
 		Role string `json:"role"`
 	}
 
+	changePasswordRequest struct {
+		OldPassword         string `json:"oldPassword"`
+		NewPassword         string `json:"newPassword"`
+		RevokeOtherSessions bool   `json:"revokeOtherSessions"`
+		RefreshToken        string `json:"refreshToken"`
+	}
+
+	changeEmailRequest struct {
+		Email string `json:"email"`
+	}
+
+	confirmEmailRequest struct {
+		Email string `json:"email"`
+		Code  string `json:"code"`
+	}
+
 	testResponse struct {
 		Status bool
 	}
 
 	loginResponse struct {
-		RefreshToken string `json:"refreshToken"`
+		RefreshToken string `json:"refreshToken,omitempty"`
+		MfaRequired  bool   `json:"mfaRequired,omitempty"`
+		MfaToken     string `json:"mfaToken,omitempty"`
 	}
 
-	refreshResponse struct {
+	enrollTotpResponse struct {
+		Secret string `json:"secret"`
+		Uri    string `json:"uri"`
+	}
+
+	webauthnRegisterBeginResponse struct {
+		SessionId string                   `json:"sessionId"`
+		PublicKey webauthn.CreationOptions `json:"publicKey"`
+	}
+
+	webauthnLoginBeginResponse struct {
+		SessionId string                  `json:"sessionId"`
+		PublicKey webauthn.RequestOptions `json:"publicKey"`
+	}
+
+	// sessionResponse describes login session. Current is set for session that access token of request belongs to
+	sessionResponse struct {
+		Id         string `json:"id"`
+		ClientId   string `json:"clientId,omitempty"`
+		UserAgent  string `json:"userAgent"`
+		Ip         string `json:"ip"`
+		IssuedAt   int64  `json:"issuedAt"`
+		LastUsedAt int64  `json:"lastUsedAt"`
+		Current    bool   `json:"current"`
+	}
+
+	userResponse struct {
+		Id        int64  `json:"id"`
+		Email     string `json:"email"`
+		Login     string `json:"login"`
+		Role      string `json:"role"`
+		CreatedAt int64  `json:"createdAt"`
+		Banned    bool   `json:"banned"`
+	}
+
+	// usersResponse is a page of users. NextCursor is empty if there are no more users
+	usersResponse struct {
+		Users      []userResponse `json:"users"`
+		NextCursor string         `json:"nextCursor,omitempty"`
+	}
+
+	// banResponse is a record of ban history. Lifted fields are set only if ban was lifted before it expired
+	banResponse struct {
+		Id             int64  `json:"id"`
+		ByUserId       int64  `json:"byUserId"`
+		IssuerRole     string `json:"issuerRole"`
+		Reason         string `json:"reason"`
+		At             int64  `json:"at"`
+		Until          int64  `json:"until,omitempty"`
+		Permanent      bool   `json:"permanent"`
+		LiftedByUserId int64  `json:"liftedByUserId,omitempty"`
+		LiftedAt       int64  `json:"liftedAt,omitempty"`
+	}
+
+	userProfileResponse struct {
+		userResponse
+		Ban *banResponse `json:"ban,omitempty"`
+	}
+
+	// auditRoleValue is a role of user in audit log
+	auditRoleValue struct {
+		Role string `json:"role"`
+	}
+
+	auditRecordResponse struct {
+		Id        int64           `json:"id"`
+		ActorId   int64           `json:"actorId"`
+		ActorRole string          `json:"actorRole"`
+		TargetId  int64           `json:"targetId,omitempty"`
+		Action    string          `json:"action"`
+		OldValue  json.RawMessage `json:"oldValue,omitempty"`
+		NewValue  json.RawMessage `json:"newValue,omitempty"`
+		Ip        string          `json:"ip"`
+		RequestId string          `json:"requestId"`
+		CreatedAt int64           `json:"createdAt"`
+	}
+
+	// auditResponse is a page of audit log. NextCursor is empty if there are no more records
+	auditResponse struct {
+		Records    []auditRecordResponse `json:"records"`
+		NextCursor string                `json:"nextCursor,omitempty"`
+	}
+
+	externalLoginResponse struct {
+		RedirectTo string `json:"redirectTo"`
+		State      string `json:"state"`
+	}
+
+	createOAuthClientResponse struct {
+		ClientId     string `json:"clientId"`
+		ClientSecret string `json:"clientSecret,omitempty"`
+	}
+
+	oauthAuthorizeResponse struct {
+		RedirectTo string `json:"redirectTo"`
+	}
+
+	oauthTokenResponse struct {
+		AccessToken  string `json:"access_token"`
+		TokenType    string `json:"token_type"`
+		ExpiresIn    int64  `json:"expires_in"`
+		RefreshToken string `json:"refresh_token,omitempty"`
+		Scope        string `json:"scope,omitempty"`
+		IdToken      string `json:"id_token,omitempty"`
+	}
+
+	// introspectionResponse is described in RFC 7662. Only active field is present for inactive tokens
+	introspectionResponse struct {
+		Active    bool         `json:"active"`
+		TokenType string       `json:"token_type,omitempty"`
+		Scope     string       `json:"scope,omitempty"`
+		ClientId  string       `json:"client_id,omitempty"`
+		Username  string       `json:"username,omitempty"`
+		Sub       string       `json:"sub,omitempty"`
+		Rol       string       `json:"rol,omitempty"`
+		Aud       jwt.Audience `json:"aud,omitempty"`
+		Iss       string       `json:"iss,omitempty"`
+		Exp       int64        `json:"exp,omitempty"`
+		Iat       int64        `json:"iat,omitempty"`
+		Nbf       int64        `json:"nbf,omitempty"`
+		Jti       string       `json:"jti,omitempty"`
+	}
+
+	oauthError struct {
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description,omitempty"`
+	}
+
+	openidConfiguration struct {
+		Issuer                            string   `json:"issuer"`
+		AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+		TokenEndpoint                     string   `json:"token_endpoint"`
+		UserinfoEndpoint                  string   `json:"userinfo_endpoint"`
+		JwksUri                           string   `json:"jwks_uri"`
+		IntrospectionEndpoint             string   `json:"introspection_endpoint"`
+		RevocationEndpoint                string   `json:"revocation_endpoint"`
+		ScopesSupported                   []string `json:"scopes_supported"`
+		ResponseTypesSupported            []string `json:"response_types_supported"`
+		GrantTypesSupported               []string `json:"grant_types_supported"`
+		SubjectTypesSupported             []string `json:"subject_types_supported"`
+		IdTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+		TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+		CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+		ClaimsSupported                   []string `json:"claims_supported"`
+	}
+
+	userInfoResponse struct {
+		Sub               string `json:"sub"`
+		Email             string `json:"email,omitempty"`
+		EmailVerified     bool   `json:"email_verified,omitempty"`
+		PreferredUsername string `json:"preferred_username,omitempty"`
+	}
+
+	confirmTotpResponse struct {
+		RecoveryCodes []string `json:"recoveryCodes"`
+	}
+
+	changePasswordResponse struct {
 		AccessToken string `json:"accessToken"`
 		ExpiresAt   int64  `json:"expiresAt"`
 		IssuedAt    int64  `json:"issuedAt"`
 	}
+
+	refreshResponse struct {
+		RefreshToken string `json:"refreshToken"`
+		AccessToken  string `json:"accessToken"`
+		ExpiresAt    int64  `json:"expiresAt"`
+		IssuedAt     int64  `json:"issuedAt"`
+	}
 )
 
 var (
-	validLogin    = regexp.MustCompile(LoginRegexp).MatchString
-	validPassword = regexp.MustCompile(PasswordRegexp).MatchString
-	validEmail    = regexp.MustCompile(EmailRegexp).MatchString
-	revokeTypes   = []string{RefreshTokenRevokeTypeAll, RefreshTokenRevokeTypeCurrent, RefreshTokenRevokeTypeAllExceptCurrent}
+	validLogin                = regexp.MustCompile(LoginRegexp).MatchString
+	validPassword             = regexp.MustCompile(PasswordRegexp).MatchString
+	validEmail                = regexp.MustCompile(EmailRegexp).MatchString
+	validScope                = regexp.MustCompile(OAuthScopeRegexp).MatchString
+	validCodeVerifier         = regexp.MustCompile(OAuthCodeVerifierRegexp).MatchString
+	validIdentityProviderName = regexp.MustCompile(IdentityProviderNameRegexp).MatchString
+	grantTypes                = []string{models.GrantTypeAuthorizationCode, models.GrantTypeRefreshToken, models.GrantTypeClientCredentials}
+	revokeTypes               = []string{RefreshTokenRevokeTypeAll, RefreshTokenRevokeTypeCurrent, RefreshTokenRevokeTypeAllExceptCurrent}
+	auditActions              = []string{models.AuditActionBan, models.AuditActionEditBan, models.AuditActionUnban, models.AuditActionChangeRole}
+	userSortFields            = []string{string(models.UserSortById), string(models.UserSortByLogin), string(models.UserSortByCreatedAt)}
 )
 
 func (r *checkEmailRequest) Validate() (*models.Error, error) {
@@ -108,6 +425,30 @@ func (r *registerRequest) Validate() (*models.Error, error) {
 	return nil, nil
 }
 
+func (r *forgotPasswordRequest) Validate() (*models.Error, error) {
+	if !(validEmail(r.Email) && len(r.Email) >= 10 && len(r.Email) <= EmailMaxLength) {
+		return models.InvalidEmailError, nil
+	}
+
+	return nil, nil
+}
+
+func (r *resetPasswordRequest) Validate() (*models.Error, error) {
+	if !(validEmail(r.Email) && len(r.Email) >= 10 && len(r.Email) <= EmailMaxLength) {
+		return models.InvalidEmailError, nil
+	}
+
+	if len(r.Code) != VerificationCodeLength {
+		return models.InvalidCodeError, nil
+	}
+
+	if !validPassword(r.Password) {
+		return models.InvalidPasswordError, nil
+	}
+
+	return nil, nil
+}
+
 func (r *loginRequest) Validate() (*models.Error, error) {
 	if !validLogin(r.Login) {
 		return models.WrongCredentialsError, nil
@@ -120,6 +461,42 @@ func (r *loginRequest) Validate() (*models.Error, error) {
 	return nil, nil
 }
 
+func (r *loginMfaRequest) Validate() (*models.Error, error) {
+	if len(r.MfaToken) != MfaTokenLength {
+		return models.WrongMfaTokenError, nil
+	}
+
+	if len(r.Code) != totp.DefaultDigits && len(r.Code) != RecoveryCodeLength {
+		return models.WrongMfaCodeError, nil
+	}
+
+	return nil, nil
+}
+
+func (r *totpCodeRequest) Validate() (*models.Error, error) {
+	if len(r.Code) != totp.DefaultDigits && len(r.Code) != RecoveryCodeLength {
+		return models.WrongMfaCodeError, nil
+	}
+
+	return nil, nil
+}
+
+func (r *webauthnRegisterFinishRequest) Validate() (*models.Error, error) {
+	if len(r.SessionId) != WebauthnSessionIdLength {
+		return models.WrongWebauthnSessionError, nil
+	}
+
+	return nil, nil
+}
+
+func (r *webauthnLoginFinishRequest) Validate() (*models.Error, error) {
+	if len(r.SessionId) != WebauthnSessionIdLength {
+		return models.WrongWebauthnSessionError, nil
+	}
+
+	return nil, nil
+}
+
 func (r *refreshRequest) Validate() (*models.Error, error) {
 	if len(r.RefreshToken) != RefreshTokenLength {
 		return models.WrongRefreshTokenError, nil
@@ -134,14 +511,50 @@ func (r *banRequest) Validate() (*models.Error, error) {
 		return models.InvalidBanReasonError, nil
 	}
 
-	t, tn := time.Unix(r.Until, 0), time.Now()
-	if !(tn.Before(t) && t.Sub(tn) >= MinBanDuration) {
+	if !validBanTime(r.Until, r.Permanent) {
 		return models.InvalidBanTimeError, nil
 	}
 
 	return nil, nil
 }
 
+func (r *editBanRequest) Validate() (*models.Error, error) {
+	if r.Reason == "" && r.Until == 0 && !r.Permanent {
+		return models.EmptyBanChangeError, nil
+	}
+
+	runes := []rune(r.Reason)
+	if r.Reason != "" && !(len(runes) >= MinBanReasonLength && len(runes) <= MaxBanReasonLength) {
+		return models.InvalidBanReasonError, nil
+	}
+
+	if (r.Until != 0 || r.Permanent) && !validBanTime(r.Until, r.Permanent) {
+		return models.InvalidBanTimeError, nil
+	}
+
+	return nil, nil
+}
+
+// validBanTime checks that ban is either permanent or lasts at least MinBanDuration
+func validBanTime(until int64, permanent bool) bool {
+	if permanent {
+		return until == 0
+	}
+
+	t, tn := time.Unix(until, 0), time.Now()
+	return tn.Before(t) && t.Sub(tn) >= MinBanDuration
+}
+
+// banUntil converts validated ban time to ban end. Nil is returned for permanent ban
+func banUntil(until int64, permanent bool) *time.Time {
+	if permanent {
+		return nil
+	}
+
+	t := time.Unix(until, 0)
+	return &t
+}
+
 func (r *changeRoleRequest) Validate() (*models.Error, error) {
 	_, ok := models.ToRole(r.Role)
 	if !ok {
@@ -149,3 +562,111 @@ func (r *changeRoleRequest) Validate() (*models.Error, error) {
 	}
 	return nil, nil
 }
+
+func (r *changePasswordRequest) Validate() (*models.Error, error) {
+	if !validPassword(r.OldPassword) {
+		return models.WrongPasswordError, nil
+	}
+
+	if !validPassword(r.NewPassword) {
+		return models.InvalidPasswordError, nil
+	}
+
+	if r.RevokeOtherSessions && len(r.RefreshToken) != RefreshTokenLength {
+		return models.WrongRefreshTokenError, nil
+	}
+
+	return nil, nil
+}
+
+func (r *changeEmailRequest) Validate() (*models.Error, error) {
+	if !(validEmail(r.Email) && len(r.Email) >= 10 && len(r.Email) <= EmailMaxLength) {
+		return models.InvalidEmailError, nil
+	}
+
+	return nil, nil
+}
+
+func (r *confirmEmailRequest) Validate() (*models.Error, error) {
+	if !(validEmail(r.Email) && len(r.Email) >= 10 && len(r.Email) <= EmailMaxLength) {
+		return models.InvalidEmailError, nil
+	}
+
+	if len(r.Code) != VerificationCodeLength {
+		return models.InvalidCodeError, nil
+	}
+
+	return nil, nil
+}
+
+func (r *createOAuthClientRequest) Validate() (*models.Error, error) {
+	runes := []rune(r.Name)
+	if !(len(runes) >= MinOAuthClientNameLength && len(runes) <= MaxOAuthClientNameLength) {
+		return models.InvalidOAuthClientNameError, nil
+	}
+
+	if len(r.GrantTypes) == 0 || len(r.GrantTypes) > len(grantTypes) {
+		return models.InvalidGrantTypeError, nil
+	}
+	for _, grantType := range r.GrantTypes {
+		if !utils.ExistsIn(grantTypes, grantType) {
+			return models.InvalidGrantTypeError, nil
+		}
+	}
+	if utils.ExistsIn(r.GrantTypes, models.GrantTypeClientCredentials) && !r.Confidential {
+		return models.InvalidGrantTypeError, nil
+	}
+
+	if len(r.Scopes) == 0 || len(r.Scopes) > MaxOAuthClientListLength {
+		return models.InvalidScopeError, nil
+	}
+	for _, scope := range r.Scopes {
+		if !validScope(scope) {
+			return models.InvalidScopeError, nil
+		}
+	}
+
+	if len(r.RedirectUris) > MaxOAuthClientListLength {
+		return models.InvalidRedirectUriError, nil
+	}
+	if utils.ExistsIn(r.GrantTypes, models.GrantTypeAuthorizationCode) && len(r.RedirectUris) == 0 {
+		return models.InvalidRedirectUriError, nil
+	}
+
+	return nil, nil
+}
+
+// validRedirectUri allows https URIs, http URIs of loopback interface and URIs with private-use schemes of native
+// apps from nativeSchemes. Anything else could deliver authorization code to unintended handler
+func validRedirectUri(redirectUri string, nativeSchemes []string) bool {
+	u, err := url.Parse(redirectUri)
+	if err != nil || !u.IsAbs() || u.Fragment != "" {
+		return false
+	}
+
+	switch u.Scheme {
+	case "https":
+		return u.Host != ""
+	case "http":
+		host := u.Hostname()
+		if host == "localhost" {
+			return true
+		}
+		ip := net.ParseIP(host)
+		return ip != nil && ip.IsLoopback()
+	default:
+		return utils.ExistsIn(nativeSchemes, u.Scheme)
+	}
+}
+
+func (r *externalLoginCallbackRequest) Validate() (*models.Error, error) {
+	if len(r.State) != ExternalLoginStateLength {
+		return models.WrongExternalLoginStateError, nil
+	}
+
+	if r.Code == "" {
+		return models.ExternalLoginFailedError, nil
+	}
+
+	return nil, nil
+}
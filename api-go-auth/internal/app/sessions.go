@@ -0,0 +1,82 @@
+package app
+
+import (
+	"auth/internal/models"
+	"auth/internal/storages"
+	"auth/pkg/jwt"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/valyala/fasthttp"
+)
+
+// getSessions lists active login sessions of user. Each session is a chain of refresh tokens started by single login
+func (a *Application) getSessions(ctx *fasthttp.RequestCtx) {
+	claims, ok := ctx.UserValue(JwtContext).(jwt.Claims)
+	if !ok {
+		a.set500(ctx, errors.New("access token error"))
+		return
+	}
+
+	conn, err := a.pgsPool.AcquireConnection(context.Background())
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	defer conn.Release()
+
+	sessions, err := storages.NewRefreshTokenStorage(conn, []byte(a.config.RefreshTokenKey)).GetSessions(claims.Sub, RefreshTokenLifePeriod)
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+
+	response := make([]sessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		response = append(response, sessionResponse{
+			Id:         session.Id,
+			ClientId:   session.ClientId,
+			UserAgent:  session.UserAgent,
+			Ip:         session.Ip,
+			IssuedAt:   session.StartedAt.Unix(),
+			LastUsedAt: session.LastUsedAt.Unix(),
+			Current:    session.Id == claims.Sid,
+		})
+	}
+
+	_ = json.NewEncoder(ctx).Encode(response)
+	ctx.SetContentType("application/json")
+}
+
+// deleteSession signs user out on another device: refresh tokens of session and access tokens issued with them are revoked
+func (a *Application) deleteSession(ctx *fasthttp.RequestCtx) {
+	sessionId, _ := ctx.UserValue("id").(string)
+
+	claims, ok := ctx.UserValue(JwtContext).(jwt.Claims)
+	if !ok {
+		a.set500(ctx, errors.New("access token error"))
+		return
+	}
+
+	conn, err := a.pgsPool.AcquireConnection(context.Background())
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	defer conn.Release()
+
+	revoked, err := storages.NewRefreshTokenStorage(conn, []byte(a.config.RefreshTokenKey)).RevokeUserSession(claims.Sub, sessionId)
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	if !revoked {
+		a.setCustomError(ctx, models.WrongSessionIdError)
+		return
+	}
+
+	err = storages.NewAccessTokenStorage(a.rdsClient0.Client()).RevokeAllBySessionId(sessionId)
+	if err != nil {
+		a.set500(ctx, err)
+	}
+}
@@ -0,0 +1,270 @@
+package app
+
+import (
+	"auth/internal/models"
+	"auth/internal/storages"
+	"auth/pkg/utils"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/valyala/fasthttp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// getUsers searches users for administration. Page size is limited, next page is requested with cursor of previous one
+func (a *Application) getUsers(ctx *fasthttp.RequestCtx) {
+	query, requestError := parseUsersQuery(ctx.QueryArgs())
+	if requestError != nil {
+		a.setCustomError(ctx, requestError)
+		return
+	}
+
+	conn, err := a.pgsPool.AcquireConnection(context.Background())
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	defer conn.Release()
+
+	// One more user is requested to find out whether next page exists
+	limit := query.Limit
+	query.Limit++
+
+	users, err := storages.NewUserStorage(conn).Search(query)
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+
+	response := usersResponse{
+		Users: make([]userResponse, 0, limit),
+	}
+	for i, user := range users {
+		if i == limit {
+			response.NextCursor = encodeUserCursor(users[i-1].User)
+			break
+		}
+		response.Users = append(response.Users, newUserResponse(user.User, user.IsBanned))
+	}
+
+	_ = json.NewEncoder(ctx).Encode(response)
+	ctx.SetContentType("application/json")
+}
+
+// getUser returns profile of user along with current ban. Password hash is never exposed
+func (a *Application) getUser(ctx *fasthttp.RequestCtx) {
+	userIdFromRequest, _ := ctx.UserValue("id").(string)
+	userId, err := strconv.ParseInt(userIdFromRequest, 10, 64)
+	if err != nil {
+		a.set400(ctx)
+		return
+	}
+
+	conn, err := a.pgsPool.AcquireConnection(context.Background())
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	defer conn.Release()
+
+	user, err := storages.NewUserStorage(conn).GetById(userId)
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	if user == nil {
+		a.setCustomError(ctx, models.WrongUserIdError)
+		return
+	}
+
+	ban, err := storages.NewBanStorage(conn).GetActive(userId)
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+
+	response := userProfileResponse{
+		userResponse: newUserResponse(*user, ban != nil),
+	}
+	if ban != nil {
+		banResponse := newBanResponse(*ban)
+		response.Ban = &banResponse
+	}
+
+	_ = json.NewEncoder(ctx).Encode(response)
+	ctx.SetContentType("application/json")
+}
+
+// getUserBans returns ban history of user including expired and lifted bans
+func (a *Application) getUserBans(ctx *fasthttp.RequestCtx) {
+	userIdFromRequest, _ := ctx.UserValue("id").(string)
+	userId, err := strconv.ParseInt(userIdFromRequest, 10, 64)
+	if err != nil {
+		a.set400(ctx)
+		return
+	}
+
+	conn, err := a.pgsPool.AcquireConnection(context.Background())
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	defer conn.Release()
+
+	user, err := storages.NewUserStorage(conn).GetById(userId)
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	if user == nil {
+		a.setCustomError(ctx, models.WrongUserIdError)
+		return
+	}
+
+	bans, err := storages.NewBanStorage(conn).GetByUserId(userId)
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+
+	response := make([]banResponse, 0, len(bans))
+	for _, ban := range bans {
+		response = append(response, newBanResponse(ban))
+	}
+
+	_ = json.NewEncoder(ctx).Encode(response)
+	ctx.SetContentType("application/json")
+}
+
+// parseUsersQuery builds users search from query string
+func parseUsersQuery(args *fasthttp.Args) (models.UserQuery, *models.Error) {
+	query := models.UserQuery{
+		LoginPrefix: strings.ToLower(string(args.Peek("login"))),
+		EmailPrefix: strings.ToLower(string(args.Peek("email"))),
+		SortBy:      models.UserSortById,
+		Limit:       DefaultUsersPageLimit,
+	}
+	if len(query.LoginPrefix) > MaxUserSearchPrefixLength || len(query.EmailPrefix) > MaxUserSearchPrefixLength {
+		return query, models.InvalidUsersQueryError
+	}
+
+	if args.Has("role") {
+		role, ok := models.ToRole(string(args.Peek("role")))
+		if !ok {
+			return query, models.InvalidRoleError
+		}
+		query.Role = role
+	}
+
+	if args.Has("banned") {
+		banned, err := strconv.ParseBool(string(args.Peek("banned")))
+		if err != nil {
+			return query, models.InvalidUsersQueryError
+		}
+		query.Banned = &banned
+	}
+
+	for name, value := range map[string]*time.Time{"createdFrom": &query.CreatedFrom, "createdBefore": &query.CreatedBefore} {
+		if !args.Has(name) {
+			continue
+		}
+		unix, err := strconv.ParseInt(string(args.Peek(name)), 10, 64)
+		if err != nil || unix < 0 {
+			return query, models.InvalidUsersQueryError
+		}
+		*value = time.Unix(unix, 0).UTC()
+	}
+
+	if args.Has("sort") {
+		sortBy := string(args.Peek("sort"))
+		if !utils.ExistsIn(userSortFields, sortBy) {
+			return query, models.InvalidUsersQueryError
+		}
+		query.SortBy = models.UserSortField(sortBy)
+	}
+
+	switch string(args.Peek("order")) {
+	case "", UsersOrderAsc:
+	case UsersOrderDesc:
+		query.Descending = true
+	default:
+		return query, models.InvalidUsersQueryError
+	}
+
+	if args.Has("limit") {
+		limit, err := strconv.Atoi(string(args.Peek("limit")))
+		if err != nil || limit < 1 || limit > MaxUsersPageLimit {
+			return query, models.InvalidUsersQueryError
+		}
+		query.Limit = limit
+	}
+
+	if args.Has("cursor") {
+		cursor, ok := decodeUserCursor(string(args.Peek("cursor")))
+		if !ok ||
+			(query.SortBy == models.UserSortByLogin && cursor.Login == "") ||
+			(query.SortBy == models.UserSortByCreatedAt && cursor.CreatedAt.IsZero()) {
+			return query, models.InvalidPageCursorError
+		}
+		query.After = cursor
+	}
+
+	return query, nil
+}
+
+// encodeUserCursor makes opaque cursor pointing to user. It is valid for any sorting
+func encodeUserCursor(user models.User) string {
+	raw, _ := json.Marshal(models.UserCursor{
+		Id:        user.Id,
+		Login:     user.Login,
+		CreatedAt: user.CreatedAt,
+	})
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeUserCursor(cursor string) (*models.UserCursor, bool) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, false
+	}
+
+	var userCursor models.UserCursor
+	err = json.Unmarshal(raw, &userCursor)
+	if err != nil || userCursor.Id <= 0 {
+		return nil, false
+	}
+
+	return &userCursor, true
+}
+
+func newBanResponse(ban models.Ban) banResponse {
+	response := banResponse{
+		Id:             ban.Id,
+		ByUserId:       ban.ByUserId,
+		IssuerRole:     string(ban.IssuerRole),
+		Reason:         ban.Reason,
+		At:             ban.At.Unix(),
+		Permanent:      ban.IsPermanent(),
+		LiftedByUserId: ban.LiftedByUserId,
+	}
+	if ban.Until != nil {
+		response.Until = ban.Until.Unix()
+	}
+	if ban.LiftedAt != nil {
+		response.LiftedAt = ban.LiftedAt.Unix()
+	}
+	return response
+}
+
+func newUserResponse(user models.User, banned bool) userResponse {
+	return userResponse{
+		Id:        user.Id,
+		Email:     user.Email,
+		Login:     user.Login,
+		Role:      string(user.Role),
+		CreatedAt: user.CreatedAt.Unix(),
+		Banned:    banned,
+	}
+}
@@ -2,7 +2,20 @@ package app
 
 import (
 	"auth/internal/models"
+	"auth/internal/storages"
+	"auth/pkg/jwt"
+	"auth/pkg/totp"
+	"auth/pkg/utils"
+	"auth/pkg/webauthn"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgtype/pgxtype"
 	"github.com/valyala/fasthttp"
+	"net"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type (
@@ -27,20 +40,29 @@ func convertError(serviceError *models.Error) appError {
 
 	var statusCode int
 	switch serviceError.InnerCode {
-	case models.WrongCredentials, models.WrongRefreshToken:
+	case models.WrongCredentials, models.WrongRefreshToken,
+		models.MissingAccessToken, models.MalformedAccessToken, models.InvalidAccessTokenSignature,
+		models.AccessTokenExpired, models.AccessTokenNotYetValid, models.InvalidAccessTokenClaims,
+		models.AccessTokenRevoked, models.AccessTokenOutdated, models.WrongMfaToken, models.ExternalLoginFailed:
 
 		statusCode = fasthttp.StatusUnauthorized
 
 	case models.AccountIsBanned, models.InvalidMyRole,
 		models.NoPermissionToBanUser, models.NoPermissionToUnbanUser,
-		models.NoPermissionsToSetThisRole, models.NoPermissionToChangeUserRole:
+		models.NoPermissionsToSetThisRole, models.NoPermissionToChangeUserRole, models.WrongPassword,
+		models.WrongMfaCode, models.InsufficientScope, models.UnverifiedExternalEmail, models.ExternalEmailTaken,
+		models.NoPermissionToWeakenBan:
 
 		statusCode = fasthttp.StatusForbidden
 
-	case models.WrongUserId:
+	case models.WrongUserId, models.UnknownIdentityProvider, models.WrongSessionId, models.NoActiveBan:
 
 		statusCode = fasthttp.StatusNotFound
 
+	case models.TooManyRequests, models.AccountTemporarilyLocked, models.CodeResendCooldown:
+
+		statusCode = fasthttp.StatusTooManyRequests
+
 	default:
 		statusCode = fasthttp.StatusBadRequest
 	}
@@ -50,6 +72,22 @@ func convertError(serviceError *models.Error) appError {
 	return e
 }
 
+func convertJwtError(err error) *models.Error {
+	switch {
+	case errors.Is(err, jwt.ErrExpired):
+		return models.AccessTokenExpiredError
+	case errors.Is(err, jwt.ErrNotYetValid), errors.Is(err, jwt.ErrInvalidIssueTime):
+		return models.AccessTokenNotYetValidError
+	case errors.Is(err, jwt.ErrInvalidSignature), errors.Is(err, jwt.ErrUnexpectedAlgorithm),
+		errors.Is(err, jwt.ErrUnknownKey):
+		return models.InvalidAccessTokenSignatureError
+	case errors.Is(err, jwt.ErrInvalidIssuer), errors.Is(err, jwt.ErrInvalidAudience):
+		return models.InvalidAccessTokenClaimsError
+	default:
+		return models.MalformedAccessTokenError
+	}
+}
+
 func withMiddlewares(h fasthttp.RequestHandler, mds ...middleware) fasthttp.RequestHandler {
 	handler := h
 	for i := range mds {
@@ -57,3 +95,239 @@ func withMiddlewares(h fasthttp.RequestHandler, mds ...middleware) fasthttp.Requ
 	}
 	return handler
 }
+
+// createAccessToken issues JWT for user with issuer and audience taken from config and actual token version.
+// Token id is registered, so it can be revoked later along with other user tokens
+func (a *Application) createAccessToken(userId int64, role models.UserRole, sessionId string) (string, jwt.Claims, error) {
+	return a.createClientAccessToken(userId, role, sessionId, "", "")
+}
+
+// createClientAccessToken creates access token issued to OAuth client. Zero userId means token issued to client itself
+func (a *Application) createClientAccessToken(userId int64, role models.UserRole, sessionId, clientId, scope string) (string, jwt.Claims, error) {
+	version, err := storages.NewTokenVersionStorage(a.rdsClient0.Client()).Get(userId)
+	if err != nil {
+		return "", jwt.Claims{}, err
+	}
+
+	claims := jwt.NewClaims(userId, string(role))
+	claims.Ver = version
+	claims.Sid = sessionId
+	claims.ClientId = clientId
+	claims.Scope = scope
+	claims.Iss = a.config.AccessToken.Issuer
+	if a.config.AccessToken.Audience != "" {
+		claims.Aud = jwt.Audience{a.config.AccessToken.Audience}
+	}
+
+	accessToken, err := jwt.Create(a.jwtKeys, claims)
+	if err != nil {
+		return "", jwt.Claims{}, err
+	}
+
+	if userId == 0 {
+		return accessToken, claims, nil
+	}
+
+	err = storages.NewAccessTokenStorage(a.rdsClient0.Client()).Register(userId, sessionId, claims.Jti, claims.Exp)
+	return accessToken, claims, err
+}
+
+// clientIp returns address of client. Header configured as realIpHeader is trusted if it is present in request
+// of one of trusted proxies
+func (a *Application) clientIp(ctx *fasthttp.RequestCtx) string {
+	remoteIp := ctx.RemoteIP()
+	if a.config.RealIpHeader != "" && a.isTrustedProxy(remoteIp) {
+		if ip := ctx.Request.Header.Peek(a.config.RealIpHeader); len(ip) > 0 {
+			return string(ip)
+		}
+	}
+	return remoteIp.String()
+}
+
+func (a *Application) isTrustedProxy(ip net.IP) bool {
+	for _, proxy := range a.trustedProxies {
+		if proxy.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientDevice describes client that made request. Overlong user agent is truncated
+func (a *Application) clientDevice(ctx *fasthttp.RequestCtx) models.Device {
+	userAgent := string(ctx.UserAgent())
+	if len(userAgent) > MaxUserAgentLength {
+		userAgent = strings.ToValidUTF8(userAgent[:MaxUserAgentLength], "")
+	}
+
+	ip := a.clientIp(ctx)
+	if len(ip) > MaxIpLength {
+		ip = ip[:MaxIpLength]
+	}
+
+	return models.Device{
+		UserAgent: userAgent,
+		Ip:        ip,
+	}
+}
+
+// invalidateAccessTokens makes all issued access tokens of user unusable
+func (a *Application) invalidateAccessTokens(userId int64) error {
+	_, err := storages.NewTokenVersionStorage(a.rdsClient0.Client()).Bump(userId)
+	if err != nil {
+		return err
+	}
+
+	return storages.NewAccessTokenStorage(a.rdsClient0.Client()).RevokeAllByUserId(userId, "")
+}
+
+// revokeSession revokes every refresh token of session and access tokens issued with them
+func (a *Application) revokeSession(refTokens models.RefreshTokenStorage, sessionId string) error {
+	err := refTokens.RevokeSession(sessionId)
+	if err != nil {
+		return err
+	}
+
+	return storages.NewAccessTokenStorage(a.rdsClient0.Client()).RevokeAllBySessionId(sessionId)
+}
+
+// checkBanPolicy forbids replacing active ban with one that ends earlier if active ban was issued with higher
+// role than current one. Nil until means permanent ban
+func checkBanPolicy(myRole models.UserRole, activeBan *models.Ban, until *time.Time) *models.Error {
+	if activeBan != nil && activeBan.Outlasts(until) && activeBan.IssuerRole.IsHigher(myRole) {
+		return models.NoPermissionToWeakenBanError
+	}
+	return nil
+}
+
+// banIssuerRole returns role that ban replacing active one is issued with. Rank of active ban is kept,
+// otherwise user with lower role could weaken ban by editing it first
+func banIssuerRole(myRole models.UserRole, activeBan *models.Ban) models.UserRole {
+	if activeBan != nil && activeBan.IssuerRole.IsHigher(myRole) {
+		return activeBan.IssuerRole
+	}
+	return myRole
+}
+
+// getActiveBan returns active ban of user. Storage is checked on cache miss since cache can lose bans,
+// lost ban is restored in cache
+func (a *Application) getActiveBan(q pgxtype.Querier, userId int64) (*models.Ban, error) {
+	banCache := storages.NewBanCacheStorage(a.rdsClient0.Client())
+
+	ban, err := banCache.Get(userId)
+	if err != nil || ban != nil {
+		return ban, err
+	}
+
+	ban, err = storages.NewBanStorage(q).GetActive(userId)
+	if err != nil || ban == nil {
+		return ban, err
+	}
+
+	return ban, banCache.Store(*ban)
+}
+
+// emailChangeCodeIdentifier binds code to both user and new email, so it can not be used by another account
+func emailChangeCodeIdentifier(userId int64, email string) string {
+	return fmt.Sprintf("%d_%s", userId, email)
+}
+
+// completeLogin responds with refresh token to user that passed authentication, unless user is banned.
+// Ban is checked in storage rather than in cache, and cache is restored if it has lost the ban
+func (a *Application) completeLogin(ctx *fasthttp.RequestCtx, q pgxtype.Querier, userId int64) {
+	ban, err := storages.NewBanStorage(q).GetActive(userId)
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+	if ban != nil {
+		err = storages.NewBanCacheStorage(a.rdsClient0.Client()).Store(*ban)
+		if err != nil {
+			a.set500(ctx, err)
+			return
+		}
+
+		a.set403Banned(ctx, ban)
+		return
+	}
+
+	refreshToken, _, err := a.issueRefreshToken(ctx, q, userId, "", "")
+	if err != nil {
+		a.set500(ctx, err)
+		return
+	}
+
+	_ = json.NewEncoder(ctx).Encode(loginResponse{
+		RefreshToken: refreshToken,
+	})
+	ctx.SetContentType("application/json")
+}
+
+// challengeSecondFactor responds with MFA challenge if user has enabled TOTP. True is returned if response is written
+func (a *Application) challengeSecondFactor(ctx *fasthttp.RequestCtx, q pgxtype.Querier, userId int64) (bool, error) {
+	userTotp, err := storages.NewTotpStorage(q, []byte(a.config.TotpKey)).Get(userId)
+	if err != nil {
+		return false, err
+	}
+	if userTotp == nil || !userTotp.IsEnabled {
+		return false, nil
+	}
+
+	mfaToken, err := utils.SecureString(MfaTokenLength, RefreshTokenAlphabet)
+	if err != nil {
+		return false, err
+	}
+
+	err = storages.NewMfaChallengeStorage(a.rdsClient0.Client()).CreateAndStore(mfaToken, userId, MfaTokenLifetime)
+	if err != nil {
+		return false, err
+	}
+
+	_ = json.NewEncoder(ctx).Encode(loginResponse{
+		MfaRequired: true,
+		MfaToken:    mfaToken,
+	})
+	ctx.SetContentType("application/json")
+	return true, nil
+}
+
+// issueRefreshToken creates refresh token that starts new session on device of request.
+// OAuth clients get tokens bound to them and to granted scope. Id of started session is returned along with token
+func (a *Application) issueRefreshToken(ctx *fasthttp.RequestCtx, q pgxtype.Querier, userId int64, clientId, scope string) (string, string, error) {
+	refreshToken, err := utils.SecureString(RefreshTokenLength, RefreshTokenAlphabet)
+	if err != nil {
+		return "", "", err
+	}
+
+	sessionId, err := utils.SecureString(SessionIdLength, RefreshTokenAlphabet)
+	if err != nil {
+		return "", "", err
+	}
+
+	err = storages.NewRefreshTokenStorage(q, []byte(a.config.RefreshTokenKey)).CreateAndStore(userId, sessionId, clientId,
+		scope, refreshToken, a.clientDevice(ctx))
+	if err != nil {
+		return "", "", err
+	}
+
+	return refreshToken, sessionId, nil
+}
+
+// verifySecondFactor accepts either TOTP code or recovery code. Both can be used only once
+func (a *Application) verifySecondFactor(totps models.TotpStorage, userTotp *models.Totp, code string) (bool, error) {
+	if len(code) == RecoveryCodeLength {
+		return totps.UseRecoveryCode(userTotp.UserId, code)
+	}
+
+	ok, step := totp.DefaultParams.Validate(userTotp.Secret, code, time.Now())
+	if !ok {
+		return false, nil
+	}
+
+	return totps.UseStep(userTotp.UserId, step)
+}
+
+// webauthnUserHandle returns user handle that is stored in discoverable credentials
+func webauthnUserHandle(userId int64) string {
+	return webauthn.EncodeId([]byte(strconv.FormatInt(userId, 10)))
+}
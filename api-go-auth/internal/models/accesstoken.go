@@ -0,0 +1,11 @@
+package models
+
+type (
+	AccessTokenStorage interface {
+		Register(userId int64, sessionId, jti string, exp int64) error
+		Revoke(jti string, exp int64) error
+		RevokeAllByUserId(userId int64, exceptJti string) error
+		RevokeAllBySessionId(sessionId string) error
+		IsRevoked(jti string) (bool, error)
+	}
+)
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	AuditActionBan        = "BAN"
+	AuditActionEditBan    = "EDIT_BAN"
+	AuditActionUnban      = "UNBAN"
+	AuditActionChangeRole = "CHANGE_ROLE"
+)
+
+type (
+	// AuditRecord is a privileged action performed by actor on target user. Values are JSON documents describing
+	// changed entity before and after action, nil value means entity did not exist
+	AuditRecord struct {
+		Id        int64
+		ActorId   int64
+		ActorRole UserRole
+		TargetId  int64
+		Action    string
+		OldValue  json.RawMessage
+		NewValue  json.RawMessage
+		Ip        string
+		RequestId string
+		CreatedAt time.Time
+	}
+
+	// AuditQuery describes page of audit log, the latest records go first. Empty fields do not restrict result.
+	// BeforeId is an id of the last record of previous page
+	AuditQuery struct {
+		ActorId     int64
+		TargetId    int64
+		Action      string
+		CreatedFrom time.Time
+		CreatedTill time.Time
+		BeforeId    int64
+		Limit       int
+	}
+
+	AuditStorage interface {
+		CreateAndStore(record AuditRecord) error
+		Search(query AuditQuery) ([]AuditRecord, error)
+	}
+)
@@ -3,17 +3,44 @@ package models
 import "time"
 
 type (
+	// Ban is a record of ban history. Ban is active until it expires or is lifted. Permanent ban has no Until.
+	// IssuerRole is the highest role among issuers of ban and bans it replaced, so ban keeps its rank when edited
 	Ban struct {
-		UserId   int64
-		ByUserId int64
-		Reason   string
-		At       time.Time
-		Until    time.Time
+		Id             int64
+		UserId         int64
+		ByUserId       int64
+		IssuerRole     UserRole
+		Reason         string
+		At             time.Time
+		Until          *time.Time
+		LiftedByUserId int64
+		LiftedAt       *time.Time
 	}
 
+	// BanStorage is the source of truth of bans, history is never deleted
 	BanStorage interface {
-		CreateAndStore(userId int64, reason string, until int64, byUserId int64) error
+		CreateAndStore(userId int64, reason string, until *time.Time, byUserId int64, issuerRole UserRole) (*Ban, error)
+		GetActive(userId int64) (*Ban, error)
+		GetByUserId(userId int64) ([]Ban, error)
+		Lift(userId int64, byUserId int64) (bool, error)
+	}
+
+	// BanCacheStorage keeps active bans for fast checks on every request. It is written through on ban and unban
+	BanCacheStorage interface {
+		Store(ban Ban) error
 		Get(userId int64) (*Ban, error)
 		Delete(userId int64) error
 	}
 )
+
+func (b *Ban) IsPermanent() bool {
+	return b.Until == nil
+}
+
+// Outlasts reports whether ban ends later than ban until given time. Nil until means permanent ban
+func (b *Ban) Outlasts(until *time.Time) bool {
+	if b.Until == nil {
+		return until != nil
+	}
+	return until != nil && b.Until.After(*until)
+}
@@ -2,9 +2,20 @@ package models
 
 import "time"
 
+const (
+	CodeStatusValid CodeStatus = iota
+	CodeStatusWrong
+	CodeStatusAttemptsExceeded
+	CodeStatusNotFound
+)
+
 type (
+	CodeStatus int
+
 	CodeStorage interface {
-		CreateAndStore(email, code string, lifetime time.Duration) error
-		VerifyCode(email, code string) (bool, error)
+		CreateAndStore(identifier, code string, lifetime time.Duration) error
+		VerifyCode(identifier, code string, maxAttempts int64) (CodeStatus, error)
+		Cooldown(identifier string, period time.Duration) (time.Duration, error)
+		ReleaseCooldown(identifier string) error
 	}
 )
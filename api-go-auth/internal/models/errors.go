@@ -21,6 +21,45 @@ const (
 	NoPermissionToBanUser                     //Status: 403
 	NoPermissionsToSetThisRole                //Status: 403
 	NoPermissionToChangeUserRole              //Status: 403
+	MissingAccessToken                        //Status: 401
+	MalformedAccessToken                      //Status: 401
+	InvalidAccessTokenSignature               //Status: 401
+	AccessTokenExpired                        //Status: 401
+	AccessTokenNotYetValid                    //Status: 401
+	InvalidAccessTokenClaims                  //Status: 401
+	AccessTokenRevoked                        //Status: 401
+	AccessTokenOutdated                       //Status: 401
+	TooManyRequests                           //Status: 429
+	AccountTemporarilyLocked                  //Status: 429
+	CodeAttemptsExceeded                      //Status: 400
+	CodeExpired                               //Status: 400
+	CodeResendCooldown                        //Status: 429
+	WrongPassword                             //Status: 403
+	TotpAlreadyEnabled                        //Status: 400
+	TotpNotEnabled                            //Status: 400
+	WrongMfaCode                              //Status: 403
+	WrongMfaToken                             //Status: 401
+	WrongWebauthnSession                      //Status: 400
+	InvalidWebauthnCredential                 //Status: 400
+	WebauthnCredentialExists                  //Status: 400
+	WrongOAuthClient                          //Status: 400
+	InvalidOAuthClientName                    //Status: 400
+	InvalidRedirectUri                        //Status: 400
+	InvalidScope                              //Status: 400
+	InvalidGrantType                          //Status: 400
+	InsufficientScope                         //Status: 403
+	UnknownIdentityProvider                   //Status: 404
+	WrongExternalLoginState                   //Status: 400
+	ExternalLoginFailed                       //Status: 401
+	UnverifiedExternalEmail                   //Status: 403
+	ExternalEmailTaken                        //Status: 403
+	WrongSessionId                            //Status: 404
+	InvalidUsersQuery                         //Status: 400
+	InvalidPageCursor                         //Status: 400
+	NoPermissionToWeakenBan                   //Status: 403
+	NoActiveBan                               //Status: 404
+	EmptyBanChange                            //Status: 400
+	InvalidAuditQuery                         //Status: 400
 )
 
 type (
@@ -107,4 +146,160 @@ var (
 		Message:   "No permission to change user role",
 		InnerCode: NoPermissionToChangeUserRole,
 	}
+	MissingAccessTokenError = &Error{
+		Message:   "Access token is missing",
+		InnerCode: MissingAccessToken,
+	}
+	MalformedAccessTokenError = &Error{
+		Message:   "Access token is malformed",
+		InnerCode: MalformedAccessToken,
+	}
+	InvalidAccessTokenSignatureError = &Error{
+		Message:   "Access token signature is invalid",
+		InnerCode: InvalidAccessTokenSignature,
+	}
+	AccessTokenExpiredError = &Error{
+		Message:   "Access token expired",
+		InnerCode: AccessTokenExpired,
+	}
+	AccessTokenNotYetValidError = &Error{
+		Message:   "Access token is not valid yet",
+		InnerCode: AccessTokenNotYetValid,
+	}
+	InvalidAccessTokenClaimsError = &Error{
+		Message:   "Access token is issued for another service",
+		InnerCode: InvalidAccessTokenClaims,
+	}
+	AccessTokenRevokedError = &Error{
+		Message:   "Access token revoked",
+		InnerCode: AccessTokenRevoked,
+	}
+	AccessTokenOutdatedError = &Error{
+		Message:   "Access token is outdated, refresh it",
+		InnerCode: AccessTokenOutdated,
+	}
+	TooManyRequestsError = &Error{
+		Message:   "Too many requests, try again later",
+		InnerCode: TooManyRequests,
+	}
+	AccountTemporarilyLockedError = &Error{
+		Message:   "Too many failed login attempts, account is temporarily locked",
+		InnerCode: AccountTemporarilyLocked,
+	}
+	CodeAttemptsExceededError = &Error{
+		Message:   "Too many wrong codes, request a new one",
+		InnerCode: CodeAttemptsExceeded,
+	}
+	CodeExpiredError = &Error{
+		Message:   "Code expired or was not requested",
+		InnerCode: CodeExpired,
+	}
+	CodeResendCooldownError = &Error{
+		Message:   "Code was sent recently, try again later",
+		InnerCode: CodeResendCooldown,
+	}
+	WrongPasswordError = &Error{
+		Message:   "Wrong current password",
+		InnerCode: WrongPassword,
+	}
+	TotpAlreadyEnabledError = &Error{
+		Message:   "Two-factor authentication is already enabled",
+		InnerCode: TotpAlreadyEnabled,
+	}
+	TotpNotEnabledError = &Error{
+		Message:   "Two-factor authentication is not enabled",
+		InnerCode: TotpNotEnabled,
+	}
+	WrongMfaCodeError = &Error{
+		Message:   "Wrong authentication or recovery code",
+		InnerCode: WrongMfaCode,
+	}
+	WrongMfaTokenError = &Error{
+		Message:   "Wrong or expired MFA token, sign in again",
+		InnerCode: WrongMfaToken,
+	}
+	WrongWebauthnSessionError = &Error{
+		Message:   "Wrong or expired WebAuthn session, start ceremony again",
+		InnerCode: WrongWebauthnSession,
+	}
+	InvalidWebauthnCredentialError = &Error{
+		Message:   "WebAuthn credential verification failed",
+		InnerCode: InvalidWebauthnCredential,
+	}
+	WebauthnCredentialExistsError = &Error{
+		Message:   "WebAuthn credential is already registered",
+		InnerCode: WebauthnCredentialExists,
+	}
+	WrongOAuthClientError = &Error{
+		Message:   "Unknown OAuth client",
+		InnerCode: WrongOAuthClient,
+	}
+	InvalidOAuthClientNameError = &Error{
+		Message:   "Invalid OAuth client name",
+		InnerCode: InvalidOAuthClientName,
+	}
+	InvalidRedirectUriError = &Error{
+		Message:   "Invalid or not registered redirect URI",
+		InnerCode: InvalidRedirectUri,
+	}
+	InvalidScopeError = &Error{
+		Message:   "Invalid scope",
+		InnerCode: InvalidScope,
+	}
+	InvalidGrantTypeError = &Error{
+		Message:   "Invalid grant types",
+		InnerCode: InvalidGrantType,
+	}
+	InsufficientScopeError = &Error{
+		Message:   "Access token scope is insufficient",
+		InnerCode: InsufficientScope,
+	}
+	UnknownIdentityProviderError = &Error{
+		Message:   "Unknown identity provider",
+		InnerCode: UnknownIdentityProvider,
+	}
+	WrongExternalLoginStateError = &Error{
+		Message:   "Wrong or expired login state",
+		InnerCode: WrongExternalLoginState,
+	}
+	ExternalLoginFailedError = &Error{
+		Message:   "Identity provider rejected authentication",
+		InnerCode: ExternalLoginFailed,
+	}
+	UnverifiedExternalEmailError = &Error{
+		Message:   "Identity provider did not confirm email address",
+		InnerCode: UnverifiedExternalEmail,
+	}
+	ExternalEmailTakenError = &Error{
+		Message:   "Account with this email already exists, sign in with its password",
+		InnerCode: ExternalEmailTaken,
+	}
+	WrongSessionIdError = &Error{
+		Message:   "Session not found",
+		InnerCode: WrongSessionId,
+	}
+	InvalidUsersQueryError = &Error{
+		Message:   "Invalid filter or sorting of users",
+		InnerCode: InvalidUsersQuery,
+	}
+	InvalidPageCursorError = &Error{
+		Message:   "Invalid page cursor",
+		InnerCode: InvalidPageCursor,
+	}
+	NoPermissionToWeakenBanError = &Error{
+		Message:   "No permission to weaken ban issued by user with higher role",
+		InnerCode: NoPermissionToWeakenBan,
+	}
+	NoActiveBanError = &Error{
+		Message:   "User is not banned",
+		InnerCode: NoActiveBan,
+	}
+	EmptyBanChangeError = &Error{
+		Message:   "Nothing to change in ban",
+		InnerCode: EmptyBanChange,
+	}
+	InvalidAuditQueryError = &Error{
+		Message:   "Invalid filter of audit log",
+		InnerCode: InvalidAuditQuery,
+	}
 )
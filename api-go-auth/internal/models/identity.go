@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+)
+
+type (
+	// Identity links account of external identity provider to user. Subject is unique only within provider
+	Identity struct {
+		Provider  string
+		Subject   string
+		UserId    int64
+		Email     string
+		CreatedAt time.Time
+	}
+
+	IdentityStorage interface {
+		CreateAndStore(provider, subject string, userId int64, email string) (bool, error)
+		Get(provider, subject string) (*Identity, error)
+	}
+
+	// ExternalLoginSession is state of authorization code flow with external provider between begin and callback requests
+	ExternalLoginSession struct {
+		Provider     string `json:"provider"`
+		Nonce        string `json:"nonce"`
+		CodeVerifier string `json:"codeVerifier"`
+	}
+
+	ExternalLoginSessionStorage interface {
+		CreateAndStore(state string, session ExternalLoginSession, lifetime time.Duration) error
+		Consume(state string) (*ExternalLoginSession, error)
+	}
+)
@@ -0,0 +1,81 @@
+package models
+
+import (
+	"time"
+)
+
+const (
+	GrantTypeAuthorizationCode = "authorization_code"
+	GrantTypeRefreshToken      = "refresh_token"
+	GrantTypeClientCredentials = "client_credentials"
+)
+
+type (
+	// OAuthClient is application registered in authorization server. Public clients have no secret
+	// and can not use client_credentials grant
+	OAuthClient struct {
+		Id             string
+		Name           string
+		IsConfidential bool
+		RedirectUris   []string
+		Scopes         []string
+		GrantTypes     []string
+		CreatedAt      time.Time
+	}
+
+	OAuthClientStorage interface {
+		CreateAndStore(client OAuthClient, secret string) error
+		Get(id string) (*OAuthClient, error)
+		Authenticate(id, secret string) (*OAuthClient, error)
+	}
+
+	// OAuthCode is state of authorization code grant between authorization and token requests
+	OAuthCode struct {
+		ClientId      string `json:"clientId"`
+		UserId        int64  `json:"userId"`
+		RedirectUri   string `json:"redirectUri"`
+		Scope         string `json:"scope"`
+		CodeChallenge string `json:"codeChallenge"`
+		Nonce         string `json:"nonce,omitempty"`
+	}
+
+	OAuthCodeStorage interface {
+		CreateAndStore(code string, data OAuthCode, lifetime time.Duration) error
+		Consume(code string) (*OAuthCode, error)
+	}
+)
+
+func (c *OAuthClient) AllowsGrant(grantType string) bool {
+	for _, allowed := range c.GrantTypes {
+		if allowed == grantType {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *OAuthClient) AllowsRedirectUri(uri string) bool {
+	for _, allowed := range c.RedirectUris {
+		if allowed == uri {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsScopes checks that every requested scope is registered for client
+func (c *OAuthClient) AllowsScopes(scopes []string) bool {
+	for _, scope := range scopes {
+		found := false
+		for _, allowed := range c.Scopes {
+			if allowed == scope {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
@@ -7,18 +7,46 @@ import (
 type (
 	RefreshToken struct {
 		User       User
-		Token      string
+		TokenHash  string
+		SessionId  string
+		ClientId   string
+		Scope      string
+		UserAgent  string
+		Ip         string
 		IssuedAt   time.Time
 		LastUsedAt time.Time
+		RotatedAt  *time.Time
 		IsRevoked  bool
 	}
 
+	// Device describes client that refresh token was requested from
+	Device struct {
+		UserAgent string
+		Ip        string
+	}
+
+	// Session is a chain of refresh tokens started by single login. Tokens of session replace each other on rotation
+	Session struct {
+		Id         string
+		ClientId   string
+		UserAgent  string
+		Ip         string
+		StartedAt  time.Time
+		LastUsedAt time.Time
+	}
+
 	RefreshTokenStorage interface {
-		CreateAndStore(userId int64, tokenValue string) error
+		CreateAndStore(userId int64, sessionId, clientId, scope, tokenValue string, device Device) error
 		Get(tokenValue string, lifePeriod time.Duration) (*RefreshToken, error)
+		Find(tokenValue string, lifePeriod time.Duration) (*RefreshToken, error)
+		Rotate(tokenValue, newTokenValue, clientId string, device Device, lifePeriod time.Duration) (*RefreshToken, error)
+		GetRotated(tokenValue string) (*RefreshToken, error)
 		Revoke(tokenValue string) error
 		RevokeAll(tokenValue string) error
 		RevokeAllExceptCurrent(tokenValue string) error
 		RevokeAllByUserId(userId int64) error
+		RevokeSession(sessionId string) error
+		RevokeUserSession(userId int64, sessionId string) (bool, error)
+		GetSessions(userId int64, lifePeriod time.Duration) ([]Session, error)
 	}
 )
@@ -0,0 +1,8 @@
+package models
+
+type (
+	TokenVersionStorage interface {
+		Get(userId int64) (int64, error)
+		Bump(userId int64) (int64, error)
+	}
+)
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+)
+
+type (
+	Totp struct {
+		UserId       int64
+		Secret       []byte
+		IsEnabled    bool
+		LastUsedStep int64
+		CreatedAt    time.Time
+	}
+
+	TotpStorage interface {
+		CreateAndStore(userId int64, secret []byte) (bool, error)
+		Get(userId int64) (*Totp, error)
+		Enable(userId int64, recoveryCodes []string) (bool, error)
+		Disable(userId int64) error
+		UseStep(userId int64, step int64) (bool, error)
+		UseRecoveryCode(userId int64, code string) (bool, error)
+	}
+
+	MfaChallengeStorage interface {
+		CreateAndStore(token string, userId int64, lifetime time.Duration) error
+		Get(token string) (int64, error)
+		Consume(token string) (bool, error)
+	}
+)
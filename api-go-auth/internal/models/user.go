@@ -10,6 +10,10 @@ const (
 	RoleModerator      UserRole = "MODERATOR"
 	RolePrivilegedUser UserRole = "PRIVILEGED_USER"
 	RoleUser           UserRole = "USER"
+
+	UserSortById        UserSortField = "id"
+	UserSortByLogin     UserSortField = "login"
+	UserSortByCreatedAt UserSortField = "createdAt"
 )
 
 type (
@@ -27,13 +31,49 @@ type (
 
 	UserRole string
 
+	UserSortField string
+
+	// UserQuery describes page of users search. Empty fields do not restrict result
+	UserQuery struct {
+		LoginPrefix   string
+		EmailPrefix   string
+		Role          UserRole
+		Banned        *bool
+		CreatedFrom   time.Time
+		CreatedBefore time.Time
+		SortBy        UserSortField
+		Descending    bool
+		After         *UserCursor
+		Limit         int
+	}
+
+	// UserSummary is a user found by search
+	UserSummary struct {
+		User
+		IsBanned bool
+	}
+
+	// UserCursor points to the last user of previous page. Only fields used for sorting are considered
+	UserCursor struct {
+		Id        int64     `json:"id"`
+		Login     string    `json:"login,omitempty"`
+		CreatedAt time.Time `json:"createdAt,omitempty"`
+	}
+
 	UserStorage interface {
 		CreateAndStore(email, login, password string) error
 		GetByCredentials(credentials UserCredentials) (*User, error)
+		GetByLogin(login string) (*User, error)
 		GetById(id int64) (*User, error)
+		GetByIdForUpdate(id int64) (*User, error)
+		GetByEmail(email string) (*User, error)
 		EmailExists(email string) (bool, error)
 		LoginExists(login string) (bool, error)
 		ChangeRole(id int64, role string) error
+		SetPassword(id int64, password string) error
+		ChangePassword(id int64, oldPassword, newPassword string) (bool, error)
+		ChangeEmail(id int64, email string) (string, error)
+		Search(query UserQuery) ([]UserSummary, error)
 	}
 )
 
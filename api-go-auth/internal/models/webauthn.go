@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+)
+
+type (
+	WebauthnCredential struct {
+		Id         []byte
+		UserId     int64
+		PublicKey  []byte
+		SignCount  int64
+		CreatedAt  time.Time
+		LastUsedAt *time.Time
+	}
+
+	WebauthnCredentialStorage interface {
+		CreateAndStore(userId int64, id, publicKey []byte, signCount int64) (bool, error)
+		Get(id []byte) (*WebauthnCredential, error)
+		GetByUserId(userId int64) ([]WebauthnCredential, error)
+		UpdateSignCount(id []byte, signCount int64) error
+	}
+
+	// WebauthnSession is state of ceremony between begin and finish requests. UserId is 0 for authentication
+	// ceremony since user is identified by credential
+	WebauthnSession struct {
+		Challenge string `json:"challenge"`
+		UserId    int64  `json:"userId"`
+	}
+
+	WebauthnSessionStorage interface {
+		CreateAndStore(sessionId string, session WebauthnSession, lifetime time.Duration) error
+		Consume(sessionId string) (*WebauthnSession, error)
+	}
+)
@@ -0,0 +1,127 @@
+package storages
+
+import (
+	"auth/internal/models"
+	"auth/pkg/rds"
+	"context"
+	"fmt"
+	"github.com/go-redis/redis/v9"
+	"strconv"
+	"time"
+)
+
+//TODO context
+
+const (
+	AccessTokensRedisKeyPattern        = "ACCESS_TOKENS_USER_%d"
+	SessionAccessTokensRedisKeyPattern = "ACCESS_TOKENS_SESSION_%s"
+	RevokedAccessTokenRedisKeyPattern  = "REVOKED_ACCESS_TOKEN_%s"
+)
+
+type (
+	// AccessTokenStorage keeps ids of issued access tokens per user and per session and a denylist of revoked ones.
+	// Every record lives until the token it refers to expires
+	AccessTokenStorage struct {
+		querier *redis.Client
+	}
+)
+
+func NewAccessTokenStorage(q *redis.Client) models.AccessTokenStorage {
+	return &AccessTokenStorage{querier: q}
+}
+
+// Register remembers token id for user and, if sessionId is not empty, for session
+func (r *AccessTokenStorage) Register(userId int64, sessionId, jti string, exp int64) error {
+	if r.querier == nil {
+		return rds.ErrNotInitialized
+	}
+
+	keys := []string{fmt.Sprintf(AccessTokensRedisKeyPattern, userId)}
+	if sessionId != "" {
+		keys = append(keys, fmt.Sprintf(SessionAccessTokensRedisKeyPattern, sessionId))
+	}
+
+	_, err := r.querier.TxPipelined(context.Background(), func(pipe redis.Pipeliner) error {
+		for _, key := range keys {
+			pipe.ZRemRangeByScore(context.Background(), key, "-inf", strconv.FormatInt(time.Now().Unix(), 10))
+			pipe.ZAdd(context.Background(), key, redis.Z{Score: float64(exp), Member: jti})
+			pipe.ExpireAt(context.Background(), key, time.Unix(exp, 0))
+		}
+		return nil
+	})
+	return err
+}
+
+func (r *AccessTokenStorage) Revoke(jti string, exp int64) error {
+	if r.querier == nil {
+		return rds.ErrNotInitialized
+	}
+
+	ttl := time.Until(time.Unix(exp, 0))
+	if ttl <= 0 {
+		return nil
+	}
+
+	return r.querier.Set(context.Background(), fmt.Sprintf(RevokedAccessTokenRedisKeyPattern, jti), 1, ttl).Err()
+}
+
+// RevokeAllByUserId puts every unexpired access token of user except exceptJti to denylist
+func (r *AccessTokenStorage) RevokeAllByUserId(userId int64, exceptJti string) error {
+	if r.querier == nil {
+		return rds.ErrNotInitialized
+	}
+
+	return r.revokeAll(fmt.Sprintf(AccessTokensRedisKeyPattern, userId), exceptJti)
+}
+
+// RevokeAllBySessionId puts every unexpired access token issued in session to denylist
+func (r *AccessTokenStorage) RevokeAllBySessionId(sessionId string) error {
+	if r.querier == nil {
+		return rds.ErrNotInitialized
+	}
+
+	return r.revokeAll(fmt.Sprintf(SessionAccessTokensRedisKeyPattern, sessionId), "")
+}
+
+// revokeAll puts unexpired tokens of sorted set stored at key to denylist and removes them from set
+func (r *AccessTokenStorage) revokeAll(key, exceptJti string) error {
+	tokens, err := r.querier.ZRangeByScoreWithScores(context.Background(), key, &redis.ZRangeBy{
+		Min: "(" + strconv.FormatInt(time.Now().Unix(), 10),
+		Max: "+inf",
+	}).Result()
+	if err != nil {
+		return err
+	}
+
+	_, err = r.querier.TxPipelined(context.Background(), func(pipe redis.Pipeliner) error {
+		for _, token := range tokens {
+			jti, _ := token.Member.(string)
+			if jti == exceptJti {
+				continue
+			}
+
+			ttl := time.Until(time.Unix(int64(token.Score), 0))
+			if ttl <= 0 {
+				continue
+			}
+
+			pipe.Set(context.Background(), fmt.Sprintf(RevokedAccessTokenRedisKeyPattern, jti), 1, ttl)
+			pipe.ZRem(context.Background(), key, jti)
+		}
+		return nil
+	})
+	return err
+}
+
+func (r *AccessTokenStorage) IsRevoked(jti string) (bool, error) {
+	if r.querier == nil {
+		return false, rds.ErrNotInitialized
+	}
+
+	n, err := r.querier.Exists(context.Background(), fmt.Sprintf(RevokedAccessTokenRedisKeyPattern, jti)).Result()
+	if err != nil {
+		return false, err
+	}
+
+	return n > 0, nil
+}
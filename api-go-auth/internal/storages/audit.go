@@ -0,0 +1,109 @@
+package storages
+
+import (
+	"auth/internal/models"
+	"auth/pkg/pgs"
+	"context"
+	"fmt"
+	"github.com/jackc/pgtype/pgxtype"
+	"strings"
+)
+
+//TODO context
+
+type (
+	AuditStorage struct {
+		querier pgxtype.Querier
+	}
+)
+
+func NewAuditStorage(q pgxtype.Querier) models.AuditStorage {
+	return &AuditStorage{querier: q}
+}
+
+// CreateAndStore appends record to audit log. Zero target id and nil values are stored as NULL
+func (r *AuditStorage) CreateAndStore(record models.AuditRecord) error {
+	if r.querier == nil {
+		return pgs.ErrNotInitialized
+	}
+
+	_, err := r.querier.Exec(context.Background(),
+		`INSERT INTO audit_log("actorId", "actorRole", "targetId", action, "oldValue", "newValue", ip, "requestId")
+				VALUES ($1, $2, NULLIF($3, 0), $4, $5::JSONB, $6::JSONB, $7, $8)`,
+		record.ActorId, string(record.ActorRole), record.TargetId, record.Action, nullableJson(record.OldValue),
+		nullableJson(record.NewValue), record.Ip, record.RequestId)
+	return err
+}
+
+func (r *AuditStorage) Search(query models.AuditQuery) ([]models.AuditRecord, error) {
+	if r.querier == nil {
+		return nil, pgs.ErrNotInitialized
+	}
+
+	conditions := make([]string, 0)
+	args := make([]interface{}, 0)
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if query.ActorId != 0 {
+		conditions = append(conditions, `"actorId" = `+arg(query.ActorId))
+	}
+	if query.TargetId != 0 {
+		conditions = append(conditions, `"targetId" = `+arg(query.TargetId))
+	}
+	if query.Action != "" {
+		conditions = append(conditions, "action = "+arg(query.Action))
+	}
+	if !query.CreatedFrom.IsZero() {
+		conditions = append(conditions, `"createdAt" >= `+arg(query.CreatedFrom))
+	}
+	if !query.CreatedTill.IsZero() {
+		conditions = append(conditions, `"createdAt" < `+arg(query.CreatedTill))
+	}
+	if query.BeforeId != 0 {
+		conditions = append(conditions, "id < "+arg(query.BeforeId))
+	}
+
+	sql := `SELECT id, "actorId", "actorRole", COALESCE("targetId", 0), action, "oldValue", "newValue", ip, "requestId", "createdAt"
+				FROM audit_log`
+	if len(conditions) > 0 {
+		sql += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	sql += " ORDER BY id DESC LIMIT " + arg(query.Limit)
+
+	rows, err := r.querier.Query(context.Background(), sql, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]models.AuditRecord, 0, query.Limit)
+	for rows.Next() {
+		var record models.AuditRecord
+		var oldValue, newValue *string
+		err = rows.Scan(&record.Id, &record.ActorId, &record.ActorRole, &record.TargetId, &record.Action, &oldValue,
+			&newValue, &record.Ip, &record.RequestId, &record.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if oldValue != nil {
+			record.OldValue = []byte(*oldValue)
+		}
+		if newValue != nil {
+			record.NewValue = []byte(*newValue)
+		}
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+// nullableJson passes empty document as NULL
+func nullableJson(value []byte) *string {
+	if len(value) == 0 {
+		return nil
+	}
+	s := string(value)
+	return &s
+}
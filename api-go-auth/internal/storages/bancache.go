@@ -0,0 +1,108 @@
+package storages
+
+import (
+	"auth/internal/models"
+	"auth/pkg/rds"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-redis/redis/v9"
+	"time"
+)
+
+//TODO context
+
+const (
+	BanRedisKeyPattern = "BAN_AUTH_%d"
+)
+
+type (
+	// BanCacheStorage keeps active ban of user until it expires
+	BanCacheStorage struct {
+		querier *redis.Client
+	}
+
+	banSerialized struct {
+		Id       int64  `json:"id"`
+		UserId   int64  `json:"userId"`
+		ByUserId int64  `json:"byUserId"`
+		Reason   string `json:"reason"`
+		At       int64  `json:"at"`
+		Until    int64  `json:"until,omitempty"`
+	}
+)
+
+func NewBanCacheStorage(q *redis.Client) models.BanCacheStorage {
+	return &BanCacheStorage{querier: q}
+}
+
+// Store caches active ban. Expired ban is not stored, permanent one never expires
+func (r *BanCacheStorage) Store(ban models.Ban) error {
+	if r.querier == nil {
+		return rds.ErrNotInitialized
+	}
+
+	serialized := banSerialized{
+		Id:       ban.Id,
+		UserId:   ban.UserId,
+		ByUserId: ban.ByUserId,
+		Reason:   ban.Reason,
+		At:       ban.At.Unix(),
+	}
+
+	var ttl time.Duration
+	if ban.Until != nil {
+		ttl = time.Until(*ban.Until)
+		if ttl <= 0 {
+			return nil
+		}
+		serialized.Until = ban.Until.Unix()
+	}
+
+	bytes, _ := json.Marshal(serialized)
+
+	return r.querier.Set(context.Background(), fmt.Sprintf(BanRedisKeyPattern, ban.UserId), bytes, ttl).Err()
+}
+
+func (r *BanCacheStorage) Get(userId int64) (*models.Ban, error) {
+	if r.querier == nil {
+		return nil, rds.ErrNotInitialized
+	}
+
+	raw, err := r.querier.Get(context.Background(), fmt.Sprintf(BanRedisKeyPattern, userId)).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var ban banSerialized
+	err = json.Unmarshal(raw, &ban)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &models.Ban{
+		Id:       ban.Id,
+		UserId:   ban.UserId,
+		ByUserId: ban.ByUserId,
+		Reason:   ban.Reason,
+		At:       time.Unix(ban.At, 0),
+	}
+	if ban.Until != 0 {
+		until := time.Unix(ban.Until, 0)
+		result.Until = &until
+	}
+
+	return result, nil
+}
+
+func (r *BanCacheStorage) Delete(userId int64) error {
+	if r.querier == nil {
+		return rds.ErrNotInitialized
+	}
+
+	return r.querier.Del(context.Background(), fmt.Sprintf(BanRedisKeyPattern, userId)).Err()
+}
@@ -2,90 +2,127 @@ package storages
 
 import (
 	"auth/internal/models"
-	"auth/pkg/rds"
+	"auth/pkg/pgs"
 	"context"
-	"encoding/json"
-	"errors"
-	"fmt"
-	"github.com/go-redis/redis/v9"
+	"github.com/jackc/pgtype/pgxtype"
 	"time"
 )
 
 //TODO context
 
-const (
-	BanRedisKeyPattern = "BAN_AUTH_%d"
-)
-
 type (
 	BanStorage struct {
-		querier *redis.Client
-	}
-
-	banSerialized struct {
-		UserId   int64  `json:"userId"`
-		ByUserId int64  `json:"byUserId"`
-		Reason   string `json:"reason"`
-		At       int64  `json:"at"`
-		Until    int64  `json:"until"`
+		querier pgxtype.Querier
 	}
 )
 
-func NewBanStorage(q *redis.Client) models.BanStorage {
+func NewBanStorage(q pgxtype.Querier) models.BanStorage {
 	return &BanStorage{querier: q}
 }
 
-func (r *BanStorage) CreateAndStore(userId int64, reason string, until int64, byUserId int64) error {
+// CreateAndStore bans user until given time or permanently if until is nil. Active bans of user are lifted by the same
+// moderator, so user has at most one active ban
+func (r *BanStorage) CreateAndStore(userId int64, reason string, until *time.Time, byUserId int64,
+	issuerRole models.UserRole) (*models.Ban, error) {
 	if r.querier == nil {
-		return rds.ErrNotInitialized
+		return nil, pgs.ErrNotInitialized
+	}
+
+	if until != nil {
+		utc := until.UTC()
+		until = &utc
 	}
 
-	t := time.Now()
-	ban := banSerialized{
-		UserId:   userId,
-		ByUserId: byUserId,
-		Reason:   reason,
-		At:       t.Unix(),
-		Until:    until,
+	ban := &models.Ban{
+		UserId:     userId,
+		ByUserId:   byUserId,
+		IssuerRole: issuerRole,
+		Reason:     reason,
+		Until:      until,
 	}
 
-	bytes, _ := json.Marshal(ban)
+	err := r.querier.QueryRow(context.Background(),
+		`WITH lifted AS (
+					UPDATE bans SET "liftedByUserId" = $4, "liftedAt" = CURRENT_TIMESTAMP
+					WHERE "userId" = $1 AND "liftedAt" IS NULL AND (until IS NULL OR until > CURRENT_TIMESTAMP)
+				)
+				INSERT INTO bans("userId", "byUserId", "issuerRole", reason, until) VALUES ($1, $4, $5, $2, $3) RETURNING id, "at"`,
+		userId, reason, ban.Until, byUserId, string(issuerRole)).
+		Scan(&ban.Id, &ban.At)
+	if err != nil {
+		return nil, err
+	}
 
-	return r.querier.Set(context.Background(), fmt.Sprintf(BanRedisKeyPattern, userId), bytes, time.Unix(until, 0).Sub(t)).Err()
+	return ban, nil
 }
 
-func (r *BanStorage) Get(userId int64) (*models.Ban, error) {
+// GetActive returns ban of user that is neither expired nor lifted
+func (r *BanStorage) GetActive(userId int64) (*models.Ban, error) {
 	if r.querier == nil {
-		return nil, rds.ErrNotInitialized
+		return nil, pgs.ErrNotInitialized
 	}
 
-	raw, err := r.querier.Get(context.Background(), fmt.Sprintf(BanRedisKeyPattern, userId)).Bytes()
+	rows, err := r.querier.Query(context.Background(),
+		`SELECT id, "userId", "byUserId", "issuerRole", reason, "at", until, COALESCE("liftedByUserId", 0), "liftedAt" FROM bans
+				WHERE "userId" = $1 AND "liftedAt" IS NULL AND (until IS NULL OR until > CURRENT_TIMESTAMP)
+				ORDER BY "at" DESC LIMIT 1`, userId)
 	if err != nil {
-		if errors.Is(err, redis.Nil) {
-			return nil, nil
-		}
 		return nil, err
 	}
 
-	var ban banSerialized
-	err = json.Unmarshal(raw, &ban)
+	var ban *models.Ban
+	for rows.Next() {
+		ban = &models.Ban{}
+		err = rows.Scan(&ban.Id, &ban.UserId, &ban.ByUserId, &ban.IssuerRole, &ban.Reason, &ban.At, &ban.Until, &ban.LiftedByUserId,
+			&ban.LiftedAt)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return ban, nil
+}
+
+// GetByUserId returns whole ban history of user, the latest bans go first
+func (r *BanStorage) GetByUserId(userId int64) ([]models.Ban, error) {
+	if r.querier == nil {
+		return nil, pgs.ErrNotInitialized
+	}
+
+	rows, err := r.querier.Query(context.Background(),
+		`SELECT id, "userId", "byUserId", "issuerRole", reason, "at", until, COALESCE("liftedByUserId", 0), "liftedAt" FROM bans
+				WHERE "userId" = $1 ORDER BY "at" DESC, id DESC`, userId)
 	if err != nil {
 		return nil, err
 	}
 
-	return &models.Ban{
-		UserId:   ban.UserId,
-		ByUserId: ban.ByUserId,
-		Reason:   ban.Reason,
-		At:       time.Unix(ban.At, 0),
-		Until:    time.Unix(ban.Until, 0),
-	}, nil
+	bans := make([]models.Ban, 0)
+	for rows.Next() {
+		var ban models.Ban
+		err = rows.Scan(&ban.Id, &ban.UserId, &ban.ByUserId, &ban.IssuerRole, &ban.Reason, &ban.At, &ban.Until, &ban.LiftedByUserId,
+			&ban.LiftedAt)
+		if err != nil {
+			return nil, err
+		}
+		bans = append(bans, ban)
+	}
+
+	return bans, nil
 }
 
-func (r *BanStorage) Delete(userId int64) error {
+// Lift ends active bans of user. False is returned if user has no active ban
+func (r *BanStorage) Lift(userId int64, byUserId int64) (bool, error) {
 	if r.querier == nil {
-		return rds.ErrNotInitialized
+		return false, pgs.ErrNotInitialized
+	}
+
+	tag, err := r.querier.Exec(context.Background(),
+		`UPDATE bans SET "liftedByUserId" = $2, "liftedAt" = CURRENT_TIMESTAMP
+				WHERE "userId" = $1 AND "liftedAt" IS NULL AND (until IS NULL OR until > CURRENT_TIMESTAMP)`,
+		userId, byUserId)
+	if err != nil {
+		return false, err
 	}
 
-	return r.querier.Del(context.Background(), fmt.Sprintf(BanRedisKeyPattern, userId)).Err()
+	return tag.RowsAffected() > 0, nil
 }
@@ -4,7 +4,6 @@ import (
 	"auth/internal/models"
 	"auth/pkg/rds"
 	"context"
-	"errors"
 	"fmt"
 	"github.com/go-redis/redis/v9"
 	"time"
@@ -13,39 +12,118 @@ import (
 //TODO context
 
 const (
-	VerificationCodeRedisKey = "VERIFICATION_EMAIL_%s"
+	VerificationCodeRedisKey         = "VERIFICATION_%s_%s"
+	VerificationAttemptsRedisKey     = "VERIFICATION_%s_ATTEMPTS_%s"
+	VerificationCodeCooldownRedisKey = "VERIFICATION_%s_COOLDOWN_%s"
+
+	CodePurposeEmail         = "EMAIL"
+	CodePurposePasswordReset = "PASSWORD_RESET"
+	CodePurposeEmailChange   = "EMAIL_CHANGE"
 )
 
 type (
 	CodeStorage struct {
 		querier *redis.Client
+		purpose string
 	}
 )
 
-func NewCodeStorage(q *redis.Client) models.CodeStorage {
-	return &CodeStorage{querier: q}
+var (
+	// verifyCodeScript consumes code on success and counts failures, code is deleted after the last allowed one
+	verifyCodeScript = redis.NewScript(`
+local stored = redis.call('GET', KEYS[1])
+if not stored then
+	return 3
+end
+
+if stored == ARGV[1] then
+	redis.call('DEL', KEYS[1], KEYS[2])
+	return 0
+end
+
+local attempts = redis.call('INCR', KEYS[2])
+if attempts == 1 then
+	local ttl = redis.call('PTTL', KEYS[1])
+	if ttl > 0 then
+		redis.call('PEXPIRE', KEYS[2], ttl)
+	end
+end
+
+if attempts >= tonumber(ARGV[2]) then
+	redis.call('DEL', KEYS[1], KEYS[2])
+	return 2
+end
+
+return 1
+`)
+)
+
+// NewCodeStorage creates storage of codes for specified purpose. Codes of different purposes do not interfere
+func NewCodeStorage(q *redis.Client, purpose string) models.CodeStorage {
+	return &CodeStorage{querier: q, purpose: purpose}
 }
 
-func (r *CodeStorage) CreateAndStore(email, code string, lifetime time.Duration) error {
+func (r *CodeStorage) CreateAndStore(identifier, code string, lifetime time.Duration) error {
 	if r.querier == nil {
 		return rds.ErrNotInitialized
 	}
 
-	return r.querier.Set(context.Background(), fmt.Sprintf(VerificationCodeRedisKey, email), code, lifetime).Err()
+	_, err := r.querier.TxPipelined(context.Background(), func(pipe redis.Pipeliner) error {
+		pipe.Set(context.Background(), fmt.Sprintf(VerificationCodeRedisKey, r.purpose, identifier), code, lifetime)
+		pipe.Del(context.Background(), fmt.Sprintf(VerificationAttemptsRedisKey, r.purpose, identifier))
+		return nil
+	})
+	return err
 }
 
-func (r *CodeStorage) VerifyCode(email, code string) (bool, error) {
+// VerifyCode atomically checks code. Valid code can be used only once
+func (r *CodeStorage) VerifyCode(identifier, code string, maxAttempts int64) (models.CodeStatus, error) {
 	if r.querier == nil {
-		return false, rds.ErrNotInitialized
+		return models.CodeStatusNotFound, rds.ErrNotInitialized
 	}
 
-	result, err := r.querier.Get(context.Background(), fmt.Sprintf(VerificationCodeRedisKey, email)).Result()
+	status, err := verifyCodeScript.Run(context.Background(), r.querier,
+		[]string{fmt.Sprintf(VerificationCodeRedisKey, r.purpose, identifier), fmt.Sprintf(VerificationAttemptsRedisKey, r.purpose, identifier)},
+		code, maxAttempts).Int64()
 	if err != nil {
-		if errors.Is(err, redis.Nil) {
-			return false, nil
-		}
-		return false, err
+		return models.CodeStatusNotFound, err
+	}
+
+	return models.CodeStatus(status), nil
+}
+
+// Cooldown starts period during which new code can not be sent. If it is already started, remaining time is returned
+func (r *CodeStorage) Cooldown(identifier string, period time.Duration) (time.Duration, error) {
+	if r.querier == nil {
+		return 0, rds.ErrNotInitialized
+	}
+
+	key := fmt.Sprintf(VerificationCodeCooldownRedisKey, r.purpose, identifier)
+
+	ok, err := r.querier.SetNX(context.Background(), key, 1, period).Result()
+	if err != nil {
+		return 0, err
+	}
+	if ok {
+		return 0, nil
+	}
+
+	ttl, err := r.querier.PTTL(context.Background(), key).Result()
+	if err != nil {
+		return 0, err
+	}
+	if ttl < 0 {
+		return 0, nil
+	}
+
+	return ttl, nil
+}
+
+// ReleaseCooldown ends cooldown before its period is over. It is used when code could not be sent
+func (r *CodeStorage) ReleaseCooldown(identifier string) error {
+	if r.querier == nil {
+		return rds.ErrNotInitialized
 	}
 
-	return result == code, nil
+	return r.querier.Del(context.Background(), fmt.Sprintf(VerificationCodeCooldownRedisKey, r.purpose, identifier)).Err()
 }
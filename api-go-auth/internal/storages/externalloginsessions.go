@@ -0,0 +1,64 @@
+package storages
+
+import (
+	"auth/internal/models"
+	"auth/pkg/rds"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-redis/redis/v9"
+	"time"
+)
+
+//TODO context
+
+const (
+	ExternalLoginSessionRedisKeyPattern = "EXTERNAL_LOGIN_%s"
+)
+
+type (
+	ExternalLoginSessionStorage struct {
+		querier *redis.Client
+	}
+)
+
+func NewExternalLoginSessionStorage(q *redis.Client) models.ExternalLoginSessionStorage {
+	return &ExternalLoginSessionStorage{querier: q}
+}
+
+func (r *ExternalLoginSessionStorage) CreateAndStore(state string, session models.ExternalLoginSession, lifetime time.Duration) error {
+	if r.querier == nil {
+		return rds.ErrNotInitialized
+	}
+
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+
+	return r.querier.Set(context.Background(), fmt.Sprintf(ExternalLoginSessionRedisKeyPattern, state), data, lifetime).Err()
+}
+
+// Consume returns session and deletes it, so every state can be used only once. Nil is returned if session does not exist
+func (r *ExternalLoginSessionStorage) Consume(state string) (*models.ExternalLoginSession, error) {
+	if r.querier == nil {
+		return nil, rds.ErrNotInitialized
+	}
+
+	data, err := r.querier.GetDel(context.Background(), fmt.Sprintf(ExternalLoginSessionRedisKeyPattern, state)).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var session models.ExternalLoginSession
+	err = json.Unmarshal(data, &session)
+	if err != nil {
+		return nil, err
+	}
+
+	return &session, nil
+}
@@ -0,0 +1,60 @@
+package storages
+
+import (
+	"auth/internal/models"
+	"auth/pkg/pgs"
+	"context"
+	"github.com/jackc/pgtype/pgxtype"
+)
+
+//TODO context
+
+type (
+	IdentityStorage struct {
+		querier pgxtype.Querier
+	}
+)
+
+func NewIdentityStorage(q pgxtype.Querier) models.IdentityStorage {
+	return &IdentityStorage{querier: q}
+}
+
+// CreateAndStore links identity to user. False is returned if identity is already linked
+func (r *IdentityStorage) CreateAndStore(provider, subject string, userId int64, email string) (bool, error) {
+	if r.querier == nil {
+		return false, pgs.ErrNotInitialized
+	}
+
+	tag, err := r.querier.Exec(context.Background(),
+		`INSERT INTO user_identities(provider, subject, "userId", email) VALUES ($1, $2, $3, NULLIF($4, '')) ON CONFLICT (provider, subject) DO NOTHING`,
+		provider, subject, userId, email)
+	if err != nil {
+		return false, err
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+func (r *IdentityStorage) Get(provider, subject string) (*models.Identity, error) {
+	if r.querier == nil {
+		return nil, pgs.ErrNotInitialized
+	}
+
+	rows, err := r.querier.Query(context.Background(),
+		`SELECT provider, subject, "userId", COALESCE(email, ''), "createdAt" FROM user_identities WHERE provider = $1 AND subject = $2`,
+		provider, subject)
+	if err != nil {
+		return nil, err
+	}
+
+	var identity *models.Identity
+	for rows.Next() {
+		identity = &models.Identity{}
+		err = rows.Scan(&identity.Provider, &identity.Subject, &identity.UserId, &identity.Email, &identity.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return identity, nil
+}
@@ -0,0 +1,67 @@
+package storages
+
+import (
+	"auth/internal/models"
+	"auth/pkg/rds"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-redis/redis/v9"
+	"time"
+)
+
+//TODO context
+
+const (
+	MfaChallengeRedisKeyPattern = "MFA_CHALLENGE_%s"
+)
+
+type (
+	// MfaChallengeStorage keeps short-lived tokens issued after successful password check to users with second factor
+	MfaChallengeStorage struct {
+		querier *redis.Client
+	}
+)
+
+func NewMfaChallengeStorage(q *redis.Client) models.MfaChallengeStorage {
+	return &MfaChallengeStorage{querier: q}
+}
+
+func (r *MfaChallengeStorage) CreateAndStore(token string, userId int64, lifetime time.Duration) error {
+	if r.querier == nil {
+		return rds.ErrNotInitialized
+	}
+
+	return r.querier.Set(context.Background(), fmt.Sprintf(MfaChallengeRedisKeyPattern, token), userId, lifetime).Err()
+}
+
+// Get returns id of user that challenge was issued to. Zero is returned if challenge does not exist
+func (r *MfaChallengeStorage) Get(token string) (int64, error) {
+	if r.querier == nil {
+		return 0, rds.ErrNotInitialized
+	}
+
+	userId, err := r.querier.Get(context.Background(), fmt.Sprintf(MfaChallengeRedisKeyPattern, token)).Int64()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	return userId, nil
+}
+
+// Consume deletes challenge. False is returned if it was already consumed or expired
+func (r *MfaChallengeStorage) Consume(token string) (bool, error) {
+	if r.querier == nil {
+		return false, rds.ErrNotInitialized
+	}
+
+	deleted, err := r.querier.Del(context.Background(), fmt.Sprintf(MfaChallengeRedisKeyPattern, token)).Result()
+	if err != nil {
+		return false, err
+	}
+
+	return deleted == 1, nil
+}
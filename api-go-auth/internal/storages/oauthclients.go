@@ -0,0 +1,102 @@
+package storages
+
+import (
+	"auth/internal/models"
+	"auth/pkg/pgs"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"github.com/jackc/pgtype/pgxtype"
+)
+
+//TODO context
+
+type (
+	OAuthClientStorage struct {
+		querier pgxtype.Querier
+		key     []byte
+	}
+)
+
+// NewOAuthClientStorage creates storage that keeps only HMAC-SHA256 digests of client secrets computed with provided key
+func NewOAuthClientStorage(q pgxtype.Querier, key []byte) models.OAuthClientStorage {
+	return &OAuthClientStorage{querier: q, key: key}
+}
+
+func (r *OAuthClientStorage) hash(secret string) string {
+	h := hmac.New(sha256.New, r.key)
+	h.Write([]byte(secret))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// CreateAndStore saves client. Client is public if secret is empty
+func (r *OAuthClientStorage) CreateAndStore(client models.OAuthClient, secret string) error {
+	if r.querier == nil {
+		return pgs.ErrNotInitialized
+	}
+
+	var secretHash *string
+	if secret != "" {
+		hash := r.hash(secret)
+		secretHash = &hash
+	}
+
+	_, err := r.querier.Exec(context.Background(),
+		`INSERT INTO oauth_clients(id, "secretHash", name, "redirectUris", scopes, "grantTypes") VALUES ($1, $2, $3, $4, $5, $6)`,
+		client.Id, secretHash, client.Name, client.RedirectUris, client.Scopes, client.GrantTypes)
+	return err
+}
+
+func (r *OAuthClientStorage) Get(id string) (*models.OAuthClient, error) {
+	client, _, err := r.get(id)
+	return client, err
+}
+
+// Authenticate returns client only if secret matches. Public clients are authenticated by empty secret
+func (r *OAuthClientStorage) Authenticate(id, secret string) (*models.OAuthClient, error) {
+	client, secretHash, err := r.get(id)
+	if err != nil || client == nil {
+		return nil, err
+	}
+
+	if !client.IsConfidential {
+		if secret != "" {
+			return nil, nil
+		}
+		return client, nil
+	}
+
+	if subtle.ConstantTimeCompare([]byte(r.hash(secret)), []byte(secretHash)) != 1 {
+		return nil, nil
+	}
+
+	return client, nil
+}
+
+func (r *OAuthClientStorage) get(id string) (*models.OAuthClient, string, error) {
+	if r.querier == nil {
+		return nil, "", pgs.ErrNotInitialized
+	}
+
+	rows, err := r.querier.Query(context.Background(),
+		`SELECT id, COALESCE("secretHash", ''), name, "redirectUris", scopes, "grantTypes", "createdAt" FROM oauth_clients WHERE id = $1`, id)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var client *models.OAuthClient
+	var secretHash string
+	for rows.Next() {
+		client = &models.OAuthClient{}
+		err = rows.Scan(&client.Id, &secretHash, &client.Name, &client.RedirectUris, &client.Scopes, &client.GrantTypes,
+			&client.CreatedAt)
+		if err != nil {
+			return nil, "", err
+		}
+		client.IsConfidential = secretHash != ""
+	}
+
+	return client, secretHash, nil
+}
@@ -0,0 +1,64 @@
+package storages
+
+import (
+	"auth/internal/models"
+	"auth/pkg/rds"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-redis/redis/v9"
+	"time"
+)
+
+//TODO context
+
+const (
+	OAuthCodeRedisKeyPattern = "OAUTH_CODE_%s"
+)
+
+type (
+	OAuthCodeStorage struct {
+		querier *redis.Client
+	}
+)
+
+func NewOAuthCodeStorage(q *redis.Client) models.OAuthCodeStorage {
+	return &OAuthCodeStorage{querier: q}
+}
+
+func (r *OAuthCodeStorage) CreateAndStore(code string, data models.OAuthCode, lifetime time.Duration) error {
+	if r.querier == nil {
+		return rds.ErrNotInitialized
+	}
+
+	serialized, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	return r.querier.Set(context.Background(), fmt.Sprintf(OAuthCodeRedisKeyPattern, code), serialized, lifetime).Err()
+}
+
+// Consume returns code data and deletes it, so code can be exchanged only once. Nil is returned if code does not exist
+func (r *OAuthCodeStorage) Consume(code string) (*models.OAuthCode, error) {
+	if r.querier == nil {
+		return nil, rds.ErrNotInitialized
+	}
+
+	serialized, err := r.querier.GetDel(context.Background(), fmt.Sprintf(OAuthCodeRedisKeyPattern, code)).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var data models.OAuthCode
+	err = json.Unmarshal(serialized, &data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &data, nil
+}
@@ -4,6 +4,9 @@ import (
 	"auth/internal/models"
 	"auth/pkg/pgs"
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"github.com/jackc/pgtype/pgxtype"
 	"time"
 )
@@ -13,36 +16,64 @@ import (
 type (
 	RefreshTokenStorage struct {
 		querier pgxtype.Querier
+		key     []byte
 	}
 )
 
-func NewRefreshTokenStorage(q pgxtype.Querier) models.RefreshTokenStorage {
-	return &RefreshTokenStorage{querier: q}
+// NewRefreshTokenStorage creates storage that keeps only HMAC-SHA256 digests of tokens computed with provided key
+func NewRefreshTokenStorage(q pgxtype.Querier, key []byte) models.RefreshTokenStorage {
+	return &RefreshTokenStorage{querier: q, key: key}
 }
 
-func (r *RefreshTokenStorage) CreateAndStore(userId int64, tokenValue string) error {
+func (r *RefreshTokenStorage) hash(tokenValue string) string {
+	h := hmac.New(sha256.New, r.key)
+	h.Write([]byte(tokenValue))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// CreateAndStore saves first token of new session. Empty clientId means token is issued to user directly, not to OAuth client
+func (r *RefreshTokenStorage) CreateAndStore(userId int64, sessionId, clientId, scope, tokenValue string, device models.Device) error {
 	if r.querier == nil {
 		return pgs.ErrNotInitialized
 	}
 
-	_, err := r.querier.Exec(context.Background(), `INSERT INTO refresh_tokens("userId", token) VALUES ($1, $2)`,
-		userId, tokenValue)
+	_, err := r.querier.Exec(context.Background(),
+		`INSERT INTO refresh_tokens("userId", "sessionId", "clientId", scope, "userAgent", ip, "tokenHash") VALUES ($1, $2, NULLIF($3, ''), $4, $5, $6, $7)`,
+		userId, sessionId, clientId, scope, device.UserAgent, device.Ip, r.hash(tokenValue))
 
 	return err
 }
 
 func (r *RefreshTokenStorage) Get(tokenValue string, lifePeriod time.Duration) (*models.RefreshToken, error) {
+	refreshToken, err := r.Find(tokenValue, lifePeriod)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = r.querier.Exec(context.Background(),
+		`UPDATE refresh_tokens SET "lastUsedAt" = CURRENT_TIMESTAMP WHERE "tokenHash" = $1`, r.hash(tokenValue))
+	if err != nil {
+		return nil, err
+	}
+
+	return refreshToken, err
+}
+
+// Find returns active token like Get does, but does not prolong its life period
+func (r *RefreshTokenStorage) Find(tokenValue string, lifePeriod time.Duration) (*models.RefreshToken, error) {
 	if r.querier == nil {
 		return nil, pgs.ErrNotInitialized
 	}
 
+	tokenHash := r.hash(tokenValue)
+
 	lifePeriod = lifePeriod / time.Second
 	rows, err := r.querier.Query(context.Background(),
 		`SELECT u.id, u.email, u.login, u.password, u.role, u."createdAt",
-       			t.token, t."issuedAt", t."lastUsedAt", t."isRevoked"
+       			t."tokenHash", t."sessionId", COALESCE(t."clientId", ''), t.scope, t."userAgent", t.ip, t."issuedAt", t."lastUsedAt", t."rotatedAt", t."isRevoked"
 				FROM refresh_tokens AS t JOIN users AS u ON t."userId" = u.id
-				WHERE t.token = $1 AND EXTRACT(EPOCH FROM (CURRENT_TIMESTAMP - t."lastUsedAt")) < $2 AND t."isRevoked" IS FALSE`,
-		tokenValue, lifePeriod)
+				WHERE t."tokenHash" = $1 AND EXTRACT(EPOCH FROM (CURRENT_TIMESTAMP - t."lastUsedAt")) < $2 AND t."isRevoked" IS FALSE`,
+		tokenHash, lifePeriod)
 	if err != nil {
 		return nil, err
 	}
@@ -51,20 +82,88 @@ func (r *RefreshTokenStorage) Get(tokenValue string, lifePeriod time.Duration) (
 	for rows.Next() {
 		refreshToken = &models.RefreshToken{}
 		err = rows.Scan(&refreshToken.User.Id, &refreshToken.User.Email, &refreshToken.User.Login,
-			&refreshToken.User.Password, &refreshToken.User.Role, &refreshToken.User.CreatedAt, &refreshToken.Token,
-			&refreshToken.IssuedAt, &refreshToken.LastUsedAt, &refreshToken.IsRevoked)
+			&refreshToken.User.Password, &refreshToken.User.Role, &refreshToken.User.CreatedAt, &refreshToken.TokenHash,
+			&refreshToken.SessionId, &refreshToken.ClientId, &refreshToken.Scope, &refreshToken.UserAgent, &refreshToken.Ip,
+			&refreshToken.IssuedAt, &refreshToken.LastUsedAt, &refreshToken.RotatedAt, &refreshToken.IsRevoked)
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	_, err = r.querier.Exec(context.Background(),
-		`UPDATE refresh_tokens SET "lastUsedAt" = CURRENT_TIMESTAMP WHERE token = $1`, tokenValue)
+	return refreshToken, rows.Err()
+}
+
+// Rotate atomically revokes active token issued to clientId and issues a new one in the same session.
+// New token remembers device it was requested from. Returns new token or nil if provided token is not active
+func (r *RefreshTokenStorage) Rotate(tokenValue, newTokenValue, clientId string, device models.Device, lifePeriod time.Duration) (*models.RefreshToken, error) {
+	if r.querier == nil {
+		return nil, pgs.ErrNotInitialized
+	}
+
+	lifePeriod = lifePeriod / time.Second
+	rows, err := r.querier.Query(context.Background(),
+		`WITH old AS (
+					UPDATE refresh_tokens SET "isRevoked" = TRUE, "rotatedAt" = CURRENT_TIMESTAMP
+					WHERE "tokenHash" = $1 AND EXTRACT(EPOCH FROM (CURRENT_TIMESTAMP - "lastUsedAt")) < $3 AND "isRevoked" IS FALSE
+						AND COALESCE("clientId", '') = $4
+					RETURNING "userId", "sessionId", "clientId", scope
+				), new AS (
+					INSERT INTO refresh_tokens("userId", "sessionId", "clientId", scope, "userAgent", ip, "tokenHash")
+					SELECT "userId", "sessionId", "clientId", scope, $5, $6, $2 FROM old
+					RETURNING "userId", "tokenHash", "sessionId", "clientId", scope, "userAgent", ip, "issuedAt", "lastUsedAt", "rotatedAt", "isRevoked"
+				)
+				SELECT u.id, u.email, u.login, u.password, u.role, u."createdAt",
+       			t."tokenHash", t."sessionId", COALESCE(t."clientId", ''), t.scope, t."userAgent", t.ip, t."issuedAt", t."lastUsedAt", t."rotatedAt", t."isRevoked"
+				FROM new AS t JOIN users AS u ON t."userId" = u.id`,
+		r.hash(tokenValue), r.hash(newTokenValue), lifePeriod, clientId, device.UserAgent, device.Ip)
 	if err != nil {
 		return nil, err
 	}
 
-	return refreshToken, err
+	var refreshToken *models.RefreshToken
+	for rows.Next() {
+		refreshToken = &models.RefreshToken{}
+		err = rows.Scan(&refreshToken.User.Id, &refreshToken.User.Email, &refreshToken.User.Login,
+			&refreshToken.User.Password, &refreshToken.User.Role, &refreshToken.User.CreatedAt, &refreshToken.TokenHash,
+			&refreshToken.SessionId, &refreshToken.ClientId, &refreshToken.Scope, &refreshToken.UserAgent, &refreshToken.Ip,
+			&refreshToken.IssuedAt, &refreshToken.LastUsedAt, &refreshToken.RotatedAt, &refreshToken.IsRevoked)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return refreshToken, rows.Err()
+}
+
+// GetRotated returns token only if it has already been replaced by Rotate
+func (r *RefreshTokenStorage) GetRotated(tokenValue string) (*models.RefreshToken, error) {
+	if r.querier == nil {
+		return nil, pgs.ErrNotInitialized
+	}
+
+	rows, err := r.querier.Query(context.Background(),
+		`SELECT u.id, u.email, u.login, u.password, u.role, u."createdAt",
+       			t."tokenHash", t."sessionId", COALESCE(t."clientId", ''), t.scope, t."userAgent", t.ip, t."issuedAt", t."lastUsedAt", t."rotatedAt", t."isRevoked"
+				FROM refresh_tokens AS t JOIN users AS u ON t."userId" = u.id
+				WHERE t."tokenHash" = $1 AND t."rotatedAt" IS NOT NULL`,
+		r.hash(tokenValue))
+	if err != nil {
+		return nil, err
+	}
+
+	var refreshToken *models.RefreshToken
+	for rows.Next() {
+		refreshToken = &models.RefreshToken{}
+		err = rows.Scan(&refreshToken.User.Id, &refreshToken.User.Email, &refreshToken.User.Login,
+			&refreshToken.User.Password, &refreshToken.User.Role, &refreshToken.User.CreatedAt, &refreshToken.TokenHash,
+			&refreshToken.SessionId, &refreshToken.ClientId, &refreshToken.Scope, &refreshToken.UserAgent, &refreshToken.Ip,
+			&refreshToken.IssuedAt, &refreshToken.LastUsedAt, &refreshToken.RotatedAt, &refreshToken.IsRevoked)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return refreshToken, rows.Err()
 }
 
 func (r *RefreshTokenStorage) Revoke(tokenValue string) error {
@@ -73,7 +172,7 @@ func (r *RefreshTokenStorage) Revoke(tokenValue string) error {
 	}
 
 	_, err := r.querier.Exec(context.Background(),
-		`UPDATE refresh_tokens SET "isRevoked" = TRUE WHERE token = $1 AND "isRevoked" IS FALSE`, tokenValue)
+		`UPDATE refresh_tokens SET "isRevoked" = TRUE WHERE "tokenHash" = $1 AND "isRevoked" IS FALSE`, r.hash(tokenValue))
 	return err
 }
 
@@ -83,7 +182,7 @@ func (r *RefreshTokenStorage) RevokeAll(tokenValue string) error {
 	}
 
 	_, err := r.querier.Exec(context.Background(),
-		`UPDATE refresh_tokens SET "isRevoked" = TRUE WHERE "userId" = (SELECT "userId" FROM refresh_tokens WHERE token = $1) AND "isRevoked" IS FALSE`, tokenValue)
+		`UPDATE refresh_tokens SET "isRevoked" = TRUE WHERE "userId" = (SELECT "userId" FROM refresh_tokens WHERE "tokenHash" = $1) AND "isRevoked" IS FALSE`, r.hash(tokenValue))
 	return err
 }
 
@@ -93,7 +192,7 @@ func (r *RefreshTokenStorage) RevokeAllExceptCurrent(tokenValue string) error {
 	}
 
 	_, err := r.querier.Exec(context.Background(),
-		`UPDATE refresh_tokens SET "isRevoked" = TRUE WHERE "userId" = (SELECT "userId" FROM refresh_tokens WHERE token = $1) AND token != $1 AND "isRevoked" IS FALSE`, tokenValue)
+		`UPDATE refresh_tokens SET "isRevoked" = TRUE WHERE "userId" = (SELECT "userId" FROM refresh_tokens WHERE "tokenHash" = $1) AND "tokenHash" != $1 AND "isRevoked" IS FALSE`, r.hash(tokenValue))
 	return err
 }
 
@@ -105,3 +204,61 @@ func (r *RefreshTokenStorage) RevokeAllByUserId(userId int64) error {
 	_, err := r.querier.Exec(context.Background(), `UPDATE refresh_tokens SET "isRevoked" = TRUE WHERE "userId" = $1 AND "isRevoked" IS FALSE`, userId)
 	return err
 }
+
+func (r *RefreshTokenStorage) RevokeSession(sessionId string) error {
+	if r.querier == nil {
+		return pgs.ErrNotInitialized
+	}
+
+	_, err := r.querier.Exec(context.Background(), `UPDATE refresh_tokens SET "isRevoked" = TRUE WHERE "sessionId" = $1 AND "isRevoked" IS FALSE`, sessionId)
+	return err
+}
+
+// RevokeUserSession revokes session only if it belongs to user. False is returned if user has no such active session
+func (r *RefreshTokenStorage) RevokeUserSession(userId int64, sessionId string) (bool, error) {
+	if r.querier == nil {
+		return false, pgs.ErrNotInitialized
+	}
+
+	tag, err := r.querier.Exec(context.Background(),
+		`UPDATE refresh_tokens SET "isRevoked" = TRUE WHERE "userId" = $1 AND "sessionId" = $2 AND "isRevoked" IS FALSE`,
+		userId, sessionId)
+	if err != nil {
+		return false, err
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+// GetSessions returns active sessions of user ordered by last usage. Session start is issue time of its first token
+func (r *RefreshTokenStorage) GetSessions(userId int64, lifePeriod time.Duration) ([]models.Session, error) {
+	if r.querier == nil {
+		return nil, pgs.ErrNotInitialized
+	}
+
+	lifePeriod = lifePeriod / time.Second
+	rows, err := r.querier.Query(context.Background(),
+		`SELECT t."sessionId", COALESCE(t."clientId", ''), t."userAgent", t.ip, s."startedAt", t."lastUsedAt"
+				FROM refresh_tokens AS t JOIN (
+				    SELECT "sessionId", MIN("issuedAt") AS "startedAt" FROM refresh_tokens WHERE "userId" = $1 GROUP BY "sessionId"
+				) AS s ON t."sessionId" = s."sessionId"
+				WHERE t."userId" = $1 AND t."isRevoked" IS FALSE AND EXTRACT(EPOCH FROM (CURRENT_TIMESTAMP - t."lastUsedAt")) < $2
+				ORDER BY t."lastUsedAt" DESC`,
+		userId, lifePeriod)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := make([]models.Session, 0)
+	for rows.Next() {
+		var session models.Session
+		err = rows.Scan(&session.Id, &session.ClientId, &session.UserAgent, &session.Ip, &session.StartedAt,
+			&session.LastUsedAt)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions, nil
+}
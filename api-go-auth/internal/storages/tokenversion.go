@@ -0,0 +1,51 @@
+package storages
+
+import (
+	"auth/internal/models"
+	"auth/pkg/rds"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-redis/redis/v9"
+)
+
+//TODO context
+
+const (
+	TokenVersionRedisKeyPattern = "TOKEN_VERSION_USER_%d"
+)
+
+type (
+	// TokenVersionStorage keeps per user security stamp. Access tokens carrying another version are rejected
+	TokenVersionStorage struct {
+		querier *redis.Client
+	}
+)
+
+func NewTokenVersionStorage(q *redis.Client) models.TokenVersionStorage {
+	return &TokenVersionStorage{querier: q}
+}
+
+func (r *TokenVersionStorage) Get(userId int64) (int64, error) {
+	if r.querier == nil {
+		return 0, rds.ErrNotInitialized
+	}
+
+	version, err := r.querier.Get(context.Background(), fmt.Sprintf(TokenVersionRedisKeyPattern, userId)).Int64()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	return version, nil
+}
+
+func (r *TokenVersionStorage) Bump(userId int64) (int64, error) {
+	if r.querier == nil {
+		return 0, rds.ErrNotInitialized
+	}
+
+	return r.querier.Incr(context.Background(), fmt.Sprintf(TokenVersionRedisKeyPattern, userId)).Result()
+}
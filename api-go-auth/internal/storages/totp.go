@@ -0,0 +1,205 @@
+package storages
+
+import (
+	"auth/internal/models"
+	"auth/pkg/pgs"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/jackc/pgtype/pgxtype"
+)
+
+//TODO context
+
+type (
+	// TotpStorage keeps TOTP secrets encrypted with AES-256-GCM and HMAC-SHA256 digests of recovery codes
+	TotpStorage struct {
+		querier pgxtype.Querier
+		key     []byte
+	}
+)
+
+var (
+	ErrInvalidCiphertext = errors.New("invalid ciphertext")
+)
+
+// NewTotpStorage creates storage that derives encryption key from provided one
+func NewTotpStorage(q pgxtype.Querier, key []byte) models.TotpStorage {
+	derived := sha256.Sum256(key)
+	return &TotpStorage{querier: q, key: derived[:]}
+}
+
+func (r *TotpStorage) aead() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(r.key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encrypt returns nonce followed by ciphertext
+func (r *TotpStorage) encrypt(plaintext []byte) ([]byte, error) {
+	aead, err := r.aead()
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func (r *TotpStorage) decrypt(ciphertext []byte) ([]byte, error) {
+	aead, err := r.aead()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, ErrInvalidCiphertext
+	}
+
+	plaintext, err := aead.Open(nil, ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, ErrInvalidCiphertext
+	}
+
+	return plaintext, nil
+}
+
+func (r *TotpStorage) hash(code string) string {
+	h := hmac.New(sha256.New, r.key)
+	h.Write([]byte(code))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// CreateAndStore replaces not yet enabled secret. False is returned if TOTP is already enabled
+func (r *TotpStorage) CreateAndStore(userId int64, secret []byte) (bool, error) {
+	if r.querier == nil {
+		return false, pgs.ErrNotInitialized
+	}
+
+	encrypted, err := r.encrypt(secret)
+	if err != nil {
+		return false, err
+	}
+
+	tag, err := r.querier.Exec(context.Background(),
+		`INSERT INTO user_totp("userId", secret) VALUES ($1, $2)
+				ON CONFLICT ("userId") DO UPDATE SET secret = EXCLUDED.secret, "lastUsedStep" = 0, "createdAt" = CURRENT_TIMESTAMP
+				WHERE user_totp."isEnabled" IS FALSE`, userId, encrypted)
+	if err != nil {
+		return false, err
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+func (r *TotpStorage) Get(userId int64) (*models.Totp, error) {
+	if r.querier == nil {
+		return nil, pgs.ErrNotInitialized
+	}
+
+	rows, err := r.querier.Query(context.Background(),
+		`SELECT "userId", secret, "isEnabled", "lastUsedStep", "createdAt" FROM user_totp WHERE "userId" = $1`, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	var totp *models.Totp
+	for rows.Next() {
+		totp = &models.Totp{}
+		err = rows.Scan(&totp.UserId, &totp.Secret, &totp.IsEnabled, &totp.LastUsedStep, &totp.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if totp == nil {
+		return nil, nil
+	}
+
+	totp.Secret, err = r.decrypt(totp.Secret)
+	if err != nil {
+		return nil, err
+	}
+
+	return totp, nil
+}
+
+// Enable enables TOTP and replaces recovery codes. False is returned if it is already enabled or was not created
+func (r *TotpStorage) Enable(userId int64, recoveryCodes []string) (bool, error) {
+	if r.querier == nil {
+		return false, pgs.ErrNotInitialized
+	}
+
+	hashes := make([]string, len(recoveryCodes))
+	for i, code := range recoveryCodes {
+		hashes[i] = r.hash(code)
+	}
+
+	var enabled bool
+	err := r.querier.QueryRow(context.Background(),
+		`WITH enabled AS (
+					UPDATE user_totp SET "isEnabled" = TRUE WHERE "userId" = $1 AND "isEnabled" IS FALSE RETURNING "userId"
+				), deleted AS (
+					DELETE FROM user_recovery_codes WHERE "userId" IN (SELECT "userId" FROM enabled)
+				), inserted AS (
+					INSERT INTO user_recovery_codes("userId", "codeHash") SELECT e."userId", c FROM enabled AS e, UNNEST($2::TEXT[]) AS c
+				)
+				SELECT EXISTS(SELECT FROM enabled)`, userId, hashes).
+		Scan(&enabled)
+	if err != nil {
+		return false, err
+	}
+
+	return enabled, nil
+}
+
+func (r *TotpStorage) Disable(userId int64) error {
+	if r.querier == nil {
+		return pgs.ErrNotInitialized
+	}
+
+	_, err := r.querier.Exec(context.Background(),
+		`WITH deleted AS (DELETE FROM user_recovery_codes WHERE "userId" = $1) DELETE FROM user_totp WHERE "userId" = $1`, userId)
+	return err
+}
+
+// UseStep marks step as used. False is returned if this or later step was already used, so every code is accepted only once
+func (r *TotpStorage) UseStep(userId int64, step int64) (bool, error) {
+	if r.querier == nil {
+		return false, pgs.ErrNotInitialized
+	}
+
+	tag, err := r.querier.Exec(context.Background(),
+		`UPDATE user_totp SET "lastUsedStep" = $2 WHERE "userId" = $1 AND "lastUsedStep" < $2`, userId, step)
+	if err != nil {
+		return false, err
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+func (r *TotpStorage) UseRecoveryCode(userId int64, code string) (bool, error) {
+	if r.querier == nil {
+		return false, pgs.ErrNotInitialized
+	}
+
+	tag, err := r.querier.Exec(context.Background(),
+		`UPDATE user_recovery_codes SET "usedAt" = CURRENT_TIMESTAMP WHERE "userId" = $1 AND "codeHash" = $2 AND "usedAt" IS NULL`,
+		userId, r.hash(code))
+	if err != nil {
+		return false, err
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
@@ -2,11 +2,22 @@ package storages
 
 import (
 	"auth/internal/models"
+	"auth/pkg/passwords"
 	"auth/pkg/pgs"
 	"context"
-	"crypto/sha512"
-	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgconn"
 	"github.com/jackc/pgtype/pgxtype"
+	"github.com/jackc/pgx/v4"
+	"strings"
+)
+
+const (
+	uniqueViolationCode = "23505"
+
+	// isBanned is a condition on users row that is true if user has active ban
+	isBanned = `EXISTS(SELECT FROM bans AS b WHERE b."userId" = users.id AND b."liftedAt" IS NULL AND (b.until IS NULL OR b.until > CURRENT_TIMESTAMP))`
 )
 
 //TODO context
@@ -26,26 +37,62 @@ func (r *UserStorage) CreateAndStore(email, login, password string) error {
 		return pgs.ErrNotInitialized
 	}
 
-	h := sha512.New()
-	h.Write([]byte(password))
-	password = hex.EncodeToString(h.Sum(nil))
+	passwordHash, err := passwords.Hash(password)
+	if err != nil {
+		return err
+	}
 
-	_, err := r.querier.Exec(context.Background(), `INSERT INTO users(email, login, password) VALUES ($1, $2, $3)`,
-		email, login, password)
+	_, err = r.querier.Exec(context.Background(), `INSERT INTO users(email, login, password) VALUES ($1, $2, $3)`,
+		email, login, passwordHash)
 	return err
 }
 
+// GetByCredentials returns user only if password matches. Outdated password hashes are upgraded on success
 func (r *UserStorage) GetByCredentials(credentials models.UserCredentials) (*models.User, error) {
 	if r.querier == nil {
 		return nil, pgs.ErrNotInitialized
 	}
 
-	h := sha512.New()
-	h.Write([]byte(credentials.Password))
-	passwordHash := hex.EncodeToString(h.Sum(nil))
+	user, err := r.GetByLogin(credentials.Login)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		passwords.VerifyDummy(credentials.Password)
+		return nil, nil
+	}
+
+	ok, needsRehash, err := passwords.Verify(credentials.Password, user.Password)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, nil
+	}
+
+	if needsRehash {
+		passwordHash, err := passwords.Hash(credentials.Password)
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = r.querier.Exec(context.Background(), `UPDATE users SET password = $1 WHERE id = $2 AND password = $3`,
+			passwordHash, user.Id, user.Password)
+		if err != nil {
+			return nil, err
+		}
+		user.Password = passwordHash
+	}
+
+	return user, nil
+}
 
-	rows, err := r.querier.Query(context.Background(), `SELECT id, email, login, password, role, "createdAt" FROM users WHERE login = $1 AND password = $2`,
-		credentials.Login, passwordHash)
+func (r *UserStorage) GetByLogin(login string) (*models.User, error) {
+	if r.querier == nil {
+		return nil, pgs.ErrNotInitialized
+	}
+
+	rows, err := r.querier.Query(context.Background(), `SELECT id, email, login, password, role, "createdAt" FROM users WHERE login = $1`, login)
 	if err != nil {
 		return nil, err
 	}
@@ -84,6 +131,51 @@ func (r *UserStorage) GetById(userId int64) (*models.User, error) {
 	return user, nil
 }
 
+// GetByIdForUpdate locks row of user until end of transaction
+func (r *UserStorage) GetByIdForUpdate(userId int64) (*models.User, error) {
+	if r.querier == nil {
+		return nil, pgs.ErrNotInitialized
+	}
+
+	rows, err := r.querier.Query(context.Background(), `SELECT id, email, login, password, role, "createdAt" FROM users WHERE id = $1 FOR UPDATE`, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	var user *models.User
+	for rows.Next() {
+		user = &models.User{}
+		err = rows.Scan(&user.Id, &user.Email, &user.Login, &user.Password, &user.Role, &user.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return user, nil
+}
+
+func (r *UserStorage) GetByEmail(email string) (*models.User, error) {
+	if r.querier == nil {
+		return nil, pgs.ErrNotInitialized
+	}
+
+	rows, err := r.querier.Query(context.Background(), `SELECT id, email, login, password, role, "createdAt" FROM users WHERE email = $1`, email)
+	if err != nil {
+		return nil, err
+	}
+
+	var user *models.User
+	for rows.Next() {
+		user = &models.User{}
+		err = rows.Scan(&user.Id, &user.Email, &user.Login, &user.Password, &user.Role, &user.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return user, nil
+}
+
 func (r *UserStorage) EmailExists(email string) (bool, error) {
 	if r.querier == nil {
 		return false, pgs.ErrNotInitialized
@@ -123,3 +215,169 @@ func (r *UserStorage) ChangeRole(userId int64, newRole string) error {
 	_, err := r.querier.Exec(context.Background(), `UPDATE users SET role = $1 WHERE id = $2`, newRole, userId)
 	return err
 }
+
+func (r *UserStorage) SetPassword(userId int64, password string) error {
+	if r.querier == nil {
+		return pgs.ErrNotInitialized
+	}
+
+	passwordHash, err := passwords.Hash(password)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.querier.Exec(context.Background(), `UPDATE users SET password = $1 WHERE id = $2`, passwordHash, userId)
+	return err
+}
+
+// ChangePassword sets new password only if old one matches. False is returned if it does not
+func (r *UserStorage) ChangePassword(userId int64, oldPassword, newPassword string) (bool, error) {
+	if r.querier == nil {
+		return false, pgs.ErrNotInitialized
+	}
+
+	user, err := r.GetById(userId)
+	if err != nil {
+		return false, err
+	}
+	if user == nil {
+		passwords.VerifyDummy(oldPassword)
+		return false, nil
+	}
+
+	ok, _, err := passwords.Verify(oldPassword, user.Password)
+	if err != nil {
+		return false, err
+	}
+	if !ok {
+		return false, nil
+	}
+
+	passwordHash, err := passwords.Hash(newPassword)
+	if err != nil {
+		return false, err
+	}
+
+	tag, err := r.querier.Exec(context.Background(), `UPDATE users SET password = $1 WHERE id = $2 AND password = $3`,
+		passwordHash, userId, user.Password)
+	if err != nil {
+		return false, err
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+// ChangeEmail sets new email and returns previous one. Empty string is returned if email is already taken
+func (r *UserStorage) ChangeEmail(userId int64, email string) (string, error) {
+	if r.querier == nil {
+		return "", pgs.ErrNotInitialized
+	}
+
+	var oldEmail string
+	err := r.querier.QueryRow(context.Background(),
+		`UPDATE users AS u SET email = $1 FROM users AS old
+				WHERE u.id = $2 AND old.id = u.id AND NOT EXISTS(SELECT FROM users WHERE email = $1)
+				RETURNING old.email`, email, userId).
+		Scan(&oldEmail)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.Is(err, pgx.ErrNoRows) || (errors.As(err, &pgErr) && pgErr.Code == uniqueViolationCode) {
+			return "", nil
+		}
+		return "", err
+	}
+
+	return oldEmail, nil
+}
+
+// Search returns page of users matching query. Users are ordered by sorting field and then by id, so page after cursor
+// is stable even if sorting field values are not unique. Password hashes are not selected
+func (r *UserStorage) Search(query models.UserQuery) ([]models.UserSummary, error) {
+	if r.querier == nil {
+		return nil, pgs.ErrNotInitialized
+	}
+
+	conditions := make([]string, 0)
+	args := make([]interface{}, 0)
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if query.LoginPrefix != "" {
+		conditions = append(conditions, "login LIKE "+arg(likePrefix(query.LoginPrefix)))
+	}
+	if query.EmailPrefix != "" {
+		conditions = append(conditions, "email LIKE "+arg(likePrefix(query.EmailPrefix)))
+	}
+	if query.Role != "" {
+		conditions = append(conditions, "role = "+arg(string(query.Role)))
+	}
+	if query.Banned != nil {
+		if *query.Banned {
+			conditions = append(conditions, isBanned)
+		} else {
+			conditions = append(conditions, "NOT "+isBanned)
+		}
+	}
+	if !query.CreatedFrom.IsZero() {
+		conditions = append(conditions, `"createdAt" >= `+arg(query.CreatedFrom))
+	}
+	if !query.CreatedBefore.IsZero() {
+		conditions = append(conditions, `"createdAt" < `+arg(query.CreatedBefore))
+	}
+
+	comparison, direction := ">", "ASC"
+	if query.Descending {
+		comparison, direction = "<", "DESC"
+	}
+
+	var order string
+	switch query.SortBy {
+	case models.UserSortByLogin:
+		// Logins are unique, so id is not needed to break ties
+		order = "login " + direction
+		if query.After != nil {
+			conditions = append(conditions, "login "+comparison+" "+arg(query.After.Login))
+		}
+	case models.UserSortByCreatedAt:
+		order = `"createdAt" ` + direction + ", id " + direction
+		if query.After != nil {
+			conditions = append(conditions,
+				`("createdAt", id) `+comparison+" ("+arg(query.After.CreatedAt)+", "+arg(query.After.Id)+")")
+		}
+	default:
+		order = "id " + direction
+		if query.After != nil {
+			conditions = append(conditions, "id "+comparison+" "+arg(query.After.Id))
+		}
+	}
+
+	sql := `SELECT id, email, login, role, "createdAt", ` + isBanned + ` FROM users`
+	if len(conditions) > 0 {
+		sql += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	sql += " ORDER BY " + order + " LIMIT " + arg(query.Limit)
+
+	rows, err := r.querier.Query(context.Background(), sql, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	users := make([]models.UserSummary, 0, query.Limit)
+	for rows.Next() {
+		var user models.UserSummary
+		err = rows.Scan(&user.Id, &user.Email, &user.Login, &user.Role, &user.CreatedAt, &user.IsBanned)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+
+	return users, nil
+}
+
+// likePrefix makes LIKE pattern that matches strings starting with prefix. Wildcards of prefix are matched literally
+func likePrefix(prefix string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(prefix) + "%"
+}
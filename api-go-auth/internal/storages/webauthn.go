@@ -0,0 +1,95 @@
+package storages
+
+import (
+	"auth/internal/models"
+	"auth/pkg/pgs"
+	"context"
+	"github.com/jackc/pgtype/pgxtype"
+)
+
+//TODO context
+
+type (
+	WebauthnCredentialStorage struct {
+		querier pgxtype.Querier
+	}
+)
+
+func NewWebauthnCredentialStorage(q pgxtype.Querier) models.WebauthnCredentialStorage {
+	return &WebauthnCredentialStorage{querier: q}
+}
+
+// CreateAndStore saves credential. False is returned if credential with the same id is already registered
+func (r *WebauthnCredentialStorage) CreateAndStore(userId int64, id, publicKey []byte, signCount int64) (bool, error) {
+	if r.querier == nil {
+		return false, pgs.ErrNotInitialized
+	}
+
+	tag, err := r.querier.Exec(context.Background(),
+		`INSERT INTO webauthn_credentials(id, "userId", "publicKey", "signCount") VALUES ($1, $2, $3, $4) ON CONFLICT (id) DO NOTHING`,
+		id, userId, publicKey, signCount)
+	if err != nil {
+		return false, err
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+func (r *WebauthnCredentialStorage) Get(id []byte) (*models.WebauthnCredential, error) {
+	if r.querier == nil {
+		return nil, pgs.ErrNotInitialized
+	}
+
+	rows, err := r.querier.Query(context.Background(),
+		`SELECT id, "userId", "publicKey", "signCount", "createdAt", "lastUsedAt" FROM webauthn_credentials WHERE id = $1`, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var credential *models.WebauthnCredential
+	for rows.Next() {
+		credential = &models.WebauthnCredential{}
+		err = rows.Scan(&credential.Id, &credential.UserId, &credential.PublicKey, &credential.SignCount,
+			&credential.CreatedAt, &credential.LastUsedAt)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return credential, nil
+}
+
+func (r *WebauthnCredentialStorage) GetByUserId(userId int64) ([]models.WebauthnCredential, error) {
+	if r.querier == nil {
+		return nil, pgs.ErrNotInitialized
+	}
+
+	rows, err := r.querier.Query(context.Background(),
+		`SELECT id, "userId", "publicKey", "signCount", "createdAt", "lastUsedAt" FROM webauthn_credentials WHERE "userId" = $1`, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	var credentials []models.WebauthnCredential
+	for rows.Next() {
+		var credential models.WebauthnCredential
+		err = rows.Scan(&credential.Id, &credential.UserId, &credential.PublicKey, &credential.SignCount,
+			&credential.CreatedAt, &credential.LastUsedAt)
+		if err != nil {
+			return nil, err
+		}
+		credentials = append(credentials, credential)
+	}
+
+	return credentials, nil
+}
+
+func (r *WebauthnCredentialStorage) UpdateSignCount(id []byte, signCount int64) error {
+	if r.querier == nil {
+		return pgs.ErrNotInitialized
+	}
+
+	_, err := r.querier.Exec(context.Background(),
+		`UPDATE webauthn_credentials SET "signCount" = $2, "lastUsedAt" = CURRENT_TIMESTAMP WHERE id = $1`, id, signCount)
+	return err
+}
@@ -0,0 +1,64 @@
+package storages
+
+import (
+	"auth/internal/models"
+	"auth/pkg/rds"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-redis/redis/v9"
+	"time"
+)
+
+//TODO context
+
+const (
+	WebauthnSessionRedisKeyPattern = "WEBAUTHN_SESSION_%s"
+)
+
+type (
+	WebauthnSessionStorage struct {
+		querier *redis.Client
+	}
+)
+
+func NewWebauthnSessionStorage(q *redis.Client) models.WebauthnSessionStorage {
+	return &WebauthnSessionStorage{querier: q}
+}
+
+func (r *WebauthnSessionStorage) CreateAndStore(sessionId string, session models.WebauthnSession, lifetime time.Duration) error {
+	if r.querier == nil {
+		return rds.ErrNotInitialized
+	}
+
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+
+	return r.querier.Set(context.Background(), fmt.Sprintf(WebauthnSessionRedisKeyPattern, sessionId), data, lifetime).Err()
+}
+
+// Consume returns session and deletes it, so every challenge can be answered only once. Nil is returned if session does not exist
+func (r *WebauthnSessionStorage) Consume(sessionId string) (*models.WebauthnSession, error) {
+	if r.querier == nil {
+		return nil, rds.ErrNotInitialized
+	}
+
+	data, err := r.querier.GetDel(context.Background(), fmt.Sprintf(WebauthnSessionRedisKeyPattern, sessionId)).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var session models.WebauthnSession
+	err = json.Unmarshal(data, &session)
+	if err != nil {
+		return nil, err
+	}
+
+	return &session, nil
+}
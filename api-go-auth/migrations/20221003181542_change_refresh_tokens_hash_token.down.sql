@@ -0,0 +1,5 @@
+DELETE FROM refresh_tokens;
+ALTER TABLE refresh_tokens DROP COLUMN "tokenHash";
+ALTER TABLE refresh_tokens ADD COLUMN token VARCHAR(1024) NOT NULL;
+
+CREATE UNIQUE INDEX ON refresh_tokens(token);
\ No newline at end of file
@@ -0,0 +1,5 @@
+DELETE FROM refresh_tokens;
+ALTER TABLE refresh_tokens DROP COLUMN token;
+ALTER TABLE refresh_tokens ADD COLUMN "tokenHash" CHAR(64) NOT NULL;
+
+CREATE UNIQUE INDEX ON refresh_tokens("tokenHash");
\ No newline at end of file
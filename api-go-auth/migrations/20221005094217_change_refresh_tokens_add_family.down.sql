@@ -0,0 +1,2 @@
+ALTER TABLE refresh_tokens DROP COLUMN "rotatedAt";
+ALTER TABLE refresh_tokens DROP COLUMN "familyId";
\ No newline at end of file
@@ -0,0 +1,7 @@
+ALTER TABLE refresh_tokens ADD COLUMN "familyId" CHAR(32);
+UPDATE refresh_tokens SET "familyId" = md5("tokenHash");
+ALTER TABLE refresh_tokens ALTER COLUMN "familyId" SET NOT NULL;
+
+ALTER TABLE refresh_tokens ADD COLUMN "rotatedAt" TIMESTAMP DEFAULT NULL;
+
+CREATE INDEX ON refresh_tokens("familyId");
\ No newline at end of file
@@ -0,0 +1,15 @@
+CREATE TABLE user_totp (
+    "userId" INTEGER PRIMARY KEY REFERENCES users(id),
+    secret BYTEA NOT NULL,
+    "isEnabled" BOOLEAN DEFAULT FALSE NOT NULL,
+    "lastUsedStep" BIGINT DEFAULT 0 NOT NULL,
+    "createdAt" TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL
+);
+
+CREATE TABLE user_recovery_codes (
+    "userId" INTEGER NOT NULL REFERENCES users(id),
+    "codeHash" CHAR(64) NOT NULL,
+    "usedAt" TIMESTAMP DEFAULT NULL
+);
+
+CREATE UNIQUE INDEX ON user_recovery_codes("userId", "codeHash");
\ No newline at end of file
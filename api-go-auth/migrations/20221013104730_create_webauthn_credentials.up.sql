@@ -0,0 +1,10 @@
+CREATE TABLE webauthn_credentials (
+    id BYTEA PRIMARY KEY,
+    "userId" INTEGER NOT NULL REFERENCES users(id),
+    "publicKey" BYTEA NOT NULL,
+    "signCount" BIGINT DEFAULT 0 NOT NULL,
+    "createdAt" TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    "lastUsedAt" TIMESTAMP DEFAULT NULL
+);
+
+CREATE INDEX ON webauthn_credentials("userId");
\ No newline at end of file
@@ -0,0 +1,4 @@
+ALTER TABLE refresh_tokens DROP COLUMN scope;
+ALTER TABLE refresh_tokens DROP COLUMN "clientId";
+
+DROP TABLE oauth_clients;
\ No newline at end of file
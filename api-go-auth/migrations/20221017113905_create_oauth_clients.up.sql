@@ -0,0 +1,12 @@
+CREATE TABLE oauth_clients (
+    id VARCHAR(32) PRIMARY KEY,
+    "secretHash" CHAR(64) DEFAULT NULL,
+    name VARCHAR(64) NOT NULL,
+    "redirectUris" TEXT[] NOT NULL,
+    scopes TEXT[] NOT NULL,
+    "grantTypes" TEXT[] NOT NULL,
+    "createdAt" TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL
+);
+
+ALTER TABLE refresh_tokens ADD COLUMN "clientId" VARCHAR(32) DEFAULT NULL REFERENCES oauth_clients(id);
+ALTER TABLE refresh_tokens ADD COLUMN scope TEXT DEFAULT '' NOT NULL;
\ No newline at end of file
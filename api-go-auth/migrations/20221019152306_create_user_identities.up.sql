@@ -0,0 +1,10 @@
+CREATE TABLE user_identities (
+    provider VARCHAR(32) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    "userId" INTEGER NOT NULL REFERENCES users(id),
+    email VARCHAR(255) DEFAULT NULL,
+    "createdAt" TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    PRIMARY KEY (provider, subject)
+);
+
+CREATE INDEX ON user_identities("userId");
\ No newline at end of file
@@ -0,0 +1,3 @@
+ALTER TABLE refresh_tokens RENAME COLUMN "sessionId" TO "familyId";
+ALTER TABLE refresh_tokens DROP COLUMN "userAgent";
+ALTER TABLE refresh_tokens DROP COLUMN ip;
\ No newline at end of file
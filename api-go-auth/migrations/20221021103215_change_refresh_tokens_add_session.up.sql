@@ -0,0 +1,4 @@
+ALTER TABLE refresh_tokens RENAME COLUMN "familyId" TO "sessionId";
+
+ALTER TABLE refresh_tokens ADD COLUMN "userAgent" VARCHAR(256) DEFAULT '' NOT NULL;
+ALTER TABLE refresh_tokens ADD COLUMN ip VARCHAR(64) DEFAULT '' NOT NULL;
\ No newline at end of file
@@ -0,0 +1 @@
+DROP TABLE bans;
\ No newline at end of file
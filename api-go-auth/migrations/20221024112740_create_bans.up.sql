@@ -0,0 +1,13 @@
+CREATE TABLE bans (
+    id SERIAL PRIMARY KEY,
+    "userId" INTEGER NOT NULL REFERENCES users(id),
+    "byUserId" INTEGER NOT NULL REFERENCES users(id),
+    reason VARCHAR(256) NOT NULL,
+    "at" TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    until TIMESTAMP NOT NULL,
+    "liftedByUserId" INTEGER DEFAULT NULL REFERENCES users(id),
+    "liftedAt" TIMESTAMP DEFAULT NULL
+);
+
+CREATE INDEX ON bans("userId", "at");
+CREATE INDEX ON bans("userId") WHERE "liftedAt" IS NULL;
\ No newline at end of file
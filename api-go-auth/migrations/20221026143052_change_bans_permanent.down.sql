@@ -0,0 +1,2 @@
+UPDATE bans SET until = 'infinity' WHERE until IS NULL;
+ALTER TABLE bans ALTER COLUMN until SET NOT NULL;
\ No newline at end of file
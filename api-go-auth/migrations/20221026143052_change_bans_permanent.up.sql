@@ -0,0 +1 @@
+ALTER TABLE bans ALTER COLUMN until DROP NOT NULL;
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE bans DROP COLUMN "issuerRole";
\ No newline at end of file
@@ -0,0 +1,3 @@
+ALTER TABLE bans ADD COLUMN "issuerRole" "Role";
+UPDATE bans SET "issuerRole" = users.role FROM users WHERE users.id = bans."byUserId";
+ALTER TABLE bans ALTER COLUMN "issuerRole" SET NOT NULL;
\ No newline at end of file
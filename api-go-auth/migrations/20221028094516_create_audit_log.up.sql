@@ -0,0 +1,17 @@
+CREATE TABLE audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    "actorId" INTEGER NOT NULL REFERENCES users(id),
+    "actorRole" "Role" NOT NULL,
+    "targetId" INTEGER DEFAULT NULL REFERENCES users(id),
+    action VARCHAR(32) NOT NULL,
+    "oldValue" JSONB DEFAULT NULL,
+    "newValue" JSONB DEFAULT NULL,
+    ip VARCHAR(64) NOT NULL,
+    "requestId" VARCHAR(32) NOT NULL,
+    "createdAt" TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL
+);
+
+CREATE INDEX ON audit_log("actorId", id);
+CREATE INDEX ON audit_log("targetId", id);
+CREATE INDEX ON audit_log(action, id);
+CREATE INDEX ON audit_log("createdAt");
\ No newline at end of file
@@ -0,0 +1,145 @@
+package jwt
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+const (
+	jtiLength = 16
+)
+
+type (
+	// Audience is serialized as a single string when it contains one value and as an array otherwise
+	Audience []string
+
+	// Validator describes registered claims checks performed by Parse. Empty Issuer and Audience are not checked,
+	// empty Algorithms allows every supported algorithm. Leeway is measured in seconds
+	Validator struct {
+		Issuer     string   `json:"issuer"`
+		Audience   string   `json:"audience"`
+		Leeway     int64    `json:"leeway"`
+		Algorithms []string `json:"algorithms"`
+	}
+)
+
+func (a Audience) MarshalJSON() ([]byte, error) {
+	if len(a) == 1 {
+		return json.Marshal(a[0])
+	}
+	return json.Marshal([]string(a))
+}
+
+func (a *Audience) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*a = nil
+		return nil
+	}
+
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = Audience{single}
+		return nil
+	}
+
+	var multiple []string
+	err := json.Unmarshal(data, &multiple)
+	if err != nil {
+		return ErrMalformed
+	}
+	*a = multiple
+	return nil
+}
+
+func (a Audience) Contains(audience string) bool {
+	for i := range a {
+		if a[i] == audience {
+			return true
+		}
+	}
+	return false
+}
+
+// NewClaims returns claims of token issued now for provided user. Every token gets unique random id
+func NewClaims(userId int64, role string) Claims {
+	issueTime := time.Now().Unix()
+
+	return Claims{
+		Sub: userId,
+		Rol: role,
+		Exp: issueTime + TokenLifetime,
+		Nbf: issueTime,
+		Iat: issueTime,
+		Jti: NewJti(),
+	}
+}
+
+// NewIdClaims returns claims of ID token issued now for provided user to OAuth client
+func NewIdClaims(userId int64, clientId string) IdClaims {
+	issueTime := time.Now().Unix()
+
+	return IdClaims{
+		Sub: strconv.FormatInt(userId, 10),
+		Aud: Audience{clientId},
+		Exp: issueTime + TokenLifetime,
+		Iat: issueTime,
+	}
+}
+
+// NewJti returns random hex encoded token id
+func NewJti() string {
+	b := make([]byte, jtiLength)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func (v Validator) allowed(alg string) bool {
+	if alg != AlgHS256 && alg != AlgRS256 && alg != AlgES256 && alg != AlgEdDSA {
+		return false
+	}
+
+	if len(v.Algorithms) == 0 {
+		return true
+	}
+
+	for i := range v.Algorithms {
+		if v.Algorithms[i] == alg {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks time based claims with leeway, issuer and audience
+func (v Validator) Validate(claims Claims) error {
+	now := time.Now().Unix()
+
+	if claims.Exp == 0 || claims.Iat == 0 {
+		return ErrMissingClaim
+	}
+
+	if now-v.Leeway >= claims.Exp {
+		return ErrExpired
+	}
+
+	if claims.Nbf != 0 && now+v.Leeway < claims.Nbf {
+		return ErrNotYetValid
+	}
+
+	if now+v.Leeway < claims.Iat || claims.Exp <= claims.Iat {
+		return ErrInvalidIssueTime
+	}
+
+	if v.Issuer != "" && claims.Iss != v.Issuer {
+		return ErrInvalidIssuer
+	}
+
+	if v.Audience != "" && !claims.Aud.Contains(v.Audience) {
+		return ErrInvalidAudience
+	}
+
+	return nil
+}
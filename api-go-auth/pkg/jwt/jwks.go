@@ -0,0 +1,134 @@
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"math/big"
+)
+
+type (
+	// JWK is a public key representation according to RFC 7517
+	JWK struct {
+		Kty string `json:"kty"`
+		Kid string `json:"kid,omitempty"`
+		Use string `json:"use,omitempty"`
+		Alg string `json:"alg,omitempty"`
+		Crv string `json:"crv,omitempty"`
+		N   string `json:"n,omitempty"`
+		E   string `json:"e,omitempty"`
+		X   string `json:"x,omitempty"`
+		Y   string `json:"y,omitempty"`
+	}
+
+	JWKS struct {
+		Keys []JWK `json:"keys"`
+	}
+)
+
+// JWK returns public part of the key. Symmetric keys are never published, so false is returned for them
+func (k *Key) JWK() (JWK, bool) {
+	enc := base64.RawURLEncoding
+
+	jwk := JWK{
+		Kid: k.id,
+		Use: "sig",
+		Alg: k.alg,
+	}
+
+	switch pub := k.public.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = enc.EncodeToString(pub.N.Bytes())
+		jwk.E = enc.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	case *ecdsa.PublicKey:
+		jwk.Kty = "EC"
+		jwk.Crv = pub.Curve.Params().Name
+		x, y := make([]byte, es256KeySize), make([]byte, es256KeySize)
+		pub.X.FillBytes(x)
+		pub.Y.FillBytes(y)
+		jwk.X = enc.EncodeToString(x)
+		jwk.Y = enc.EncodeToString(y)
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = enc.EncodeToString(pub)
+	default:
+		return JWK{}, false
+	}
+
+	return jwk, true
+}
+
+// NewJWKS builds key set containing public parts of provided keys
+func NewJWKS(keys ...*Key) JWKS {
+	jwks := JWKS{Keys: make([]JWK, 0, len(keys))}
+	for _, key := range keys {
+		if jwk, ok := key.JWK(); ok {
+			jwks.Keys = append(jwks.Keys, jwk)
+		}
+	}
+	return jwks
+}
+
+// KeyFromJWK creates verification key from its public JWK. Algorithm is derived from key type if it is not specified
+func KeyFromJWK(jwk JWK) (*Key, error) {
+	enc := base64.RawURLEncoding
+
+	var public interface{}
+	var alg string
+	switch jwk.Kty {
+	case "RSA":
+		n, err := enc.DecodeString(jwk.N)
+		if err != nil {
+			return nil, ErrInvalidKey
+		}
+		e, err := enc.DecodeString(jwk.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return nil, ErrInvalidKey
+		}
+		public = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		alg = AlgRS256
+	case "EC":
+		if jwk.Crv != elliptic.P256().Params().Name {
+			return nil, ErrInvalidKey
+		}
+		x, err := enc.DecodeString(jwk.X)
+		if err != nil || len(x) != es256KeySize {
+			return nil, ErrInvalidKey
+		}
+		y, err := enc.DecodeString(jwk.Y)
+		if err != nil || len(y) != es256KeySize {
+			return nil, ErrInvalidKey
+		}
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, ErrInvalidKey
+		}
+		public = pub
+		alg = AlgES256
+	case "OKP":
+		x, err := enc.DecodeString(jwk.X)
+		if jwk.Crv != "Ed25519" || err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, ErrInvalidKey
+		}
+		public = ed25519.PublicKey(x)
+		alg = AlgEdDSA
+	default:
+		return nil, ErrUnsupportedAlgorithm
+	}
+
+	if jwk.Alg != "" && jwk.Alg != alg {
+		return nil, ErrUnsupportedAlgorithm
+	}
+
+	key, err := NewAsymmetricKey(alg, public)
+	if err != nil {
+		return nil, err
+	}
+
+	key.id = jwk.Kid
+	return key, nil
+}
@@ -2,14 +2,10 @@ package jwt
 
 import (
 	"auth/pkg/utils"
-	"crypto/hmac"
-	"crypto/sha256"
-	_ "embed"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"strings"
-	"time"
 )
 
 const (
@@ -20,117 +16,174 @@ type (
 	Header struct {
 		Alg string `json:"alg"`
 		Typ string `json:"typ"`
+		Kid string `json:"kid,omitempty"`
 	}
 	Claims struct {
-		Sub int64  `json:"sub"`
-		Rol string `json:"rol"`
-		Exp int64  `json:"exp"`
-		Iat int64  `json:"iat"`
+		Iss string   `json:"iss,omitempty"`
+		Sub int64    `json:"sub"`
+		Aud Audience `json:"aud,omitempty"`
+		Rol string   `json:"rol"`
+		Ver int64    `json:"ver"`
+		Exp int64    `json:"exp"`
+		Nbf int64    `json:"nbf,omitempty"`
+		Iat int64    `json:"iat"`
+		Jti string   `json:"jti,omitempty"`
+		// Sid is an id of login session that token was issued in
+		Sid string `json:"sid,omitempty"`
+		// Scope and ClientId are set only for tokens issued to OAuth clients
+		Scope    string `json:"scope,omitempty"`
+		ClientId string `json:"client_id,omitempty"`
+	}
+	// KeySet provides verification key by its id
+	KeySet interface {
+		Get(kid string) (*Key, bool)
+	}
+	// IdClaims are claims of OpenID Connect ID token. Unlike access token subject is a string as required by OIDC
+	IdClaims struct {
+		Iss               string   `json:"iss"`
+		Sub               string   `json:"sub"`
+		Aud               Audience `json:"aud"`
+		Exp               int64    `json:"exp"`
+		Iat               int64    `json:"iat"`
+		Nonce             string   `json:"nonce,omitempty"`
+		Email             string   `json:"email,omitempty"`
+		EmailVerified     bool     `json:"email_verified,omitempty"`
+		PreferredUsername string   `json:"preferred_username,omitempty"`
 	}
 )
 
 var (
-	//go:embed SECRET.KEY
-	key []byte
-
-	errorInvalidJwtParts  = errors.New("JWT should contain 3 parts")
-	errorInvalidSignature = errors.New("JWT signature invalid")
-	errorExpired          = errors.New("JWT expired")
+	ErrMalformed           = errors.New("JWT malformed")
+	ErrInvalidSignature    = errors.New("JWT signature invalid")
+	ErrUnexpectedAlgorithm = errors.New("JWT algorithm is not allowed")
+	ErrUnknownKey          = errors.New("JWT key id is unknown")
+	ErrMissingClaim        = errors.New("JWT required claim is missing")
+	ErrExpired             = errors.New("JWT expired")
+	ErrNotYetValid         = errors.New("JWT is not valid yet")
+	ErrInvalidIssueTime    = errors.New("JWT issue time invalid")
+	ErrInvalidIssuer       = errors.New("JWT issuer invalid")
+	ErrInvalidAudience     = errors.New("JWT audience invalid")
 )
 
-// Create generates a valid JWT. Returns JWT string, expiration timestamp and issue timestamp
-func Create(userId int64, role string) (string, int64, int64) {
-	header := Header{
-		Alg: "HS256",
-		Typ: "JWT",
-	}
+// Create generates a valid JWT with provided claims signed with current signing key of the ring
+func Create(keys *KeyRing, claims Claims) (string, error) {
+	return create(keys, claims)
+}
 
-	issueTime := time.Now().Unix()
+// CreateIdToken generates ID token with provided claims signed with current signing key of the ring
+func CreateIdToken(keys *KeyRing, claims IdClaims) (string, error) {
+	return create(keys, claims)
+}
+
+func create(keys *KeyRing, claims interface{}) (string, error) {
+	key := keys.Signing()
 
-	claims := Claims{
-		Sub: userId,
-		Rol: role,
-		Exp: issueTime + TokenLifetime,
-		Iat: issueTime,
+	header := Header{
+		Alg: key.Alg(),
+		Typ: "JWT",
+		Kid: key.Id(),
 	}
 
 	hBytes, _ := json.Marshal(header)
 	cBytes, _ := json.Marshal(claims)
 
 	enc := base64.URLEncoding.WithPadding(base64.NoPadding)
-	hsh := sha256.New()
-
-	hEncSize, cEncSize, sEncSize := enc.EncodedLen(len(hBytes)), enc.EncodedLen(len(cBytes)), enc.EncodedLen(hsh.Size())
-	jwtSize := hEncSize + 1 + cEncSize + 1 + sEncSize
 
-	buf := make([]byte, jwtSize)
+	hEncSize, cEncSize := enc.EncodedLen(len(hBytes)), enc.EncodedLen(len(cBytes))
+	buf := make([]byte, hEncSize+1+cEncSize)
 
 	buf[hEncSize] = '.'
-	buf[hEncSize+1+cEncSize] = '.'
 
 	enc.Encode(buf[:hEncSize], hBytes)
 	enc.Encode(buf[hEncSize+1:], cBytes)
 
-	h := hmac.New(sha256.New, key)
-	h.Write(buf[:hEncSize+1+cEncSize])
+	signature, err := key.sign(buf)
+	if err != nil {
+		return "", err
+	}
+
+	sEncSize := enc.EncodedLen(len(signature))
+	buf = append(buf, make([]byte, 1+sEncSize)...)
+	buf[hEncSize+1+cEncSize] = '.'
 
-	enc.Encode(buf[hEncSize+1+cEncSize+1:], h.Sum(nil))
+	enc.Encode(buf[hEncSize+1+cEncSize+1:], signature)
 
-	return utils.BytesToString(buf),
-		issueTime + TokenLifetime,
-		issueTime
+	return utils.BytesToString(buf), nil
 }
 
-// Parse tries to parse jwt string and returns its header and claims
-func Parse(jwt string) (Header, Claims, error) {
-	jwtParts := strings.Split(jwt, ".")
-	if len(jwtParts) != 3 {
-		return Header{}, Claims{}, errorInvalidJwtParts
+// Parse tries to parse jwt string, verifies its signature with key from the ring selected by kid header,
+// validates claims and returns header and claims. Returned errors are one of exported Err* values
+func Parse(jwt string, keys *KeyRing, validator Validator) (Header, Claims, error) {
+	header, claimsBytes, err := verify(jwt, keys, validator.allowed)
+	if err != nil {
+		return Header{}, Claims{}, err
 	}
 
-	enc := base64.URLEncoding.WithPadding(base64.NoPadding)
-
-	h := hmac.New(sha256.New, key)
-	h.Write([]byte(jwtParts[0] + "." + jwtParts[1]))
-	signature := enc.EncodeToString(h.Sum(nil))
+	var claims Claims
+	err = json.Unmarshal(claimsBytes, &claims)
+	if err != nil {
+		return Header{}, Claims{}, ErrMalformed
+	}
 
-	if signature != jwtParts[2] {
-		return Header{}, Claims{}, errorInvalidSignature
+	err = validator.Validate(claims)
+	if err != nil {
+		return Header{}, Claims{}, err
 	}
 
-	if i := len(jwtParts[0]) % 4; i != 0 {
-		jwtParts[0] += strings.Repeat("=", 4-i)
+	return header, claims, nil
+}
+
+// Verify checks signature of jwt with key selected by kid header and returns header and raw claims
+// without validating them. It is intended for tokens with claims other than Claims, e.g. ID tokens of external providers
+func Verify(jwt string, keys KeySet) (Header, []byte, error) {
+	return verify(jwt, keys, Validator{}.allowed)
+}
+
+func verify(jwt string, keys KeySet, allowed func(alg string) bool) (Header, []byte, error) {
+	jwtParts := strings.Split(jwt, ".")
+	if len(jwtParts) != 3 {
+		return Header{}, nil, ErrMalformed
 	}
 
-	headerBytes, err := base64.URLEncoding.DecodeString(jwtParts[0])
+	enc := base64.URLEncoding.WithPadding(base64.NoPadding)
+
+	headerBytes, err := enc.DecodeString(jwtParts[0])
 	if err != nil {
-		return Header{}, Claims{}, err
+		return Header{}, nil, ErrMalformed
 	}
 
 	var header Header
 	err = json.Unmarshal(headerBytes, &header)
 	if err != nil {
-		return Header{}, Claims{}, err
+		return Header{}, nil, ErrMalformed
 	}
 
-	if i := len(jwtParts[1]) % 4; i != 0 {
-		jwtParts[1] += strings.Repeat("=", 4-i)
+	if !allowed(header.Alg) {
+		return Header{}, nil, ErrUnexpectedAlgorithm
 	}
 
-	claimsBytes, err := base64.URLEncoding.DecodeString(jwtParts[1])
-	if err != nil {
-		return Header{}, Claims{}, err
+	key, ok := keys.Get(header.Kid)
+	if !ok {
+		return Header{}, nil, ErrUnknownKey
 	}
 
-	var claims Claims
-	err = json.Unmarshal(claimsBytes, &claims)
+	if header.Alg != key.Alg() {
+		return Header{}, nil, ErrUnexpectedAlgorithm
+	}
+
+	signature, err := enc.DecodeString(jwtParts[2])
 	if err != nil {
-		return Header{}, Claims{}, err
+		return Header{}, nil, ErrInvalidSignature
 	}
 
-	if time.Unix(claims.Exp, 0).Before(time.Now()) {
-		return Header{}, Claims{}, errorExpired
+	if !key.verify([]byte(jwtParts[0]+"."+jwtParts[1]), signature) {
+		return Header{}, nil, ErrInvalidSignature
 	}
 
-	return header, claims, nil
+	claimsBytes, err := enc.DecodeString(jwtParts[1])
+	if err != nil {
+		return Header{}, nil, ErrMalformed
+	}
+
+	return header, claimsBytes, nil
 }
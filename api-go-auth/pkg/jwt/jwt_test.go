@@ -1,29 +1,398 @@
 package jwt
 
 import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"os"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
+func singleKeyRing(key *Key) *KeyRing {
+	return &KeyRing{signing: key, keys: map[string]*Key{key.Id(): key}}
+}
+
+func testKeys(t *testing.T) []*Key {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("UNEXPECTED ERROR: %v", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("UNEXPECTED ERROR: %v", err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("UNEXPECTED ERROR: %v", err)
+	}
+
+	keys := make([]*Key, 0, 4)
+
+	hsKey, err := ParseKey(AlgHS256, []byte("secret"))
+	if err != nil {
+		t.Fatalf("UNEXPECTED ERROR: %v", err)
+	}
+	hsKey.id = AlgHS256
+	keys = append(keys, hsKey)
+
+	for alg, private := range map[string]interface{}{AlgRS256: rsaKey, AlgES256: ecKey, AlgEdDSA: edKey} {
+		der, err := x509.MarshalPKCS8PrivateKey(private)
+		if err != nil {
+			t.Fatalf("UNEXPECTED ERROR: %v", err)
+		}
+
+		key, err := ParseKey(alg, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+		if err != nil {
+			t.Fatalf("UNEXPECTED ERROR FOR %s: %v", alg, err)
+		}
+		key.id = alg
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
 func TestJWT(t *testing.T) {
-	jwt, exp, iat := Create(1, "CREATOR")
+	for _, key := range testKeys(t) {
+		keys := singleKeyRing(key)
+
+		validClaims := NewClaims(1, "CREATOR")
+		validClaims.Iss = "https://auth.example.com"
+		validClaims.Aud = Audience{"example.com"}
+
+		if validClaims.Exp != validClaims.Iat+TokenLifetime {
+			t.Fatalf("INVALID EXPIRATION TIME. EXPECTED %d GOT %d", validClaims.Iat+TokenLifetime, validClaims.Exp)
+		}
+
+		if len(validClaims.Jti) != 2*jtiLength || validClaims.Jti == NewClaims(1, "CREATOR").Jti {
+			t.Fatalf("INVALID JTI: %s", validClaims.Jti)
+		}
+
+		jwt, err := Create(keys, validClaims)
+		if err != nil {
+			t.Fatalf("UNEXPECTED ERROR FOR %s: %v", key.Alg(), err)
+		}
+
+		header, claims, err := Parse(jwt, keys, Validator{Issuer: "https://auth.example.com", Audience: "example.com"})
+		if err != nil {
+			t.Fatalf("UNEXPECTED ERROR FOR %s: %v", key.Alg(), err)
+		}
+
+		if header.Alg != key.Alg() || header.Kid != key.Id() {
+			t.Fatalf("INVALID HEADER. EXPECTED %s %s GOT %s %s", key.Alg(), key.Id(), header.Alg, header.Kid)
+		}
+
+		if !reflect.DeepEqual(claims, validClaims) {
+			t.Fatalf("INVALID CLAIMS. EXPECTED %v GOT %v", validClaims, claims)
+		}
+
+		parts := strings.Split(jwt, ".")
+		tampered := parts[0] + "." + parts[1] + "." + strings.Repeat("A", len(parts[2]))
+		_, _, err = Parse(tampered, keys, Validator{})
+		if err != ErrInvalidSignature {
+			t.Fatalf("INVALID ERROR FOR %s. EXPECTED %v GOT %v", key.Alg(), ErrInvalidSignature, err)
+		}
+	}
+}
+
+func TestAlgorithmMismatch(t *testing.T) {
+	keys := testKeys(t)
+
+	jwt, err := Create(singleKeyRing(keys[0]), NewClaims(1, "CREATOR"))
+	if err != nil {
+		t.Fatalf("UNEXPECTED ERROR: %v", err)
+	}
+
+	_, _, err = Parse(jwt, singleKeyRing(keys[0]), Validator{Algorithms: []string{AlgES256}})
+	if err != ErrUnexpectedAlgorithm {
+		t.Fatalf("INVALID ERROR. EXPECTED %v GOT %v", ErrUnexpectedAlgorithm, err)
+	}
+
+	for _, key := range keys[1:] {
+		key.id = keys[0].Id()
+		_, _, err = Parse(jwt, singleKeyRing(key), Validator{})
+		if err != ErrUnexpectedAlgorithm {
+			t.Fatalf("INVALID ERROR FOR %s. EXPECTED %v GOT %v", key.Alg(), ErrUnexpectedAlgorithm, err)
+		}
+	}
+
+	enc := base64.RawURLEncoding
+	unsigned := enc.EncodeToString([]byte(`{"alg":"none","typ":"JWT","kid":"HS256"}`)) + "." +
+		strings.Split(jwt, ".")[1] + "."
+	_, _, err = Parse(unsigned, singleKeyRing(keys[0]), Validator{})
+	if err != ErrUnexpectedAlgorithm {
+		t.Fatalf("INVALID ERROR. EXPECTED %v GOT %v", ErrUnexpectedAlgorithm, err)
+	}
+}
+
+func TestValidator(t *testing.T) {
+	keys := singleKeyRing(testKeys(t)[0])
+	now := time.Now().Unix()
+
+	tests := []struct {
+		claims    Claims
+		validator Validator
+		err       error
+	}{
+		{Claims{Sub: 1, Exp: now - 10, Iat: now - 100}, Validator{}, ErrExpired},
+		{Claims{Sub: 1, Exp: now - 10, Iat: now - 100}, Validator{Leeway: 30}, nil},
+		{Claims{Sub: 1, Exp: now + 100, Nbf: now + 60, Iat: now}, Validator{}, ErrNotYetValid},
+		{Claims{Sub: 1, Exp: now + 100, Nbf: now + 20, Iat: now}, Validator{Leeway: 30}, nil},
+		{Claims{Sub: 1, Exp: now + 100, Iat: now + 60}, Validator{}, ErrInvalidIssueTime},
+		{Claims{Sub: 1, Exp: now + 100}, Validator{}, ErrMissingClaim},
+		{Claims{Sub: 1, Iat: now}, Validator{}, ErrMissingClaim},
+		{Claims{Iss: "other", Sub: 1, Exp: now + 100, Iat: now}, Validator{Issuer: "issuer"}, ErrInvalidIssuer},
+		{Claims{Iss: "issuer", Sub: 1, Exp: now + 100, Iat: now}, Validator{Issuer: "issuer"}, nil},
+		{Claims{Sub: 1, Exp: now + 100, Iat: now}, Validator{Audience: "aud"}, ErrInvalidAudience},
+		{Claims{Sub: 1, Aud: Audience{"other", "aud"}, Exp: now + 100, Iat: now}, Validator{Audience: "aud"}, nil},
+	}
+
+	for i, test := range tests {
+		jwt, err := Create(keys, test.claims)
+		if err != nil {
+			t.Fatalf("UNEXPECTED ERROR: %v", err)
+		}
+
+		_, _, err = Parse(jwt, keys, test.validator)
+		if err != test.err {
+			t.Fatalf("INVALID ERROR FOR #%d. EXPECTED %v GOT %v", i, test.err, err)
+		}
+	}
+
+	for _, jwt := range []string{"", "a.b", "a.b.c", "e30.e30.e30"} {
+		_, _, err := Parse(jwt, keys, Validator{})
+		if err == nil {
+			t.Fatalf("EXPECTED ERROR FOR %q", jwt)
+		}
+	}
+}
+
+func TestAudience(t *testing.T) {
+	var claims Claims
+	err := json.Unmarshal([]byte(`{"aud":"single"}`), &claims)
+	if err != nil || !reflect.DeepEqual(claims.Aud, Audience{"single"}) {
+		t.Fatalf("INVALID AUDIENCE. GOT %v %v", claims.Aud, err)
+	}
+
+	err = json.Unmarshal([]byte(`{"aud":["first","second"]}`), &claims)
+	if err != nil || !reflect.DeepEqual(claims.Aud, Audience{"first", "second"}) {
+		t.Fatalf("INVALID AUDIENCE. GOT %v %v", claims.Aud, err)
+	}
+
+	raw, _ := json.Marshal(Claims{Aud: Audience{"single"}})
+	if !strings.Contains(string(raw), `"aud":"single"`) {
+		t.Fatalf("INVALID AUDIENCE SERIALIZATION: %s", raw)
+	}
+}
+
+func TestIdToken(t *testing.T) {
+	keys := singleKeyRing(testKeys(t)[2])
+
+	idClaims := NewIdClaims(42, "client")
+	idClaims.Iss = "https://auth.example.com"
+	idClaims.Nonce = "nonce"
+
+	idToken, err := CreateIdToken(keys, idClaims)
+	if err != nil {
+		t.Fatalf("UNEXPECTED ERROR: %v", err)
+	}
+
+	parts := strings.Split(idToken, ".")
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		t.Fatalf("UNEXPECTED ERROR: %v", err)
+	}
+
+	var raw map[string]interface{}
+	err = json.Unmarshal(payload, &raw)
+	if err != nil {
+		t.Fatalf("UNEXPECTED ERROR: %v", err)
+	}
+	if raw["sub"] != "42" || raw["aud"] != "client" || raw["nonce"] != "nonce" {
+		t.Fatalf("INVALID ID TOKEN CLAIMS: %s", payload)
+	}
+
+	// ID token must not be accepted as access token
+	_, _, err = Parse(idToken, keys, Validator{})
+	if err != ErrMalformed {
+		t.Fatalf("INVALID ERROR. EXPECTED %v GOT %v", ErrMalformed, err)
+	}
+}
+
+func TestPublicKey(t *testing.T) {
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("UNEXPECTED ERROR: %v", err)
+	}
+
+	signingKey, err := NewAsymmetricKey(AlgES256, private)
+	if err != nil {
+		t.Fatalf("UNEXPECTED ERROR: %v", err)
+	}
+
+	der, _ := x509.MarshalPKIXPublicKey(&private.PublicKey)
+	verificationKey, err := NewKey(KeyConfig{
+		Alg:   AlgES256,
+		Value: string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})),
+	})
+	if err != nil {
+		t.Fatalf("UNEXPECTED ERROR: %v", err)
+	}
+
+	jwt, err := Create(singleKeyRing(signingKey), NewClaims(1, "USER"))
+	if err != nil {
+		t.Fatalf("UNEXPECTED ERROR: %v", err)
+	}
+
+	_, _, err = Parse(jwt, singleKeyRing(verificationKey), Validator{})
+	if err != nil {
+		t.Fatalf("UNEXPECTED ERROR: %v", err)
+	}
+
+	_, err = Create(singleKeyRing(verificationKey), NewClaims(1, "USER"))
+	if err != ErrNoPrivateKey {
+		t.Fatalf("INVALID ERROR. EXPECTED %v GOT %v", ErrNoPrivateKey, err)
+	}
+
+	_, err = NewAsymmetricKey(AlgRS256, private)
+	if err != ErrInvalidKey {
+		t.Fatalf("INVALID ERROR. EXPECTED %v GOT %v", ErrInvalidKey, err)
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	jwks := NewJWKS(testKeys(t)...)
+
+	if len(jwks.Keys) != 3 {
+		t.Fatalf("INVALID KEYS COUNT. EXPECTED %d GOT %d", 3, len(jwks.Keys))
+	}
+
+	for _, jwk := range jwks.Keys {
+		switch jwk.Alg {
+		case AlgRS256:
+			if jwk.Kty != "RSA" || jwk.N == "" || jwk.E != "AQAB" {
+				t.Fatalf("INVALID RSA JWK: %v", jwk)
+			}
+		case AlgES256:
+			if jwk.Kty != "EC" || jwk.Crv != "P-256" || len(jwk.X) != 43 || len(jwk.Y) != 43 {
+				t.Fatalf("INVALID EC JWK: %v", jwk)
+			}
+		case AlgEdDSA:
+			if jwk.Kty != "OKP" || jwk.Crv != "Ed25519" || len(jwk.X) != 43 {
+				t.Fatalf("INVALID OKP JWK: %v", jwk)
+			}
+		default:
+			t.Fatalf("UNEXPECTED JWK: %v", jwk)
+		}
+	}
+}
+
+func TestKeyFromJWK(t *testing.T) {
+	for _, key := range testKeys(t)[1:] {
+		jwk, _ := key.JWK()
+
+		public, err := KeyFromJWK(jwk)
+		if err != nil {
+			t.Fatalf("UNEXPECTED ERROR FOR %s: %v", key.Alg(), err)
+		}
+		if public.Id() != key.Id() || public.Alg() != key.Alg() {
+			t.Fatalf("INVALID KEY. EXPECTED %s %s GOT %s %s", key.Id(), key.Alg(), public.Id(), public.Alg())
+		}
+
+		jwt, err := Create(singleKeyRing(key), NewClaims(1, "CREATOR"))
+		if err != nil {
+			t.Fatalf("UNEXPECTED ERROR FOR %s: %v", key.Alg(), err)
+		}
+
+		_, raw, err := Verify(jwt, singleKeyRing(public))
+		if err != nil || !strings.Contains(string(raw), `"sub":1`) {
+			t.Fatalf("UNEXPECTED VERIFICATION RESULT FOR %s: %s %v", key.Alg(), raw, err)
+		}
+
+		jwk.Alg = AlgHS256
+		_, err = KeyFromJWK(jwk)
+		if err != ErrUnsupportedAlgorithm {
+			t.Fatalf("INVALID ERROR FOR %s. EXPECTED %v GOT %v", key.Alg(), ErrUnsupportedAlgorithm, err)
+		}
+	}
+
+	_, err := KeyFromJWK(JWK{Kty: "EC", Crv: "P-256", X: strings.Repeat("A", 43), Y: strings.Repeat("A", 43)})
+	if err != ErrInvalidKey {
+		t.Fatalf("INVALID ERROR. EXPECTED %v GOT %v", ErrInvalidKey, err)
+	}
+}
+
+func TestKeyRing(t *testing.T) {
+	dir := t.TempDir()
+	for _, kid := range []string{"old", "new"} {
+		private, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		der, _ := x509.MarshalECPrivateKey(private)
+		err := os.WriteFile(dir+"/"+kid+".pem", pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600)
+		if err != nil {
+			t.Fatalf("UNEXPECTED ERROR: %v", err)
+		}
+	}
+	oldKey := KeyConfig{Id: "old", Alg: AlgES256, File: dir + "/old.pem"}
+	newKey := KeyConfig{Id: "new", Alg: AlgES256, File: dir + "/new.pem"}
 
-	validClaims := Claims{
-		Sub: 1,
-		Rol: "CREATOR",
-		Exp: exp,
-		Iat: iat,
+	keys, err := NewKeyRing(KeyRingConfig{Signing: "old", Keys: []KeyConfig{oldKey}})
+	if err != nil {
+		t.Fatalf("UNEXPECTED ERROR: %v", err)
 	}
 
-	if exp != iat+TokenLifetime {
-		t.Fatalf("INVALID EXPIRATION TIME. EXPECTED %d GOT %d", iat+TokenLifetime, exp)
+	oldJwt, _ := Create(keys, NewClaims(1, "USER"))
+
+	err = keys.Reload(KeyRingConfig{Signing: "new", Keys: []KeyConfig{oldKey, newKey}})
+	if err != nil {
+		t.Fatalf("UNEXPECTED ERROR: %v", err)
+	}
+
+	newJwt, _ := Create(keys, NewClaims(1, "USER"))
+
+	for _, jwt := range []string{oldJwt, newJwt} {
+		_, _, err = Parse(jwt, keys, Validator{})
+		if err != nil {
+			t.Fatalf("UNEXPECTED ERROR: %v", err)
+		}
 	}
 
-	_, claims, err := Parse(jwt)
+	if len(keys.JWKS().Keys) != 2 {
+		t.Fatalf("INVALID KEYS COUNT. EXPECTED %d GOT %d", 2, len(keys.JWKS().Keys))
+	}
+
+	for _, config := range []KeyRingConfig{
+		{Signing: "missing", Keys: []KeyConfig{newKey}},
+		{Signing: "new", Keys: []KeyConfig{newKey, newKey}},
+		{Signing: "new", Keys: []KeyConfig{newKey, {Alg: AlgES256, File: dir + "/old.pem"}}},
+		{Signing: "new", Keys: []KeyConfig{newKey, {Id: "broken", Alg: AlgRS256, File: dir + "/old.pem"}}},
+	} {
+		err = keys.Reload(config)
+		if err == nil {
+			t.Fatalf("EXPECTED ERROR FOR %v", config)
+		}
+	}
+
+	err = keys.Reload(KeyRingConfig{Signing: "new", Keys: []KeyConfig{newKey}})
 	if err != nil {
 		t.Fatalf("UNEXPECTED ERROR: %v", err)
 	}
 
-	if claims != validClaims {
-		t.Fatalf("INVALID CLAIMS. EXPECTED %v GOT %v", validClaims, claims)
+	_, _, err = Parse(oldJwt, keys, Validator{})
+	if err != ErrUnknownKey {
+		t.Fatalf("INVALID ERROR. EXPECTED %v GOT %v", ErrUnknownKey, err)
+	}
+
+	_, _, err = Parse(newJwt, keys, Validator{})
+	if err != nil {
+		t.Fatalf("UNEXPECTED ERROR: %v", err)
 	}
 }
@@ -0,0 +1,105 @@
+package jwt
+
+import (
+	"errors"
+	"sort"
+	"sync"
+)
+
+type (
+	// KeyRingConfig lists all keys accepted for verification. Key with id Signing is used for creating new tokens
+	KeyRingConfig struct {
+		Signing string      `json:"signing"`
+		Keys    []KeyConfig `json:"keys"`
+	}
+
+	// KeyRing is a set of verification keys with one signing key. It is safe for concurrent use
+	KeyRing struct {
+		mx      sync.RWMutex
+		signing *Key
+		keys    map[string]*Key
+	}
+)
+
+var (
+	ErrNoKeyId           = errors.New("key id should be specified")
+	ErrDuplicateKeyId    = errors.New("duplicate key id")
+	ErrNoSigningKey      = errors.New("signing key is not found in key ring")
+	ErrSigningKeyPrivate = errors.New("signing key should contain private part")
+)
+
+func NewKeyRing(config KeyRingConfig) (*KeyRing, error) {
+	r := &KeyRing{}
+
+	err := r.Reload(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Reload replaces all keys in ring. If any key is invalid, ring remains untouched
+func (r *KeyRing) Reload(config KeyRingConfig) error {
+	keys := make(map[string]*Key, len(config.Keys))
+	for _, keyConfig := range config.Keys {
+		if keyConfig.Id == "" {
+			return ErrNoKeyId
+		}
+		if _, ok := keys[keyConfig.Id]; ok {
+			return ErrDuplicateKeyId
+		}
+
+		key, err := NewKey(keyConfig)
+		if err != nil {
+			return err
+		}
+		keys[keyConfig.Id] = key
+	}
+
+	signing, ok := keys[config.Signing]
+	if !ok {
+		return ErrNoSigningKey
+	}
+	if signing.alg != AlgHS256 && signing.private == nil {
+		return ErrSigningKeyPrivate
+	}
+
+	r.mx.Lock()
+	r.signing = signing
+	r.keys = keys
+	r.mx.Unlock()
+
+	return nil
+}
+
+func (r *KeyRing) Signing() *Key {
+	r.mx.RLock()
+	defer r.mx.RUnlock()
+
+	return r.signing
+}
+
+func (r *KeyRing) Get(kid string) (*Key, bool) {
+	r.mx.RLock()
+	defer r.mx.RUnlock()
+
+	key, ok := r.keys[kid]
+	return key, ok
+}
+
+// JWKS returns public parts of all asymmetric keys in ring ordered by key id
+func (r *KeyRing) JWKS() JWKS {
+	r.mx.RLock()
+	keys := make([]*Key, 0, len(r.keys))
+	for _, key := range r.keys {
+		keys = append(keys, key)
+	}
+	r.mx.RUnlock()
+
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].id < keys[j].id
+	})
+
+	return NewJWKS(keys...)
+}
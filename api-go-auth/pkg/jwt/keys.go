@@ -0,0 +1,210 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+)
+
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgES256 = "ES256"
+	AlgEdDSA = "EdDSA"
+
+	es256KeySize = 32
+)
+
+type (
+	// KeyConfig describes key source. Key material is read from File if it is set, otherwise Value is used.
+	// HS256 expects raw secret, other algorithms expect PEM encoded private key (or public key for verification only)
+	KeyConfig struct {
+		Id    string `json:"kid"`
+		Alg   string `json:"alg"`
+		File  string `json:"file"`
+		Value string `json:"value"`
+	}
+
+	Key struct {
+		id      string
+		alg     string
+		secret  []byte
+		private crypto.Signer
+		public  crypto.PublicKey
+	}
+)
+
+var (
+	ErrUnsupportedAlgorithm = errors.New("unsupported JWT algorithm")
+	ErrNoKeyMaterial        = errors.New("key file or value should be specified")
+	ErrInvalidKey           = errors.New("key does not match algorithm")
+	ErrNoPrivateKey         = errors.New("key can not be used for signing")
+)
+
+// NewKey loads key described by config
+func NewKey(config KeyConfig) (*Key, error) {
+	var data []byte
+	if config.File != "" {
+		var err error
+		data, err = os.ReadFile(config.File)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		data = []byte(config.Value)
+	}
+
+	key, err := ParseKey(config.Alg, data)
+	if err != nil {
+		return nil, err
+	}
+
+	key.id = config.Id
+	return key, nil
+}
+
+// ParseKey creates key from raw secret (HS256) or PEM block (RS256, ES256, EdDSA)
+func ParseKey(alg string, data []byte) (*Key, error) {
+	if len(data) == 0 {
+		return nil, ErrNoKeyMaterial
+	}
+
+	if alg == AlgHS256 {
+		return &Key{alg: alg, secret: data}, nil
+	}
+
+	if alg != AlgRS256 && alg != AlgES256 && alg != AlgEdDSA {
+		return nil, ErrUnsupportedAlgorithm
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, ErrInvalidKey
+	}
+
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		parsed, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, ErrInvalidKey
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return NewAsymmetricKey(alg, parsed)
+}
+
+// NewAsymmetricKey wraps private or public key of type matching algorithm
+func NewAsymmetricKey(alg string, k interface{}) (*Key, error) {
+	key := &Key{alg: alg}
+
+	if signer, ok := k.(crypto.Signer); ok {
+		key.private = signer
+		key.public = signer.Public()
+	} else {
+		key.public = k
+	}
+
+	switch pub := key.public.(type) {
+	case *rsa.PublicKey:
+		if alg != AlgRS256 || pub.N.BitLen() < 2048 {
+			return nil, ErrInvalidKey
+		}
+	case *ecdsa.PublicKey:
+		if alg != AlgES256 || pub.Curve != elliptic.P256() {
+			return nil, ErrInvalidKey
+		}
+	case ed25519.PublicKey:
+		if alg != AlgEdDSA {
+			return nil, ErrInvalidKey
+		}
+	default:
+		return nil, ErrInvalidKey
+	}
+
+	return key, nil
+}
+
+func (k *Key) Id() string {
+	return k.id
+}
+
+func (k *Key) Alg() string {
+	return k.alg
+}
+
+func (k *Key) sign(data []byte) ([]byte, error) {
+	switch k.alg {
+	case AlgHS256:
+		h := hmac.New(sha256.New, k.secret)
+		h.Write(data)
+		return h.Sum(nil), nil
+	}
+
+	if k.private == nil {
+		return nil, ErrNoPrivateKey
+	}
+
+	switch k.alg {
+	case AlgRS256:
+		digest := sha256.Sum256(data)
+		return rsa.SignPKCS1v15(rand.Reader, k.private.(*rsa.PrivateKey), crypto.SHA256, digest[:])
+	case AlgES256:
+		digest := sha256.Sum256(data)
+		r, s, err := ecdsa.Sign(rand.Reader, k.private.(*ecdsa.PrivateKey), digest[:])
+		if err != nil {
+			return nil, err
+		}
+		signature := make([]byte, 2*es256KeySize)
+		r.FillBytes(signature[:es256KeySize])
+		s.FillBytes(signature[es256KeySize:])
+		return signature, nil
+	case AlgEdDSA:
+		return ed25519.Sign(k.private.(ed25519.PrivateKey), data), nil
+	default:
+		return nil, ErrUnsupportedAlgorithm
+	}
+}
+
+func (k *Key) verify(data, signature []byte) bool {
+	switch k.alg {
+	case AlgHS256:
+		h := hmac.New(sha256.New, k.secret)
+		h.Write(data)
+		return hmac.Equal(h.Sum(nil), signature)
+	case AlgRS256:
+		digest := sha256.Sum256(data)
+		return rsa.VerifyPKCS1v15(k.public.(*rsa.PublicKey), crypto.SHA256, digest[:], signature) == nil
+	case AlgES256:
+		if len(signature) != 2*es256KeySize {
+			return false
+		}
+		digest := sha256.Sum256(data)
+		r := new(big.Int).SetBytes(signature[:es256KeySize])
+		s := new(big.Int).SetBytes(signature[es256KeySize:])
+		return ecdsa.Verify(k.public.(*ecdsa.PublicKey), digest[:], r, s)
+	case AlgEdDSA:
+		return ed25519.Verify(k.public.(ed25519.PublicKey), data, signature)
+	default:
+		return false
+	}
+}
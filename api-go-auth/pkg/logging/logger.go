@@ -18,9 +18,10 @@ const (
 	DefaultTimeFormat      = "2006-01-02T15:04:05"
 	DefaultSaveInterval    = time.Second * 3
 
-	LevelFatal logLevel = "FATAL"
-	LevelError logLevel = "ERROR"
-	LevelInfo  logLevel = "INFO"
+	LevelFatal    logLevel = "FATAL"
+	LevelSecurity logLevel = "SECURITY"
+	LevelError    logLevel = "ERROR"
+	LevelInfo     logLevel = "INFO"
 )
 
 const (
@@ -44,6 +45,7 @@ type (
 	}
 
 	Request struct {
+		Id        string   `json:"id,omitempty"`
 		Timestamp int64    `json:"timestamp"`
 		Method    string   `json:"method"`
 		Path      string   `json:"path"`
@@ -0,0 +1,85 @@
+package mailer
+
+import (
+	"bytes"
+	"errors"
+	"mime"
+	"strings"
+	"time"
+)
+
+const (
+	TypeSmtp   = "smtp"
+	TypeOutbox = "outbox"
+)
+
+type (
+	Config struct {
+		Type   string     `json:"type"`
+		From   string     `json:"from"`
+		Smtp   SmtpConfig `json:"smtp"`
+		Outbox string     `json:"outbox"`
+	}
+
+	Message struct {
+		From    string
+		To      string
+		Subject string
+		Body    string
+	}
+
+	Mailer interface {
+		Send(message Message) error
+	}
+)
+
+var (
+	ErrUnknownType  = errors.New("unknown mailer type")
+	ErrNoSender     = errors.New("sender is not specified")
+	ErrNoRecipient  = errors.New("recipient is not specified")
+	headerSanitizer = strings.NewReplacer("\r", "", "\n", "")
+)
+
+// NewMailer builds mailer of type specified in config
+func NewMailer(config Config) (Mailer, error) {
+	if config.From == "" {
+		return nil, ErrNoSender
+	}
+
+	switch config.Type {
+	case TypeSmtp:
+		return NewSmtpMailer(config.From, config.Smtp), nil
+	case TypeOutbox:
+		return NewOutboxMailer(config.From, config.Outbox)
+	default:
+		return nil, ErrUnknownType
+	}
+}
+
+// Bytes returns message formatted according to RFC 5322
+func (m Message) Bytes() []byte {
+	var buf bytes.Buffer
+
+	buf.WriteString("From: " + headerSanitizer.Replace(m.From) + "\r\n")
+	buf.WriteString("To: " + headerSanitizer.Replace(m.To) + "\r\n")
+	buf.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", headerSanitizer.Replace(m.Subject)) + "\r\n")
+	buf.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=\"utf-8\"\r\n")
+	buf.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	buf.WriteString("\r\n")
+	buf.WriteString(strings.ReplaceAll(strings.ReplaceAll(m.Body, "\r\n", "\n"), "\n", "\r\n"))
+	buf.WriteString("\r\n")
+
+	return buf.Bytes()
+}
+
+func (m Message) validate() error {
+	if m.From == "" {
+		return ErrNoSender
+	}
+	if m.To == "" {
+		return ErrNoRecipient
+	}
+	return nil
+}
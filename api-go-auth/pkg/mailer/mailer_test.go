@@ -0,0 +1,91 @@
+package mailer
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestTemplate(t *testing.T) {
+	tmpl := MustTemplate("Code {{.Code}}", "Your code is {{.Code}}\nBye")
+
+	message, err := tmpl.Render("user@example.com", struct{ Code string }{Code: "12345678"})
+	if err != nil {
+		t.Fatalf("UNEXPECTED ERROR: %v", err)
+	}
+
+	if message.To != "user@example.com" {
+		t.Fatalf("INVALID RECIPIENT. EXPECTED %s GOT %s", "user@example.com", message.To)
+	}
+	if message.Subject != "Code 12345678" {
+		t.Fatalf("INVALID SUBJECT. EXPECTED %s GOT %s", "Code 12345678", message.Subject)
+	}
+	if message.Body != "Your code is 12345678\nBye" {
+		t.Fatalf("INVALID BODY. GOT %s", message.Body)
+	}
+
+	_, err = NewTemplate("{{.Code", "")
+	if err == nil {
+		t.Fatal("EXPECTED PARSE ERROR")
+	}
+}
+
+func TestOutboxMailer(t *testing.T) {
+	var buf bytes.Buffer
+	m := NewWriterMailer("noreply@example.com", &buf)
+
+	err := m.Send(Message{To: "user@example.com", Subject: "Hello\r\nBcc: evil@example.com", Body: "Line 1\nLine 2"})
+	if err != nil {
+		t.Fatalf("UNEXPECTED ERROR: %v", err)
+	}
+
+	content := buf.String()
+	for _, expected := range []string{
+		"From: noreply@example.com\r\n",
+		"To: user@example.com\r\n",
+		"Subject: HelloBcc: evil@example.com\r\n",
+		"\r\n\r\nLine 1\r\nLine 2\r\n",
+	} {
+		if !strings.Contains(content, expected) {
+			t.Fatalf("MESSAGE DOES NOT CONTAIN %q: %s", expected, content)
+		}
+	}
+
+	err = m.Send(Message{Subject: "No recipient"})
+	if err != ErrNoRecipient {
+		t.Fatalf("INVALID ERROR. EXPECTED %v GOT %v", ErrNoRecipient, err)
+	}
+}
+
+func TestNewMailer(t *testing.T) {
+	filename := t.TempDir() + "/outbox.eml"
+
+	m, err := NewMailer(Config{Type: TypeOutbox, From: "noreply@example.com", Outbox: filename})
+	if err != nil {
+		t.Fatalf("UNEXPECTED ERROR: %v", err)
+	}
+
+	err = m.Send(Message{To: "user@example.com", Subject: "Test", Body: "Test"})
+	if err != nil {
+		t.Fatalf("UNEXPECTED ERROR: %v", err)
+	}
+
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("UNEXPECTED ERROR: %v", err)
+	}
+	if !bytes.Contains(content, []byte("To: user@example.com")) {
+		t.Fatalf("OUTBOX DOES NOT CONTAIN MESSAGE: %s", content)
+	}
+
+	_, err = NewMailer(Config{Type: "pigeon", From: "noreply@example.com"})
+	if err != ErrUnknownType {
+		t.Fatalf("INVALID ERROR. EXPECTED %v GOT %v", ErrUnknownType, err)
+	}
+
+	_, err = NewMailer(Config{Type: TypeOutbox})
+	if err != ErrNoSender {
+		t.Fatalf("INVALID ERROR. EXPECTED %v GOT %v", ErrNoSender, err)
+	}
+}
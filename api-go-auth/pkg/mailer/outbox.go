@@ -0,0 +1,60 @@
+package mailer
+
+import (
+	"io"
+	"os"
+	"sync"
+)
+
+const (
+	OutboxStdout = "-"
+
+	outboxSeparator = "\r\n----------\r\n"
+)
+
+type (
+	OutboxMailer struct {
+		from string
+		w    io.Writer
+		mx   sync.Mutex
+	}
+)
+
+// NewOutboxMailer creates mailer that writes messages to file instead of sending them.
+// Empty filename or OutboxStdout means standard output
+func NewOutboxMailer(from, filename string) (*OutboxMailer, error) {
+	if filename == "" || filename == OutboxStdout {
+		return NewWriterMailer(from, os.Stdout), nil
+	}
+
+	f, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewWriterMailer(from, f), nil
+}
+
+func NewWriterMailer(from string, w io.Writer) *OutboxMailer {
+	return &OutboxMailer{
+		from: from,
+		w:    w,
+	}
+}
+
+func (m *OutboxMailer) Send(message Message) error {
+	if message.From == "" {
+		message.From = m.from
+	}
+
+	err := message.validate()
+	if err != nil {
+		return err
+	}
+
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	_, err = m.w.Write(append(message.Bytes(), outboxSeparator...))
+	return err
+}
@@ -0,0 +1,58 @@
+package mailer
+
+import (
+	"fmt"
+	"net/mail"
+	"net/smtp"
+)
+
+type (
+	SmtpConfig struct {
+		Host     string `json:"host"`
+		Port     int    `json:"port"`
+		User     string `json:"user"`
+		Password string `json:"password"`
+	}
+
+	SmtpMailer struct {
+		from   string
+		config SmtpConfig
+	}
+)
+
+func NewSmtpMailer(from string, config SmtpConfig) *SmtpMailer {
+	return &SmtpMailer{
+		from:   from,
+		config: config,
+	}
+}
+
+// Send delivers message via SMTP server. STARTTLS is used if server supports it
+func (m *SmtpMailer) Send(message Message) error {
+	if message.From == "" {
+		message.From = m.from
+	}
+
+	err := message.validate()
+	if err != nil {
+		return err
+	}
+
+	sender, err := mail.ParseAddress(message.From)
+	if err != nil {
+		return err
+	}
+
+	recipient, err := mail.ParseAddress(message.To)
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if m.config.User != "" {
+		auth = smtp.PlainAuth("", m.config.User, m.config.Password, m.config.Host)
+	}
+
+	return smtp.SendMail(fmt.Sprintf("%s:%d", m.config.Host, m.config.Port), auth,
+		sender.Address, []string{recipient.Address}, message.Bytes())
+}
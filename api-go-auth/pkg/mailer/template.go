@@ -0,0 +1,60 @@
+package mailer
+
+import (
+	"bytes"
+	"text/template"
+)
+
+type (
+	Template struct {
+		subject *template.Template
+		body    *template.Template
+	}
+)
+
+func NewTemplate(subject, body string) (*Template, error) {
+	s, err := template.New("subject").Parse(subject)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := template.New("body").Parse(body)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Template{
+		subject: s,
+		body:    b,
+	}, nil
+}
+
+// MustTemplate is like NewTemplate but panics if templates can not be parsed
+func MustTemplate(subject, body string) *Template {
+	t, err := NewTemplate(subject, body)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// Render executes templates with provided data and returns message addressed to recipient
+func (t *Template) Render(to string, data interface{}) (Message, error) {
+	var subject, body bytes.Buffer
+
+	err := t.subject.Execute(&subject, data)
+	if err != nil {
+		return Message{}, err
+	}
+
+	err = t.body.Execute(&body, data)
+	if err != nil {
+		return Message{}, err
+	}
+
+	return Message{
+		To:      to,
+		Subject: subject.String(),
+		Body:    body.String(),
+	}, nil
+}
@@ -0,0 +1,353 @@
+package oidc
+
+import (
+	"auth/pkg/jwt"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DiscoveryPath = "/.well-known/openid-configuration"
+
+	ScopeOpenId = "openid"
+
+	DefaultTimeout = 10 * time.Second
+	DefaultLeeway  = 30
+
+	// keysMinRefreshInterval limits refetching of provider keys caused by tokens with unknown key id
+	keysMinRefreshInterval = time.Minute
+	maxResponseSize        = 1 << 20
+)
+
+type (
+	// ProviderConfig describes external OpenID Connect provider registered for this service. Name is used
+	// in URLs and as a part of identity key, so it should not be changed once users have signed in
+	// ProviderConfig describes registered client of provider. TrustEmail means that verified email asserted by
+	// provider proves control of local account with the same email
+	ProviderConfig struct {
+		Name         string   `json:"name"`
+		Issuer       string   `json:"issuer"`
+		ClientId     string   `json:"clientId"`
+		ClientSecret string   `json:"clientSecret"`
+		RedirectUri  string   `json:"redirectUri"`
+		Scopes       []string `json:"scopes"`
+		TrustEmail   bool     `json:"trustEmail"`
+	}
+
+	// Metadata is a subset of provider discovery document that is required for authorization code flow
+	Metadata struct {
+		Issuer                string `json:"issuer"`
+		AuthorizationEndpoint string `json:"authorization_endpoint"`
+		TokenEndpoint         string `json:"token_endpoint"`
+		JwksUri               string `json:"jwks_uri"`
+	}
+
+	// Identity is an end user authenticated by provider
+	Identity struct {
+		Subject           string
+		Email             string
+		EmailVerified     bool
+		PreferredUsername string
+	}
+
+	// Provider is a relying party client of single provider. Discovery document and keys are fetched on first use
+	// and cached. It is safe for concurrent use
+	Provider struct {
+		config ProviderConfig
+		client *http.Client
+
+		mx            sync.Mutex
+		metadata      *Metadata
+		keys          keySet
+		keysFetchedAt time.Time
+	}
+
+	idTokenClaims struct {
+		Iss               string       `json:"iss"`
+		Sub               string       `json:"sub"`
+		Aud               jwt.Audience `json:"aud"`
+		Exp               int64        `json:"exp"`
+		Nbf               int64        `json:"nbf"`
+		Iat               int64        `json:"iat"`
+		Nonce             string       `json:"nonce"`
+		Email             string       `json:"email"`
+		EmailVerified     bool         `json:"email_verified"`
+		PreferredUsername string       `json:"preferred_username"`
+	}
+
+	tokenResponse struct {
+		IdToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+
+	keySet map[string]*jwt.Key
+)
+
+var (
+	ErrInvalidConfig   = errors.New("provider name, issuer, client id and redirect uri should be specified")
+	ErrDiscovery       = errors.New("provider discovery failed")
+	ErrTokenExchange   = errors.New("authorization code exchange failed")
+	ErrInvalidIdToken  = errors.New("ID token is invalid")
+	ErrNonceMismatch   = errors.New("ID token nonce mismatch")
+	ErrIssuerMismatch  = errors.New("provider issuer mismatch")
+	ErrInvalidResponse = errors.New("provider response is invalid")
+)
+
+// NewProvider validates config and creates provider client. No requests are made until provider is used.
+// Client with DefaultTimeout is used if nil is passed
+func NewProvider(config ProviderConfig, client *http.Client) (*Provider, error) {
+	if config.Name == "" || config.Issuer == "" || config.ClientId == "" || config.RedirectUri == "" {
+		return nil, ErrInvalidConfig
+	}
+
+	hasOpenId := false
+	for _, scope := range config.Scopes {
+		if scope == ScopeOpenId {
+			hasOpenId = true
+			break
+		}
+	}
+	if !hasOpenId {
+		config.Scopes = append([]string{ScopeOpenId}, config.Scopes...)
+	}
+
+	if client == nil {
+		client = &http.Client{Timeout: DefaultTimeout}
+	}
+
+	return &Provider{config: config, client: client}, nil
+}
+
+func (p *Provider) Name() string {
+	return p.config.Name
+}
+
+func (p *Provider) TrustsEmail() bool {
+	return p.config.TrustEmail
+}
+
+// AuthCodeURL returns URL of provider authorization endpoint that user agent should be redirected to.
+// Only S256 challenge of code verifier is sent, verifier itself is passed to Exchange later
+func (p *Provider) AuthCodeURL(state, nonce, codeVerifier string) (string, error) {
+	metadata, err := p.discover()
+	if err != nil {
+		return "", err
+	}
+
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", p.config.ClientId)
+	params.Set("redirect_uri", p.config.RedirectUri)
+	params.Set("scope", strings.Join(p.config.Scopes, " "))
+	params.Set("state", state)
+	params.Set("nonce", nonce)
+	params.Set("code_challenge", CodeChallenge(codeVerifier))
+	params.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(metadata.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+
+	return metadata.AuthorizationEndpoint + separator + params.Encode(), nil
+}
+
+// Exchange redeems authorization code at provider token endpoint and returns identity from verified ID token.
+// Nonce must be the same that was passed to AuthCodeURL
+func (p *Provider) Exchange(code, codeVerifier, nonce string) (*Identity, error) {
+	metadata, err := p.discover()
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.config.RedirectUri)
+	form.Set("code_verifier", codeVerifier)
+
+	request, err := http.NewRequest(http.MethodPost, metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+	request.SetBasicAuth(url.QueryEscape(p.config.ClientId), url.QueryEscape(p.config.ClientSecret))
+
+	response, err := p.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	var token tokenResponse
+	err = json.NewDecoder(io.LimitReader(response.Body, maxResponseSize)).Decode(&token)
+	if err != nil {
+		return nil, ErrInvalidResponse
+	}
+	if response.StatusCode != http.StatusOK || token.Error != "" {
+		return nil, fmt.Errorf("%w: %s %s", ErrTokenExchange, token.Error, token.ErrorDescription)
+	}
+	if token.IdToken == "" {
+		return nil, ErrInvalidResponse
+	}
+
+	claims, err := p.verifyIdToken(token.IdToken, metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	if nonce == "" || claims.Nonce != nonce {
+		return nil, ErrNonceMismatch
+	}
+
+	return &Identity{
+		Subject:           claims.Sub,
+		Email:             claims.Email,
+		EmailVerified:     claims.EmailVerified,
+		PreferredUsername: claims.PreferredUsername,
+	}, nil
+}
+
+func (p *Provider) verifyIdToken(idToken string, metadata *Metadata) (*idTokenClaims, error) {
+	keys, err := p.getKeys(false)
+	if err != nil {
+		return nil, err
+	}
+
+	_, raw, err := jwt.Verify(idToken, keys)
+	if errors.Is(err, jwt.ErrUnknownKey) {
+		// Provider might have rotated its keys
+		keys, err = p.getKeys(true)
+		if err != nil {
+			return nil, err
+		}
+		_, raw, err = jwt.Verify(idToken, keys)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIdToken, err)
+	}
+
+	var claims idTokenClaims
+	err = json.Unmarshal(raw, &claims)
+	if err != nil || claims.Sub == "" {
+		return nil, ErrInvalidIdToken
+	}
+
+	validator := jwt.Validator{
+		Issuer:   metadata.Issuer,
+		Audience: p.config.ClientId,
+		Leeway:   DefaultLeeway,
+	}
+	err = validator.Validate(jwt.Claims{
+		Iss: claims.Iss,
+		Aud: claims.Aud,
+		Exp: claims.Exp,
+		Nbf: claims.Nbf,
+		Iat: claims.Iat,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIdToken, err)
+	}
+
+	return &claims, nil
+}
+
+// discover returns cached provider metadata or fetches it. Failed attempts are not cached
+func (p *Provider) discover() (*Metadata, error) {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+
+	var metadata Metadata
+	err := p.getJson(strings.TrimSuffix(p.config.Issuer, "/")+DiscoveryPath, &metadata)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDiscovery, err)
+	}
+
+	if metadata.Issuer != p.config.Issuer {
+		return nil, ErrIssuerMismatch
+	}
+	if metadata.AuthorizationEndpoint == "" || metadata.TokenEndpoint == "" || metadata.JwksUri == "" {
+		return nil, ErrDiscovery
+	}
+
+	p.metadata = &metadata
+	return p.metadata, nil
+}
+
+// getKeys returns cached provider keys. Keys are refetched if refresh is requested and they were not fetched recently
+func (p *Provider) getKeys(refresh bool) (keySet, error) {
+	metadata, err := p.discover()
+	if err != nil {
+		return nil, err
+	}
+
+	p.mx.Lock()
+	defer p.mx.Unlock()
+
+	if p.keys != nil && (!refresh || time.Since(p.keysFetchedAt) < keysMinRefreshInterval) {
+		return p.keys, nil
+	}
+
+	var jwks jwt.JWKS
+	err = p.getJson(metadata.JwksUri, &jwks)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDiscovery, err)
+	}
+
+	// Keys of unsupported types are skipped, tokens signed with them are rejected as signed with unknown key
+	keys := make(keySet, len(jwks.Keys))
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwt.KeyFromJWK(jwk)
+		if err != nil {
+			continue
+		}
+		keys[key.Id()] = key
+	}
+
+	p.keys = keys
+	p.keysFetchedAt = time.Now()
+	return p.keys, nil
+}
+
+func (p *Provider) getJson(uri string, v interface{}) error {
+	response, err := p.client.Get(uri)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d", response.StatusCode)
+	}
+
+	return json.NewDecoder(io.LimitReader(response.Body, maxResponseSize)).Decode(v)
+}
+
+func (k keySet) Get(kid string) (*jwt.Key, bool) {
+	key, ok := k[kid]
+	return key, ok
+}
+
+// CodeChallenge returns S256 PKCE challenge of code verifier
+func CodeChallenge(codeVerifier string) string {
+	digest := sha256.Sum256([]byte(codeVerifier))
+	return base64.RawURLEncoding.EncodeToString(digest[:])
+}
@@ -0,0 +1,299 @@
+package oidc
+
+import (
+	"auth/pkg/jwt"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	testClientId     = "client"
+	testClientSecret = "secret"
+	testCode         = "code"
+	testVerifier     = "verifier-verifier-verifier-verifier-verifier"
+)
+
+type (
+	// fakeProvider is a local identity provider that issues ID token with configured claims for the only known code
+	fakeProvider struct {
+		t      *testing.T
+		server *httptest.Server
+
+		mx           sync.Mutex
+		keys         *jwt.KeyRing
+		challenge    string
+		claims       map[string]interface{}
+		jwksRequests int
+	}
+)
+
+func newFakeProvider(t *testing.T) *fakeProvider {
+	f := &fakeProvider{t: t, keys: testKeyRing(t, "first")}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(DiscoveryPath, func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(Metadata{
+			Issuer:                f.server.URL,
+			AuthorizationEndpoint: f.server.URL + "/authorize",
+			TokenEndpoint:         f.server.URL + "/token",
+			JwksUri:               f.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		f.mx.Lock()
+		defer f.mx.Unlock()
+
+		f.jwksRequests++
+		_ = json.NewEncoder(w).Encode(f.keys.JWKS())
+	})
+	mux.HandleFunc("/token", f.token)
+
+	f.server = httptest.NewServer(mux)
+	t.Cleanup(f.server.Close)
+
+	return f
+}
+
+func (f *fakeProvider) token(w http.ResponseWriter, r *http.Request) {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+
+	id, secret, _ := r.BasicAuth()
+	if id != testClientId || secret != testClientSecret {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"error":"invalid_client"}`))
+		return
+	}
+
+	if r.PostFormValue("grant_type") != "authorization_code" || r.PostFormValue("code") != testCode ||
+		CodeChallenge(r.PostFormValue("code_verifier")) != f.challenge {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"error":"invalid_grant"}`))
+		return
+	}
+
+	idToken, err := signClaims(f.keys, f.claims)
+	if err != nil {
+		f.t.Fatalf("UNEXPECTED ERROR: %v", err)
+	}
+
+	_ = json.NewEncoder(w).Encode(map[string]string{"id_token": idToken, "token_type": "Bearer"})
+}
+
+// authorize imitates user consent: remembers challenge and issues ID token with default claims
+func (f *fakeProvider) authorize(authUrl string) url.Values {
+	parsed, err := url.Parse(authUrl)
+	if err != nil {
+		f.t.Fatalf("UNEXPECTED ERROR: %v", err)
+	}
+	query := parsed.Query()
+
+	f.mx.Lock()
+	defer f.mx.Unlock()
+
+	now := time.Now().Unix()
+	f.challenge = query.Get("code_challenge")
+	f.claims = map[string]interface{}{
+		"iss":                f.server.URL,
+		"sub":                "external-42",
+		"aud":                testClientId,
+		"exp":                now + 300,
+		"iat":                now,
+		"nonce":              query.Get("nonce"),
+		"email":              "user@example.com",
+		"email_verified":     true,
+		"preferred_username": "user",
+	}
+
+	return query
+}
+
+func (f *fakeProvider) setClaim(name string, value interface{}) {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+
+	f.claims[name] = value
+}
+
+func (f *fakeProvider) rotateKeys(kid string) {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+
+	f.keys = testKeyRing(f.t, kid)
+}
+
+func testKeyRing(t *testing.T, kid string) *jwt.KeyRing {
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("UNEXPECTED ERROR: %v", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		t.Fatalf("UNEXPECTED ERROR: %v", err)
+	}
+
+	keys, err := jwt.NewKeyRing(jwt.KeyRingConfig{
+		Signing: kid,
+		Keys: []jwt.KeyConfig{{
+			Id:    kid,
+			Alg:   jwt.AlgES256,
+			Value: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		}},
+	})
+	if err != nil {
+		t.Fatalf("UNEXPECTED ERROR: %v", err)
+	}
+
+	return keys
+}
+
+// signClaims signs claims set by test as ID token
+func signClaims(keys *jwt.KeyRing, claims map[string]interface{}) (string, error) {
+	idClaims := jwt.IdClaims{}
+	raw, _ := json.Marshal(claims)
+	err := json.Unmarshal(raw, &idClaims)
+	if err != nil {
+		return "", err
+	}
+	return jwt.CreateIdToken(keys, idClaims)
+}
+
+func newTestProvider(t *testing.T, f *fakeProvider) *Provider {
+	provider, err := NewProvider(ProviderConfig{
+		Name:         "fake",
+		Issuer:       f.server.URL,
+		ClientId:     testClientId,
+		ClientSecret: testClientSecret,
+		RedirectUri:  "https://alsiberij.com/login/fake",
+		Scopes:       []string{"email"},
+	}, f.server.Client())
+	if err != nil {
+		t.Fatalf("UNEXPECTED ERROR: %v", err)
+	}
+	return provider
+}
+
+func TestNewProvider(t *testing.T) {
+	_, err := NewProvider(ProviderConfig{Name: "fake", Issuer: "https://example.com"}, nil)
+	if err != ErrInvalidConfig {
+		t.Fatalf("INVALID ERROR. EXPECTED %v GOT %v", ErrInvalidConfig, err)
+	}
+}
+
+func TestExchange(t *testing.T) {
+	f := newFakeProvider(t)
+	provider := newTestProvider(t, f)
+
+	authUrl, err := provider.AuthCodeURL("state", "nonce", testVerifier)
+	if err != nil {
+		t.Fatalf("UNEXPECTED ERROR: %v", err)
+	}
+	if !strings.HasPrefix(authUrl, f.server.URL+"/authorize?") {
+		t.Fatalf("INVALID AUTHORIZATION URL: %s", authUrl)
+	}
+
+	query := f.authorize(authUrl)
+	if query.Get("scope") != "openid email" || query.Get("state") != "state" || query.Get("client_id") != testClientId ||
+		query.Get("code_challenge_method") != "S256" {
+		t.Fatalf("INVALID AUTHORIZATION PARAMETERS: %v", query)
+	}
+
+	identity, err := provider.Exchange(testCode, testVerifier, "nonce")
+	if err != nil {
+		t.Fatalf("UNEXPECTED ERROR: %v", err)
+	}
+	if identity.Subject != "external-42" || identity.Email != "user@example.com" || !identity.EmailVerified ||
+		identity.PreferredUsername != "user" {
+		t.Fatalf("INVALID IDENTITY: %+v", identity)
+	}
+
+	_, err = provider.Exchange(testCode, "wrong-verifier-wrong-verifier-wrong-verifier", "nonce")
+	if !errors.Is(err, ErrTokenExchange) {
+		t.Fatalf("INVALID ERROR. EXPECTED %v GOT %v", ErrTokenExchange, err)
+	}
+
+	_, err = provider.Exchange(testCode, testVerifier, "another nonce")
+	if err != ErrNonceMismatch {
+		t.Fatalf("INVALID ERROR. EXPECTED %v GOT %v", ErrNonceMismatch, err)
+	}
+}
+
+func TestInvalidIdToken(t *testing.T) {
+	f := newFakeProvider(t)
+	provider := newTestProvider(t, f)
+
+	authUrl, err := provider.AuthCodeURL("state", "nonce", testVerifier)
+	if err != nil {
+		t.Fatalf("UNEXPECTED ERROR: %v", err)
+	}
+
+	tests := map[string]interface{}{
+		"aud": "another client",
+		"iss": "https://another.example.com",
+		"exp": time.Now().Add(-time.Hour).Unix(),
+		"sub": "",
+	}
+
+	for claim, value := range tests {
+		f.authorize(authUrl)
+		f.setClaim(claim, value)
+
+		_, err = provider.Exchange(testCode, testVerifier, "nonce")
+		if !errors.Is(err, ErrInvalidIdToken) {
+			t.Fatalf("INVALID ERROR FOR %s. EXPECTED %v GOT %v", claim, ErrInvalidIdToken, err)
+		}
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	f := newFakeProvider(t)
+	provider := newTestProvider(t, f)
+
+	authUrl, err := provider.AuthCodeURL("state", "nonce", testVerifier)
+	if err != nil {
+		t.Fatalf("UNEXPECTED ERROR: %v", err)
+	}
+
+	f.authorize(authUrl)
+	_, err = provider.Exchange(testCode, testVerifier, "nonce")
+	if err != nil {
+		t.Fatalf("UNEXPECTED ERROR: %v", err)
+	}
+
+	// Keys are refetched once when token is signed with unknown key
+	f.rotateKeys("second")
+	provider.keysFetchedAt = time.Now().Add(-keysMinRefreshInterval)
+
+	f.authorize(authUrl)
+	_, err = provider.Exchange(testCode, testVerifier, "nonce")
+	if err != nil {
+		t.Fatalf("UNEXPECTED ERROR: %v", err)
+	}
+	if f.jwksRequests != 2 {
+		t.Fatalf("INVALID JWKS REQUESTS COUNT. EXPECTED %d GOT %d", 2, f.jwksRequests)
+	}
+
+	// Recently fetched keys are not refetched
+	f.rotateKeys("third")
+
+	f.authorize(authUrl)
+	_, err = provider.Exchange(testCode, testVerifier, "nonce")
+	if !errors.Is(err, ErrInvalidIdToken) {
+		t.Fatalf("INVALID ERROR. EXPECTED %v GOT %v", ErrInvalidIdToken, err)
+	}
+	if f.jwksRequests != 2 {
+		t.Fatalf("INVALID JWKS REQUESTS COUNT. EXPECTED %d GOT %d", 2, f.jwksRequests)
+	}
+}
@@ -0,0 +1,166 @@
+package passwords
+
+import (
+	"crypto/rand"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+)
+
+const (
+	AlgArgon2id = "argon2id"
+
+	legacySha512Length = sha512.Size * 2
+)
+
+type (
+	// Argon2idParams describes cost of argon2id hashing. Memory is measured in KiB
+	Argon2idParams struct {
+		Memory      uint32
+		Iterations  uint32
+		Parallelism uint8
+		SaltLength  uint32
+		KeyLength   uint32
+	}
+)
+
+var (
+	DefaultParams = Argon2idParams{
+		Memory:      19 * 1024,
+		Iterations:  2,
+		Parallelism: 1,
+		SaltLength:  16,
+		KeyLength:   32,
+	}
+
+	ErrInvalidHash         = errors.New("invalid password hash format")
+	ErrUnknownAlgorithm    = errors.New("unknown password hash algorithm")
+	ErrIncompatibleVersion = errors.New("incompatible argon2 version")
+
+	b64 = base64.RawStdEncoding
+
+	dummyHash, _ = Hash("dummy password")
+)
+
+// Hash returns self-describing argon2id hash of password in PHC string format:
+// $argon2id$v=19$m=<memory>,t=<iterations>,p=<parallelism>$<salt>$<hash>
+func Hash(password string) (string, error) {
+	return HashWithParams(password, DefaultParams)
+}
+
+func HashWithParams(password string, params Argon2idParams) (string, error) {
+	salt := make([]byte, params.SaltLength)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+
+	return fmt.Sprintf("$%s$v=%d$m=%d,t=%d,p=%d$%s$%s", AlgArgon2id, argon2.Version,
+		params.Memory, params.Iterations, params.Parallelism, b64.EncodeToString(salt), b64.EncodeToString(key)), nil
+}
+
+// Verify checks password against encoded hash. Besides argon2id it accepts bcrypt hashes and legacy
+// unsalted hex-encoded SHA-512 hashes. needsRehash is true when password matches but hash should be
+// replaced with a fresh one produced by Hash (legacy algorithm or outdated parameters)
+func Verify(password, encoded string) (ok bool, needsRehash bool, err error) {
+	switch {
+	case strings.HasPrefix(encoded, "$"+AlgArgon2id+"$"):
+		return verifyArgon2id(password, encoded)
+	case strings.HasPrefix(encoded, "$2a$"), strings.HasPrefix(encoded, "$2b$"), strings.HasPrefix(encoded, "$2y$"):
+		return verifyBcrypt(password, encoded)
+	case len(encoded) == legacySha512Length && !strings.HasPrefix(encoded, "$"):
+		return verifyLegacySha512(password, encoded)
+	default:
+		return false, false, ErrUnknownAlgorithm
+	}
+}
+
+// VerifyDummy spends the same time as Verify does for password hashed with default parameters.
+// It should be used when user is not found to make timing attacks harder
+func VerifyDummy(password string) {
+	_, _, _ = Verify(password, dummyHash)
+}
+
+func verifyArgon2id(password, encoded string) (bool, bool, error) {
+	params, salt, key, err := decodeArgon2id(encoded)
+	if err != nil {
+		return false, false, err
+	}
+
+	otherKey := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+	if subtle.ConstantTimeCompare(key, otherKey) != 1 {
+		return false, false, nil
+	}
+
+	return true, params != DefaultParams, nil
+}
+
+func decodeArgon2id(encoded string) (Argon2idParams, []byte, []byte, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		return Argon2idParams{}, nil, nil, ErrInvalidHash
+	}
+
+	var version int
+	_, err := fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil {
+		return Argon2idParams{}, nil, nil, ErrInvalidHash
+	}
+	if version != argon2.Version {
+		return Argon2idParams{}, nil, nil, ErrIncompatibleVersion
+	}
+
+	var params Argon2idParams
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism)
+	if err != nil || params.Memory == 0 || params.Iterations == 0 || params.Parallelism == 0 {
+		return Argon2idParams{}, nil, nil, ErrInvalidHash
+	}
+
+	salt, err := b64.DecodeString(parts[4])
+	if err != nil || len(salt) == 0 {
+		return Argon2idParams{}, nil, nil, ErrInvalidHash
+	}
+	params.SaltLength = uint32(len(salt))
+
+	key, err := b64.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return Argon2idParams{}, nil, nil, ErrInvalidHash
+	}
+	params.KeyLength = uint32(len(key))
+
+	return params, salt, key, nil
+}
+
+func verifyBcrypt(password, encoded string) (bool, bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	if err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, false, nil
+		}
+		return false, false, err
+	}
+
+	return true, true, nil
+}
+
+func verifyLegacySha512(password, encoded string) (bool, bool, error) {
+	expected, err := hex.DecodeString(encoded)
+	if err != nil {
+		return false, false, ErrInvalidHash
+	}
+
+	actual := sha512.Sum512([]byte(password))
+	if subtle.ConstantTimeCompare(expected, actual[:]) != 1 {
+		return false, false, nil
+	}
+
+	return true, true, nil
+}
@@ -0,0 +1,104 @@
+package passwords
+
+import (
+	"crypto/sha512"
+	"encoding/hex"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+	"testing"
+)
+
+func TestHash(t *testing.T) {
+	hash, err := Hash("pswd!@#$%^&*-+=123")
+	if err != nil {
+		t.Fatalf("UNEXPECTED ERROR: %v", err)
+	}
+
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=19456,t=2,p=1$") {
+		t.Fatalf("INVALID HASH FORMAT: %s", hash)
+	}
+
+	otherHash, _ := Hash("pswd!@#$%^&*-+=123")
+	if hash == otherHash {
+		t.Fatal("HASHES OF SAME PASSWORD SHOULD DIFFER")
+	}
+
+	ok, needsRehash, err := Verify("pswd!@#$%^&*-+=123", hash)
+	if err != nil {
+		t.Fatalf("UNEXPECTED ERROR: %v", err)
+	}
+	if !ok || needsRehash {
+		t.Fatalf("INVALID VERIFICATION RESULT. EXPECTED true false GOT %v %v", ok, needsRehash)
+	}
+
+	ok, _, err = Verify("wrong password", hash)
+	if err != nil {
+		t.Fatalf("UNEXPECTED ERROR: %v", err)
+	}
+	if ok {
+		t.Fatal("WRONG PASSWORD ACCEPTED")
+	}
+}
+
+func TestVerifyOutdated(t *testing.T) {
+	params := DefaultParams
+	params.Iterations = 1
+
+	hash, err := HashWithParams("password", params)
+	if err != nil {
+		t.Fatalf("UNEXPECTED ERROR: %v", err)
+	}
+
+	ok, needsRehash, err := Verify("password", hash)
+	if err != nil {
+		t.Fatalf("UNEXPECTED ERROR: %v", err)
+	}
+	if !ok || !needsRehash {
+		t.Fatalf("INVALID VERIFICATION RESULT. EXPECTED true true GOT %v %v", ok, needsRehash)
+	}
+}
+
+func TestVerifyLegacy(t *testing.T) {
+	sum := sha512.Sum512([]byte("password"))
+	legacy := hex.EncodeToString(sum[:])
+
+	ok, needsRehash, err := Verify("password", legacy)
+	if err != nil {
+		t.Fatalf("UNEXPECTED ERROR: %v", err)
+	}
+	if !ok || !needsRehash {
+		t.Fatalf("INVALID VERIFICATION RESULT. EXPECTED true true GOT %v %v", ok, needsRehash)
+	}
+
+	ok, _, _ = Verify("wrong password", legacy)
+	if ok {
+		t.Fatal("WRONG PASSWORD ACCEPTED")
+	}
+
+	bcryptHash, _ := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+
+	ok, needsRehash, err = Verify("password", string(bcryptHash))
+	if err != nil {
+		t.Fatalf("UNEXPECTED ERROR: %v", err)
+	}
+	if !ok || !needsRehash {
+		t.Fatalf("INVALID VERIFICATION RESULT. EXPECTED true true GOT %v %v", ok, needsRehash)
+	}
+}
+
+func TestVerifyInvalid(t *testing.T) {
+	for _, hash := range []string{
+		"",
+		"plain",
+		"$argon2id$v=19$m=19456,t=2,p=1$salt",
+		"$argon2id$v=18$m=19456,t=2,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=0,t=2,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=19456,t=2,p=1$!!!$a2V5",
+		strings.Repeat("z", 128),
+	} {
+		ok, _, err := Verify("password", hash)
+		if err == nil || ok {
+			t.Fatalf("EXPECTED ERROR FOR %q", hash)
+		}
+	}
+}
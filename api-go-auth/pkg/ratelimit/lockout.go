@@ -0,0 +1,109 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-redis/redis/v9"
+	"time"
+)
+
+const (
+	FailuresRedisKeyPattern = "LOCKOUT_FAILURES_%s_%s"
+	LockRedisKeyPattern     = "LOCKOUT_LOCK_%s_%s"
+)
+
+type (
+	// LockoutConfig locks key for Duration seconds after MaxFailures failures within Window seconds.
+	// Zero MaxFailures disables lockout
+	LockoutConfig struct {
+		MaxFailures int64 `json:"maxFailures"`
+		Window      int64 `json:"window"`
+		Duration    int64 `json:"duration"`
+	}
+
+	Lockout struct {
+		client *redis.Client
+		name   string
+		config LockoutConfig
+	}
+)
+
+var (
+	failureScript = redis.NewScript(`
+local failures = redis.call('INCR', KEYS[1])
+if failures == 1 then
+	redis.call('EXPIRE', KEYS[1], ARGV[1])
+end
+
+if failures >= tonumber(ARGV[2]) then
+	redis.call('DEL', KEYS[1])
+	redis.call('SET', KEYS[2], 1, 'EX', ARGV[3])
+	return tonumber(ARGV[3])
+end
+
+return 0
+`)
+)
+
+func NewLockout(client *redis.Client, name string, config LockoutConfig) *Lockout {
+	return &Lockout{
+		client: client,
+		name:   name,
+		config: config,
+	}
+}
+
+// Locked returns remaining lock time of key or zero if key is not locked
+func (l *Lockout) Locked(key string) (time.Duration, error) {
+	if l.config.MaxFailures <= 0 {
+		return 0, nil
+	}
+
+	if l.client == nil {
+		return 0, ErrNotInitialized
+	}
+
+	ttl, err := l.client.PTTL(context.Background(), fmt.Sprintf(LockRedisKeyPattern, l.name, key)).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	if ttl < 0 {
+		return 0, nil
+	}
+
+	return ttl, nil
+}
+
+// Fail registers failure for key. If it is the last allowed one, key is locked and lock duration is returned
+func (l *Lockout) Fail(key string) (time.Duration, error) {
+	if l.config.MaxFailures <= 0 {
+		return 0, nil
+	}
+
+	if l.client == nil {
+		return 0, ErrNotInitialized
+	}
+
+	locked, err := failureScript.Run(context.Background(), l.client,
+		[]string{fmt.Sprintf(FailuresRedisKeyPattern, l.name, key), fmt.Sprintf(LockRedisKeyPattern, l.name, key)},
+		l.config.Window, l.config.MaxFailures, l.config.Duration).Int64()
+	if err != nil {
+		return 0, err
+	}
+
+	return time.Duration(locked) * time.Second, nil
+}
+
+// Reset forgets failures of key
+func (l *Lockout) Reset(key string) error {
+	if l.config.MaxFailures <= 0 {
+		return nil
+	}
+
+	if l.client == nil {
+		return ErrNotInitialized
+	}
+
+	return l.client.Del(context.Background(), fmt.Sprintf(FailuresRedisKeyPattern, l.name, key)).Err()
+}
@@ -0,0 +1,89 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-redis/redis/v9"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	LimiterRedisKeyPattern = "RATE_LIMIT_%s_%s"
+)
+
+type (
+	// Limit allows Requests hits during any Period seconds. Zero Requests means no limit
+	Limit struct {
+		Requests int64 `json:"requests"`
+		Period   int64 `json:"period"`
+	}
+
+	// Limiter implements sliding window log stored in redis sorted sets
+	Limiter struct {
+		client *redis.Client
+		name   string
+		limit  Limit
+	}
+)
+
+var (
+	ErrNotInitialized = errors.New("nil db")
+
+	sequence uint64
+
+	slidingWindowScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now - window)
+
+if redis.call('ZCARD', KEYS[1]) < limit then
+	redis.call('ZADD', KEYS[1], now, ARGV[4])
+	redis.call('PEXPIRE', KEYS[1], window)
+	return 0
+end
+
+local oldest = redis.call('ZRANGE', KEYS[1], 0, 0, 'WITHSCORES')
+return tonumber(oldest[2]) + window - now
+`)
+)
+
+// NewLimiter creates limiter. Name separates counters of different limiters sharing the same keys
+func NewLimiter(client *redis.Client, name string, limit Limit) *Limiter {
+	return &Limiter{
+		client: client,
+		name:   name,
+		limit:  limit,
+	}
+}
+
+// Allow registers hit for key. If limit is exceeded, hit is not registered and time to wait is returned
+func (l *Limiter) Allow(key string) (bool, time.Duration, error) {
+	if l.limit.Requests <= 0 {
+		return true, 0, nil
+	}
+
+	if l.client == nil {
+		return false, 0, ErrNotInitialized
+	}
+
+	now := time.Now().UnixMilli()
+	member := strconv.FormatInt(now, 10) + "-" + strconv.FormatUint(atomic.AddUint64(&sequence, 1), 10)
+
+	wait, err := slidingWindowScript.Run(context.Background(), l.client,
+		[]string{fmt.Sprintf(LimiterRedisKeyPattern, l.name, key)},
+		now, l.limit.Period*1000, l.limit.Requests, member).Int64()
+	if err != nil {
+		return false, 0, err
+	}
+
+	if wait > 0 {
+		return false, time.Duration(wait) * time.Millisecond, nil
+	}
+
+	return true, 0, nil
+}
@@ -0,0 +1,115 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-redis/redis/v9"
+	"os"
+	"testing"
+	"time"
+)
+
+// testClient connects to redis from REDIS_ADDR environment variable. Tests are skipped if it is not set
+func testClient(t *testing.T) *redis.Client {
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		t.Skip("REDIS_ADDR IS NOT SET")
+	}
+
+	client := redis.NewClient(&redis.Options{Addr: addr, Password: os.Getenv("REDIS_PASSWORD")})
+	err := client.Ping(context.Background()).Err()
+	if err != nil {
+		t.Fatalf("UNABLE CONNECT TO REDIS: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = client.Close()
+	})
+
+	return client
+}
+
+func TestLimiter(t *testing.T) {
+	client := testClient(t)
+	key := fmt.Sprintf("test-%d", time.Now().UnixNano())
+
+	l := NewLimiter(client, "TEST", Limit{Requests: 3, Period: 2})
+
+	for i := 0; i < 3; i++ {
+		ok, _, err := l.Allow(key)
+		if err != nil {
+			t.Fatalf("UNEXPECTED ERROR: %v", err)
+		}
+		if !ok {
+			t.Fatalf("HIT #%d SHOULD BE ALLOWED", i)
+		}
+	}
+
+	ok, wait, err := l.Allow(key)
+	if err != nil {
+		t.Fatalf("UNEXPECTED ERROR: %v", err)
+	}
+	if ok || wait <= 0 || wait > 2*time.Second {
+		t.Fatalf("HIT SHOULD BE REJECTED. GOT %v %v", ok, wait)
+	}
+
+	time.Sleep(wait)
+
+	ok, _, err = l.Allow(key)
+	if err != nil {
+		t.Fatalf("UNEXPECTED ERROR: %v", err)
+	}
+	if !ok {
+		t.Fatal("HIT AFTER WAITING SHOULD BE ALLOWED")
+	}
+}
+
+func TestLockout(t *testing.T) {
+	client := testClient(t)
+	key := fmt.Sprintf("test-%d", time.Now().UnixNano())
+
+	l := NewLockout(client, "TEST", LockoutConfig{MaxFailures: 2, Window: 10, Duration: 1})
+
+	locked, err := l.Fail(key)
+	if err != nil || locked != 0 {
+		t.Fatalf("KEY SHOULD NOT BE LOCKED. GOT %v %v", locked, err)
+	}
+
+	err = l.Reset(key)
+	if err != nil {
+		t.Fatalf("UNEXPECTED ERROR: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		locked, err = l.Fail(key)
+		if err != nil {
+			t.Fatalf("UNEXPECTED ERROR: %v", err)
+		}
+	}
+	if locked != time.Second {
+		t.Fatalf("KEY SHOULD BE LOCKED. GOT %v", locked)
+	}
+
+	remaining, err := l.Locked(key)
+	if err != nil || remaining <= 0 {
+		t.Fatalf("KEY SHOULD BE LOCKED. GOT %v %v", remaining, err)
+	}
+
+	time.Sleep(remaining + 100*time.Millisecond)
+
+	remaining, err = l.Locked(key)
+	if err != nil || remaining != 0 {
+		t.Fatalf("KEY SHOULD NOT BE LOCKED. GOT %v %v", remaining, err)
+	}
+}
+
+func TestDisabled(t *testing.T) {
+	ok, _, err := NewLimiter(nil, "TEST", Limit{}).Allow("key")
+	if err != nil || !ok {
+		t.Fatalf("DISABLED LIMITER SHOULD ALLOW. GOT %v %v", ok, err)
+	}
+
+	locked, err := NewLockout(nil, "TEST", LockoutConfig{}).Fail("key")
+	if err != nil || locked != 0 {
+		t.Fatalf("DISABLED LOCKOUT SHOULD NOT LOCK. GOT %v %v", locked, err)
+	}
+}
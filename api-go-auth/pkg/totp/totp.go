@@ -0,0 +1,134 @@
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+const (
+	DefaultDigits = 6
+	DefaultPeriod = 30
+	DefaultSkew   = 1
+
+	SecretLength = 20
+)
+
+type (
+	// Params describes TOTP generator according to RFC 6238. Period is measured in seconds,
+	// Skew is number of periods before and after current one that are accepted as well
+	Params struct {
+		Digits int
+		Period int64
+		Skew   int64
+	}
+)
+
+var (
+	DefaultParams = Params{
+		Digits: DefaultDigits,
+		Period: DefaultPeriod,
+		Skew:   DefaultSkew,
+	}
+
+	ErrInvalidSecret = errors.New("invalid totp secret")
+
+	b32 = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+	powers = [...]uint32{1, 10, 100, 1000, 10000, 100000, 1000000, 10000000, 100000000, 1000000000}
+)
+
+// GenerateSecret returns random secret of recommended length
+func GenerateSecret() ([]byte, error) {
+	secret := make([]byte, SecretLength)
+	_, err := rand.Read(secret)
+	if err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+// EncodeSecret returns secret in base32 form that is used by authenticator apps
+func EncodeSecret(secret []byte) string {
+	return b32.EncodeToString(secret)
+}
+
+func DecodeSecret(encoded string) ([]byte, error) {
+	secret, err := b32.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidSecret
+	}
+	return secret, nil
+}
+
+// URI returns otpauth URI that can be rendered as QR code for authenticator apps
+func URI(issuer, account string, secret []byte, params Params) string {
+	query := url.Values{}
+	query.Set("secret", EncodeSecret(secret))
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(params.Digits))
+	query.Set("period", fmt.Sprint(params.Period))
+
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + issuer + ":" + account,
+		RawQuery: query.Encode(),
+	}
+
+	return u.String()
+}
+
+// HOTP returns code for counter according to RFC 4226
+func HOTP(secret []byte, counter uint64, digits int) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	return fmt.Sprintf("%0*d", digits, value%powers[digits])
+}
+
+// Step returns number of period that contains t
+func (p Params) Step(t time.Time) int64 {
+	return t.Unix() / p.Period
+}
+
+// Code returns code that is valid at t
+func (p Params) Code(secret []byte, t time.Time) string {
+	return HOTP(secret, uint64(p.Step(t)), p.Digits)
+}
+
+// Validate checks code against steps around t. Step that matched is returned, so caller can
+// reject codes of steps that were already used
+func (p Params) Validate(secret []byte, code string, t time.Time) (bool, int64) {
+	if len(code) != p.Digits {
+		return false, 0
+	}
+
+	current := p.Step(t)
+	for step := current - p.Skew; step <= current+p.Skew; step++ {
+		if step < 0 {
+			continue
+		}
+		expected := HOTP(secret, uint64(step), p.Digits)
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return true, step
+		}
+	}
+
+	return false, 0
+}
@@ -0,0 +1,115 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	// RFC 4226 Appendix D and RFC 6238 Appendix B secret
+	rfcSecret = []byte("12345678901234567890")
+)
+
+func TestHOTP(t *testing.T) {
+	expected := []string{"755224", "287082", "359152", "969429", "338314",
+		"254676", "287922", "162583", "399871", "520489"}
+
+	for counter, code := range expected {
+		result := HOTP(rfcSecret, uint64(counter), 6)
+		if result != code {
+			t.Fatalf("INVALID CODE FOR COUNTER %d. EXPECTED %s GOT %s", counter, code, result)
+		}
+	}
+}
+
+func TestCode(t *testing.T) {
+	params := Params{Digits: 8, Period: 30}
+
+	cases := []struct {
+		unix int64
+		code string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+
+	for _, c := range cases {
+		result := params.Code(rfcSecret, time.Unix(c.unix, 0))
+		if result != c.code {
+			t.Fatalf("INVALID CODE AT %d. EXPECTED %s GOT %s", c.unix, c.code, result)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatalf("UNEXPECTED ERROR: %v", err)
+	}
+
+	now := time.Unix(1665400000, 0)
+	step := DefaultParams.Step(now)
+
+	ok, matched := DefaultParams.Validate(secret, DefaultParams.Code(secret, now), now)
+	if !ok || matched != step {
+		t.Fatalf("INVALID VALIDATION RESULT. EXPECTED true %d GOT %v %d", step, ok, matched)
+	}
+
+	previous := now.Add(-DefaultPeriod * time.Second)
+	ok, matched = DefaultParams.Validate(secret, DefaultParams.Code(secret, previous), now)
+	if !ok || matched != step-1 {
+		t.Fatalf("INVALID VALIDATION RESULT. EXPECTED true %d GOT %v %d", step-1, ok, matched)
+	}
+
+	outdated := now.Add(-2 * DefaultPeriod * time.Second)
+	code := DefaultParams.Code(secret, outdated)
+	if code != DefaultParams.Code(secret, now) && code != DefaultParams.Code(secret, previous) &&
+		code != DefaultParams.Code(secret, now.Add(DefaultPeriod*time.Second)) {
+		ok, _ = DefaultParams.Validate(secret, code, now)
+		if ok {
+			t.Fatal("OUTDATED CODE ACCEPTED")
+		}
+	}
+
+	ok, _ = DefaultParams.Validate(secret, "12345", now)
+	if ok {
+		t.Fatal("CODE OF INVALID LENGTH ACCEPTED")
+	}
+}
+
+func TestSecretEncoding(t *testing.T) {
+	encoded := EncodeSecret(rfcSecret)
+	if encoded != "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ" {
+		t.Fatalf("INVALID ENCODED SECRET: %s", encoded)
+	}
+
+	decoded, err := DecodeSecret(encoded)
+	if err != nil {
+		t.Fatalf("UNEXPECTED ERROR: %v", err)
+	}
+	if string(decoded) != string(rfcSecret) {
+		t.Fatalf("INVALID DECODED SECRET: %s", decoded)
+	}
+
+	_, err = DecodeSecret("1!")
+	if err != ErrInvalidSecret {
+		t.Fatalf("UNEXPECTED ERROR. EXPECTED %v GOT %v", ErrInvalidSecret, err)
+	}
+}
+
+func TestURI(t *testing.T) {
+	uri := URI("Alsiberij", "username123", rfcSecret, DefaultParams)
+
+	if !strings.HasPrefix(uri, "otpauth://totp/Alsiberij:username123?") {
+		t.Fatalf("INVALID URI: %s", uri)
+	}
+	if !strings.Contains(uri, "secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ") || !strings.Contains(uri, "issuer=Alsiberij") ||
+		!strings.Contains(uri, "digits=6") || !strings.Contains(uri, "period=30") {
+		t.Fatalf("INVALID URI: %s", uri)
+	}
+}
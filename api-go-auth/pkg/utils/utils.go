@@ -1,70 +1,54 @@
 package utils
 
 import (
-	"math/rand"
-	"sync"
+	cryptorand "crypto/rand"
+	"errors"
 	"unsafe"
 )
 
-type (
-	Random struct {
-		rand *rand.Rand
-		mx   sync.Mutex
-	}
+const (
+	digits = "0123456789"
+)
 
+type (
 	Searchable interface {
 		string
 	}
 )
 
-func NewRandom(seed int64) *Random {
-	return &Random{
-		rand: rand.New(rand.NewSource(seed)),
-		mx:   sync.Mutex{},
-	}
-}
-
-func (r *Random) Int() int {
-	if r.rand == nil {
-		return 0
+// SecureString returns string of characters from alphabet read from crypto/rand. It must be used for any value that
+// grants access, since output of math/rand can be predicted. Bytes that would make distribution uneven are skipped
+func SecureString(length uint, alphabet string) (string, error) {
+	if len(alphabet) == 0 || len(alphabet) > 256 {
+		return "", errors.New("alphabet length must be from 1 to 256")
 	}
 
-	r.mx.Lock()
-	defer r.mx.Unlock()
+	limit := 256 - 256%len(alphabet)
+	result := make([]byte, 0, length)
+	buf := make([]byte, length)
 
-	return r.rand.Int()
-}
-
-func (r *Random) String(length uint, alphabet string) string {
-	if r.rand == nil {
-		return ""
-	}
-
-	result := make([]byte, length)
-
-	r.mx.Lock()
-	defer r.mx.Unlock()
+	for uint(len(result)) < length {
+		_, err := cryptorand.Read(buf)
+		if err != nil {
+			return "", err
+		}
 
-	for i := range result {
-		result[i] = alphabet[r.rand.Int()%len(alphabet)]
+		for _, b := range buf {
+			if int(b) >= limit {
+				continue
+			}
+			result = append(result, alphabet[int(b)%len(alphabet)])
+			if uint(len(result)) == length {
+				break
+			}
+		}
 	}
-	return BytesToString(result)
+	return BytesToString(result), nil
 }
 
-func (r *Random) Code(length uint) string {
-	if r.rand == nil {
-		return ""
-	}
-
-	result := make([]byte, length)
-
-	r.mx.Lock()
-	defer r.mx.Unlock()
-
-	for i := range result {
-		result[i] = byte(r.rand.Int()%10 + '0')
-	}
-	return BytesToString(result)
+// SecureCode returns numeric code read from crypto/rand
+func SecureCode(length uint) (string, error) {
+	return SecureString(length, digits)
 }
 
 func ExistsIn[T Searchable](haystack []T, needle T) bool {
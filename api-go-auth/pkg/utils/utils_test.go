@@ -0,0 +1,51 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSecureString(t *testing.T) {
+	const alphabet = "abc"
+
+	seen := make(map[rune]bool)
+	for i := 0; i < 100; i++ {
+		s, err := SecureString(32, alphabet)
+		if err != nil {
+			t.Fatalf("UNEXPECTED ERROR: %v", err)
+		}
+		if len(s) != 32 {
+			t.Fatalf("INVALID LENGTH. EXPECTED %d GOT %d", 32, len(s))
+		}
+		for _, c := range s {
+			if !strings.ContainsRune(alphabet, c) {
+				t.Fatalf("UNEXPECTED CHARACTER %q", c)
+			}
+			seen[c] = true
+		}
+	}
+	if len(seen) != len(alphabet) {
+		t.Fatalf("NOT EVERY CHARACTER IS USED. GOT %d OF %d", len(seen), len(alphabet))
+	}
+
+	a, _ := SecureString(64, alphabet)
+	b, _ := SecureString(64, alphabet)
+	if a == b {
+		t.Fatal("EXPECTED DIFFERENT STRINGS")
+	}
+
+	_, err := SecureString(8, "")
+	if err == nil {
+		t.Fatal("EXPECTED ALPHABET ERROR")
+	}
+}
+
+func TestSecureCode(t *testing.T) {
+	code, err := SecureCode(8)
+	if err != nil {
+		t.Fatalf("UNEXPECTED ERROR: %v", err)
+	}
+	if len(code) != 8 || strings.Trim(code, digits) != "" {
+		t.Fatalf("INVALID CODE %s", code)
+	}
+}
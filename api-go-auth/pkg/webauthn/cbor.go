@@ -0,0 +1,191 @@
+package webauthn
+
+import (
+	"errors"
+	"math"
+)
+
+const (
+	cborMaxDepth = 16
+
+	cborUnsigned = 0
+	cborNegative = 1
+	cborBytes    = 2
+	cborText     = 3
+	cborArray    = 4
+	cborMap      = 5
+	cborSimple   = 7
+
+	cborFalse = 20
+	cborTrue  = 21
+	cborNull  = 22
+)
+
+var (
+	ErrInvalidCbor     = errors.New("invalid CBOR")
+	ErrUnsupportedCbor = errors.New("unsupported CBOR item")
+)
+
+type (
+	// cborDecoder supports subset of CBOR that is used by authenticators: integers, byte and text strings,
+	// definite length arrays and maps, booleans and null. Integers are decoded as int64, maps as
+	// map[interface{}]interface{} with int64 or string keys
+	cborDecoder struct {
+		data []byte
+		pos  int
+	}
+)
+
+// decodeCbor decodes first item of data and returns number of bytes it occupies
+func decodeCbor(data []byte) (interface{}, int, error) {
+	d := cborDecoder{data: data}
+
+	item, err := d.decode(0)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return item, d.pos, nil
+}
+
+func (d *cborDecoder) decode(depth int) (interface{}, error) {
+	if depth > cborMaxDepth || d.pos >= len(d.data) {
+		return nil, ErrInvalidCbor
+	}
+
+	initial := d.data[d.pos]
+	d.pos++
+
+	major, info := initial>>5, initial&0x1f
+
+	if major == cborSimple {
+		switch info {
+		case cborFalse:
+			return false, nil
+		case cborTrue:
+			return true, nil
+		case cborNull:
+			return nil, nil
+		default:
+			return nil, ErrUnsupportedCbor
+		}
+	}
+
+	arg, err := d.argument(info)
+	if err != nil {
+		return nil, err
+	}
+
+	switch major {
+	case cborUnsigned:
+		if arg > math.MaxInt64 {
+			return nil, ErrUnsupportedCbor
+		}
+		return int64(arg), nil
+
+	case cborNegative:
+		if arg > math.MaxInt64 {
+			return nil, ErrUnsupportedCbor
+		}
+		return -1 - int64(arg), nil
+
+	case cborBytes, cborText:
+		raw, err := d.read(arg)
+		if err != nil {
+			return nil, err
+		}
+		if major == cborText {
+			return string(raw), nil
+		}
+		return append([]byte(nil), raw...), nil
+
+	case cborArray:
+		// Every item occupies at least one byte, so length can not exceed remaining data
+		if arg > uint64(len(d.data)-d.pos) {
+			return nil, ErrInvalidCbor
+		}
+		array := make([]interface{}, 0, arg)
+		for i := uint64(0); i < arg; i++ {
+			item, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			array = append(array, item)
+		}
+		return array, nil
+
+	case cborMap:
+		if arg > uint64(len(d.data)-d.pos)/2 {
+			return nil, ErrInvalidCbor
+		}
+		m := make(map[interface{}]interface{}, arg)
+		for i := uint64(0); i < arg; i++ {
+			key, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, ErrUnsupportedCbor
+			}
+			if _, exists := m[key]; exists {
+				return nil, ErrInvalidCbor
+			}
+
+			value, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			m[key] = value
+		}
+		return m, nil
+
+	default:
+		return nil, ErrUnsupportedCbor
+	}
+}
+
+// argument reads value that follows initial byte. Indefinite lengths are not supported
+func (d *cborDecoder) argument(info byte) (uint64, error) {
+	if info < 24 {
+		return uint64(info), nil
+	}
+
+	var size int
+	switch info {
+	case 24:
+		size = 1
+	case 25:
+		size = 2
+	case 26:
+		size = 4
+	case 27:
+		size = 8
+	default:
+		return 0, ErrUnsupportedCbor
+	}
+
+	raw, err := d.read(uint64(size))
+	if err != nil {
+		return 0, err
+	}
+
+	var arg uint64
+	for _, b := range raw {
+		arg = arg<<8 | uint64(b)
+	}
+
+	return arg, nil
+}
+
+func (d *cborDecoder) read(n uint64) ([]byte, error) {
+	if n > uint64(len(d.data)-d.pos) {
+		return nil, ErrInvalidCbor
+	}
+
+	raw := d.data[d.pos : d.pos+int(n)]
+	d.pos += int(n)
+
+	return raw, nil
+}
@@ -0,0 +1,146 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"math/big"
+)
+
+const (
+	AlgES256 = -7
+	AlgEdDSA = -8
+	AlgRS256 = -257
+
+	coseKeyType = 1
+	coseKeyAlg  = 3
+
+	coseEc2Curve = -1
+	coseEc2X     = -2
+	coseEc2Y     = -3
+
+	coseOkpCurve = -1
+	coseOkpX     = -2
+
+	coseRsaN = -1
+	coseRsaE = -2
+
+	coseKtyOkp = 1
+	coseKtyEc2 = 2
+	coseKtyRsa = 3
+
+	coseCrvP256    = 1
+	coseCrvEd25519 = 6
+
+	minRsaKeySize = 2048
+)
+
+type (
+	// PublicKey is credential public key decoded from COSE_Key structure
+	PublicKey struct {
+		alg int64
+		key crypto.PublicKey
+	}
+)
+
+var (
+	ErrUnsupportedKey   = errors.New("unsupported credential public key")
+	ErrInvalidSignature = errors.New("invalid signature")
+)
+
+// ParsePublicKey decodes COSE_Key. Only ES256 (P-256), EdDSA (Ed25519) and RS256 keys are supported
+func ParsePublicKey(cose []byte) (*PublicKey, error) {
+	item, n, err := decodeCbor(cose)
+	if err != nil {
+		return nil, err
+	}
+	if n != len(cose) {
+		return nil, ErrInvalidCbor
+	}
+
+	m, ok := item.(map[interface{}]interface{})
+	if !ok {
+		return nil, ErrUnsupportedKey
+	}
+
+	kty, _ := m[int64(coseKeyType)].(int64)
+	alg, _ := m[int64(coseKeyAlg)].(int64)
+
+	switch {
+	case kty == coseKtyEc2 && alg == AlgES256:
+		crv, _ := m[int64(coseEc2Curve)].(int64)
+		x, _ := m[int64(coseEc2X)].([]byte)
+		y, _ := m[int64(coseEc2Y)].([]byte)
+		if crv != coseCrvP256 || len(x) != 32 || len(y) != 32 {
+			return nil, ErrUnsupportedKey
+		}
+
+		key := &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}
+		if !key.Curve.IsOnCurve(key.X, key.Y) {
+			return nil, ErrUnsupportedKey
+		}
+		return &PublicKey{alg: alg, key: key}, nil
+
+	case kty == coseKtyOkp && alg == AlgEdDSA:
+		crv, _ := m[int64(coseOkpCurve)].(int64)
+		x, _ := m[int64(coseOkpX)].([]byte)
+		if crv != coseCrvEd25519 || len(x) != ed25519.PublicKeySize {
+			return nil, ErrUnsupportedKey
+		}
+		return &PublicKey{alg: alg, key: ed25519.PublicKey(x)}, nil
+
+	case kty == coseKtyRsa && alg == AlgRS256:
+		n, _ := m[int64(coseRsaN)].([]byte)
+		e, _ := m[int64(coseRsaE)].([]byte)
+		if len(n)*8 < minRsaKeySize || len(e) == 0 || len(e) > 4 {
+			return nil, ErrUnsupportedKey
+		}
+
+		exponent := 0
+		for _, b := range e {
+			exponent = exponent<<8 | int(b)
+		}
+		if exponent < 3 {
+			return nil, ErrUnsupportedKey
+		}
+
+		return &PublicKey{alg: alg, key: &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: exponent}}, nil
+
+	default:
+		return nil, ErrUnsupportedKey
+	}
+}
+
+func (k *PublicKey) Alg() int64 {
+	return k.alg
+}
+
+// Verify checks signature of data. ES256 signatures are expected in ASN.1 DER form as produced by authenticators
+func (k *PublicKey) Verify(data, signature []byte) error {
+	var ok bool
+
+	switch key := k.key.(type) {
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(data)
+		ok = ecdsa.VerifyASN1(key, digest[:], signature)
+	case ed25519.PublicKey:
+		ok = ed25519.Verify(key, data, signature)
+	case *rsa.PublicKey:
+		digest := sha256.Sum256(data)
+		ok = rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) == nil
+	}
+
+	if !ok {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
@@ -0,0 +1,424 @@
+package webauthn
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+const (
+	TypePublicKey = "public-key"
+
+	UserVerificationRequired    = "required"
+	UserVerificationPreferred   = "preferred"
+	UserVerificationDiscouraged = "discouraged"
+
+	ChallengeLength = 32
+
+	clientDataTypeCreate = "webauthn.create"
+	clientDataTypeGet    = "webauthn.get"
+
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttested     = 0x40
+
+	authDataMinLength      = 37
+	attestedDataMinLength  = 18
+	maxCredentialIdLength  = 1023
+	rpIdHashLength         = sha256.Size
+	signCountOffset        = rpIdHashLength + 1
+	attestedDataOffset     = authDataMinLength
+	credentialIdLenOffset  = attestedDataOffset + 16
+	credentialIdDataOffset = credentialIdLenOffset + 2
+)
+
+type (
+	// Config describes relying party. Origins are full origins of pages that are allowed to start ceremonies,
+	// e.g. https://alsiberij.com. UserVerification is one of required, preferred or discouraged
+	Config struct {
+		RpId             string   `json:"rpId"`
+		RpName           string   `json:"rpName"`
+		Origins          []string `json:"origins"`
+		UserVerification string   `json:"userVerification"`
+	}
+
+	RelyingParty struct {
+		Id   string `json:"id"`
+		Name string `json:"name"`
+	}
+
+	// User describes account that credential is created for. Id is base64url encoded user handle
+	User struct {
+		Id          string `json:"id"`
+		Name        string `json:"name"`
+		DisplayName string `json:"displayName"`
+	}
+
+	CredentialParameter struct {
+		Type string `json:"type"`
+		Alg  int64  `json:"alg"`
+	}
+
+	CredentialDescriptor struct {
+		Type string `json:"type"`
+		Id   string `json:"id"`
+	}
+
+	AuthenticatorSelection struct {
+		ResidentKey      string `json:"residentKey"`
+		UserVerification string `json:"userVerification"`
+	}
+
+	// CreationOptions are passed to navigator.credentials.create(). All binary values are base64url encoded
+	CreationOptions struct {
+		Challenge              string                 `json:"challenge"`
+		Rp                     RelyingParty           `json:"rp"`
+		User                   User                   `json:"user"`
+		PubKeyCredParams       []CredentialParameter  `json:"pubKeyCredParams"`
+		Timeout                int64                  `json:"timeout"`
+		ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+		AuthenticatorSelection AuthenticatorSelection `json:"authenticatorSelection"`
+		Attestation            string                 `json:"attestation"`
+	}
+
+	// RequestOptions are passed to navigator.credentials.get(). All binary values are base64url encoded
+	RequestOptions struct {
+		Challenge        string `json:"challenge"`
+		Timeout          int64  `json:"timeout"`
+		RpId             string `json:"rpId"`
+		UserVerification string `json:"userVerification"`
+	}
+
+	// AttestationResponse is result of navigator.credentials.create(). All binary values are base64url encoded
+	AttestationResponse struct {
+		Id       string `json:"id"`
+		RawId    string `json:"rawId"`
+		Type     string `json:"type"`
+		Response struct {
+			ClientDataJSON    string `json:"clientDataJSON"`
+			AttestationObject string `json:"attestationObject"`
+		} `json:"response"`
+	}
+
+	// AssertionResponse is result of navigator.credentials.get(). All binary values are base64url encoded
+	AssertionResponse struct {
+		Id       string `json:"id"`
+		RawId    string `json:"rawId"`
+		Type     string `json:"type"`
+		Response struct {
+			ClientDataJSON    string `json:"clientDataJSON"`
+			AuthenticatorData string `json:"authenticatorData"`
+			Signature         string `json:"signature"`
+			UserHandle        string `json:"userHandle"`
+		} `json:"response"`
+	}
+
+	// Credential is registered credential. PublicKey is kept in COSE_Key form
+	Credential struct {
+		Id           []byte
+		PublicKey    []byte
+		SignCount    uint32
+		UserVerified bool
+	}
+
+	authenticatorData struct {
+		rpIdHash     []byte
+		flags        byte
+		signCount    uint32
+		credentialId []byte
+		publicKey    []byte
+	}
+
+	clientData struct {
+		Type      string `json:"type"`
+		Challenge string `json:"challenge"`
+		Origin    string `json:"origin"`
+	}
+)
+
+var (
+	ErrMalformed           = errors.New("malformed webauthn response")
+	ErrInvalidType         = errors.New("invalid client data type")
+	ErrChallengeMismatch   = errors.New("challenge does not match")
+	ErrOriginMismatch      = errors.New("origin is not allowed")
+	ErrRpIdMismatch        = errors.New("relying party id does not match")
+	ErrUserNotPresent      = errors.New("user presence is not confirmed")
+	ErrUserNotVerified     = errors.New("user verification is required")
+	ErrNoAttestedData      = errors.New("attested credential data is missing")
+	ErrCredentialMismatch  = errors.New("credential id does not match")
+	ErrSignCountNotGreater = errors.New("signature counter did not increase, credential may be cloned")
+
+	b64 = base64.RawURLEncoding
+
+	supportedAlgorithms = []CredentialParameter{
+		{Type: TypePublicKey, Alg: AlgES256},
+		{Type: TypePublicKey, Alg: AlgEdDSA},
+		{Type: TypePublicKey, Alg: AlgRS256},
+	}
+)
+
+// NewChallenge returns random base64url encoded challenge
+func NewChallenge() (string, error) {
+	challenge := make([]byte, ChallengeLength)
+	_, err := rand.Read(challenge)
+	if err != nil {
+		return "", err
+	}
+	return b64.EncodeToString(challenge), nil
+}
+
+func EncodeId(id []byte) string {
+	return b64.EncodeToString(id)
+}
+
+// DecodeId decodes base64url value. Padding is tolerated since some clients keep it
+func DecodeId(id string) ([]byte, error) {
+	decoded, err := b64.DecodeString(strings.TrimRight(id, "="))
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	return decoded, nil
+}
+
+// CreationOptions returns options of registration ceremony. Credentials in exclude are already registered
+// for user and will not be created again. Discoverable credentials are preferred so they can be used without login
+func (c Config) CreationOptions(challenge string, user User, exclude [][]byte, timeout time.Duration) CreationOptions {
+	descriptors := make([]CredentialDescriptor, len(exclude))
+	for i, id := range exclude {
+		descriptors[i] = CredentialDescriptor{Type: TypePublicKey, Id: EncodeId(id)}
+	}
+
+	return CreationOptions{
+		Challenge:          challenge,
+		Rp:                 RelyingParty{Id: c.RpId, Name: c.RpName},
+		User:               user,
+		PubKeyCredParams:   supportedAlgorithms,
+		Timeout:            timeout.Milliseconds(),
+		ExcludeCredentials: descriptors,
+		AuthenticatorSelection: AuthenticatorSelection{
+			ResidentKey:      "preferred",
+			UserVerification: c.userVerification(),
+		},
+		Attestation: "none",
+	}
+}
+
+// RequestOptions returns options of authentication ceremony with discoverable credentials
+func (c Config) RequestOptions(challenge string, timeout time.Duration) RequestOptions {
+	return RequestOptions{
+		Challenge:        challenge,
+		Timeout:          timeout.Milliseconds(),
+		RpId:             c.RpId,
+		UserVerification: c.userVerification(),
+	}
+}
+
+func (c Config) userVerification() string {
+	if c.UserVerification == "" {
+		return UserVerificationPreferred
+	}
+	return c.UserVerification
+}
+
+// VerifyRegistration checks result of registration ceremony and returns new credential.
+// Attestation statement is not verified since attestation is not requested
+func (c Config) VerifyRegistration(challenge string, response AttestationResponse) (*Credential, error) {
+	if response.Type != TypePublicKey {
+		return nil, ErrMalformed
+	}
+
+	_, err := c.verifyClientData(response.Response.ClientDataJSON, clientDataTypeCreate, challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	rawAttestation, err := DecodeId(response.Response.AttestationObject)
+	if err != nil {
+		return nil, err
+	}
+
+	item, n, err := decodeCbor(rawAttestation)
+	if err != nil {
+		return nil, err
+	}
+	attestation, ok := item.(map[interface{}]interface{})
+	if !ok || n != len(rawAttestation) {
+		return nil, ErrMalformed
+	}
+	rawAuthData, ok := attestation["authData"].([]byte)
+	if !ok {
+		return nil, ErrMalformed
+	}
+
+	authData, err := c.verifyAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	if authData.flags&flagAttested == 0 {
+		return nil, ErrNoAttestedData
+	}
+
+	rawId, err := DecodeId(response.RawId)
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare(rawId, authData.credentialId) != 1 {
+		return nil, ErrCredentialMismatch
+	}
+
+	_, err = ParsePublicKey(authData.publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Credential{
+		Id:           authData.credentialId,
+		PublicKey:    authData.publicKey,
+		SignCount:    authData.signCount,
+		UserVerified: authData.flags&flagUserVerified != 0,
+	}, nil
+}
+
+// VerifyAssertion checks result of authentication ceremony against registered credential and returns new value
+// of signature counter. Counter that did not increase is treated as sign of cloned authenticator,
+// unless authenticator does not support counters at all
+func (c Config) VerifyAssertion(challenge string, response AssertionResponse, publicKey []byte, signCount uint32) (uint32, error) {
+	if response.Type != TypePublicKey {
+		return 0, ErrMalformed
+	}
+
+	rawClientData, err := c.verifyClientData(response.Response.ClientDataJSON, clientDataTypeGet, challenge)
+	if err != nil {
+		return 0, err
+	}
+
+	rawAuthData, err := DecodeId(response.Response.AuthenticatorData)
+	if err != nil {
+		return 0, err
+	}
+
+	authData, err := c.verifyAuthenticatorData(rawAuthData)
+	if err != nil {
+		return 0, err
+	}
+
+	signature, err := DecodeId(response.Response.Signature)
+	if err != nil {
+		return 0, err
+	}
+
+	key, err := ParsePublicKey(publicKey)
+	if err != nil {
+		return 0, err
+	}
+
+	clientDataHash := sha256.Sum256(rawClientData)
+	err = key.Verify(append(append([]byte(nil), rawAuthData...), clientDataHash[:]...), signature)
+	if err != nil {
+		return 0, err
+	}
+
+	if (authData.signCount != 0 || signCount != 0) && authData.signCount <= signCount {
+		return 0, ErrSignCountNotGreater
+	}
+
+	return authData.signCount, nil
+}
+
+func (c Config) verifyClientData(encoded, expectedType, challenge string) ([]byte, error) {
+	raw, err := DecodeId(encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	var data clientData
+	err = json.Unmarshal(raw, &data)
+	if err != nil {
+		return nil, ErrMalformed
+	}
+
+	if data.Type != expectedType {
+		return nil, ErrInvalidType
+	}
+
+	if subtle.ConstantTimeCompare([]byte(strings.TrimRight(data.Challenge, "=")), []byte(challenge)) != 1 {
+		return nil, ErrChallengeMismatch
+	}
+
+	allowed := false
+	for _, origin := range c.Origins {
+		if data.Origin == origin {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return nil, ErrOriginMismatch
+	}
+
+	return raw, nil
+}
+
+func (c Config) verifyAuthenticatorData(raw []byte) (*authenticatorData, error) {
+	authData, err := parseAuthenticatorData(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	rpIdHash := sha256.Sum256([]byte(c.RpId))
+	if subtle.ConstantTimeCompare(authData.rpIdHash, rpIdHash[:]) != 1 {
+		return nil, ErrRpIdMismatch
+	}
+
+	if authData.flags&flagUserPresent == 0 {
+		return nil, ErrUserNotPresent
+	}
+
+	if c.UserVerification == UserVerificationRequired && authData.flags&flagUserVerified == 0 {
+		return nil, ErrUserNotVerified
+	}
+
+	return authData, nil
+}
+
+// parseAuthenticatorData splits authenticator data into fields. Extensions are ignored
+func parseAuthenticatorData(raw []byte) (*authenticatorData, error) {
+	if len(raw) < authDataMinLength {
+		return nil, ErrMalformed
+	}
+
+	authData := &authenticatorData{
+		rpIdHash:  raw[:rpIdHashLength],
+		flags:     raw[rpIdHashLength],
+		signCount: binary.BigEndian.Uint32(raw[signCountOffset:authDataMinLength]),
+	}
+
+	if authData.flags&flagAttested == 0 {
+		return authData, nil
+	}
+
+	if len(raw) < attestedDataOffset+attestedDataMinLength {
+		return nil, ErrMalformed
+	}
+
+	idLength := int(binary.BigEndian.Uint16(raw[credentialIdLenOffset:credentialIdDataOffset]))
+	if idLength == 0 || idLength > maxCredentialIdLength || len(raw) < credentialIdDataOffset+idLength {
+		return nil, ErrMalformed
+	}
+	authData.credentialId = append([]byte(nil), raw[credentialIdDataOffset:credentialIdDataOffset+idLength]...)
+
+	keyOffset := credentialIdDataOffset + idLength
+	_, n, err := decodeCbor(raw[keyOffset:])
+	if err != nil {
+		return nil, err
+	}
+	authData.publicKey = append([]byte(nil), raw[keyOffset:keyOffset+n]...)
+
+	return authData, nil
+}
@@ -0,0 +1,296 @@
+package webauthn
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+type (
+	// cborPair keeps order of map entries, so encoded test data is deterministic
+	cborPair struct {
+		key   interface{}
+		value interface{}
+	}
+
+	testAuthenticator struct {
+		credentialId []byte
+		cose         []byte
+		sign         func(data []byte) []byte
+		signCount    uint32
+	}
+)
+
+var (
+	testConfig = Config{
+		RpId:    "alsiberij.com",
+		RpName:  "Alsiberij",
+		Origins: []string{"https://alsiberij.com"},
+	}
+)
+
+func cborHead(major byte, arg uint64) []byte {
+	switch {
+	case arg < 24:
+		return []byte{major<<5 | byte(arg)}
+	case arg <= 0xff:
+		return []byte{major<<5 | 24, byte(arg)}
+	case arg <= 0xffff:
+		return []byte{major<<5 | 25, byte(arg >> 8), byte(arg)}
+	default:
+		head := []byte{major<<5 | 26, 0, 0, 0, 0}
+		binary.BigEndian.PutUint32(head[1:], uint32(arg))
+		return head
+	}
+}
+
+func encodeCbor(v interface{}) []byte {
+	switch value := v.(type) {
+	case int:
+		if value < 0 {
+			return cborHead(cborNegative, uint64(-1-value))
+		}
+		return cborHead(cborUnsigned, uint64(value))
+	case []byte:
+		return append(cborHead(cborBytes, uint64(len(value))), value...)
+	case string:
+		return append(cborHead(cborText, uint64(len(value))), value...)
+	case []cborPair:
+		encoded := cborHead(cborMap, uint64(len(value)))
+		for _, pair := range value {
+			encoded = append(encoded, encodeCbor(pair.key)...)
+			encoded = append(encoded, encodeCbor(pair.value)...)
+		}
+		return encoded
+	default:
+		panic("unsupported test value")
+	}
+}
+
+func newEs256Authenticator(t *testing.T) *testAuthenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("UNEXPECTED ERROR: %v", err)
+	}
+
+	x, y := make([]byte, 32), make([]byte, 32)
+	key.X.FillBytes(x)
+	key.Y.FillBytes(y)
+
+	return &testAuthenticator{
+		credentialId: []byte("es256-credential-id"),
+		cose: encodeCbor([]cborPair{
+			{coseKeyType, coseKtyEc2}, {coseKeyAlg, AlgES256}, {coseEc2Curve, coseCrvP256}, {coseEc2X, x}, {coseEc2Y, y},
+		}),
+		sign: func(data []byte) []byte {
+			digest := sha256.Sum256(data)
+			signature, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+			if err != nil {
+				t.Fatalf("UNEXPECTED ERROR: %v", err)
+			}
+			return signature
+		},
+	}
+}
+
+func newEd25519Authenticator(t *testing.T) *testAuthenticator {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("UNEXPECTED ERROR: %v", err)
+	}
+
+	return &testAuthenticator{
+		credentialId: []byte("ed25519-credential-id"),
+		cose: encodeCbor([]cborPair{
+			{coseKeyType, coseKtyOkp}, {coseKeyAlg, AlgEdDSA}, {coseOkpCurve, coseCrvEd25519}, {coseOkpX, []byte(public)},
+		}),
+		sign: func(data []byte) []byte {
+			return ed25519.Sign(private, data)
+		},
+	}
+}
+
+func (a *testAuthenticator) authData(rpId string, flags byte, attested bool) []byte {
+	rpIdHash := sha256.Sum256([]byte(rpId))
+
+	data := append([]byte(nil), rpIdHash[:]...)
+	data = append(data, flags)
+	data = append(data, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(data[len(data)-4:], a.signCount)
+
+	if attested {
+		data = append(data, make([]byte, 16)...)
+		data = append(data, byte(len(a.credentialId)>>8), byte(len(a.credentialId)))
+		data = append(data, a.credentialId...)
+		data = append(data, a.cose...)
+	}
+
+	return data
+}
+
+func clientDataJSON(t *testing.T, typ, challenge, origin string) []byte {
+	data, err := json.Marshal(clientData{Type: typ, Challenge: challenge, Origin: origin})
+	if err != nil {
+		t.Fatalf("UNEXPECTED ERROR: %v", err)
+	}
+	return data
+}
+
+func (a *testAuthenticator) create(t *testing.T, challenge, origin, rpId string) AttestationResponse {
+	var response AttestationResponse
+	response.Id = EncodeId(a.credentialId)
+	response.RawId = EncodeId(a.credentialId)
+	response.Type = TypePublicKey
+	response.Response.ClientDataJSON = EncodeId(clientDataJSON(t, clientDataTypeCreate, challenge, origin))
+	response.Response.AttestationObject = EncodeId(encodeCbor([]cborPair{
+		{"fmt", "none"},
+		{"attStmt", []cborPair{}},
+		{"authData", a.authData(rpId, flagUserPresent|flagUserVerified|flagAttested, true)},
+	}))
+	return response
+}
+
+func (a *testAuthenticator) get(t *testing.T, challenge, origin, rpId string) AssertionResponse {
+	a.signCount++
+
+	rawClientData := clientDataJSON(t, clientDataTypeGet, challenge, origin)
+	rawAuthData := a.authData(rpId, flagUserPresent, false)
+	clientDataHash := sha256.Sum256(rawClientData)
+
+	var response AssertionResponse
+	response.Id = EncodeId(a.credentialId)
+	response.RawId = EncodeId(a.credentialId)
+	response.Type = TypePublicKey
+	response.Response.ClientDataJSON = EncodeId(rawClientData)
+	response.Response.AuthenticatorData = EncodeId(rawAuthData)
+	response.Response.Signature = EncodeId(a.sign(append(append([]byte(nil), rawAuthData...), clientDataHash[:]...)))
+	return response
+}
+
+func TestCeremonies(t *testing.T) {
+	for _, authenticator := range []*testAuthenticator{newEs256Authenticator(t), newEd25519Authenticator(t)} {
+		challenge, err := NewChallenge()
+		if err != nil {
+			t.Fatalf("UNEXPECTED ERROR: %v", err)
+		}
+
+		credential, err := testConfig.VerifyRegistration(challenge, authenticator.create(t, challenge, "https://alsiberij.com", "alsiberij.com"))
+		if err != nil {
+			t.Fatalf("UNEXPECTED ERROR: %v", err)
+		}
+		if string(credential.Id) != string(authenticator.credentialId) || string(credential.PublicKey) != string(authenticator.cose) {
+			t.Fatalf("INVALID CREDENTIAL: %+v", credential)
+		}
+		if !credential.UserVerified {
+			t.Fatal("USER VERIFICATION FLAG LOST")
+		}
+
+		challenge, _ = NewChallenge()
+		signCount, err := testConfig.VerifyAssertion(challenge, authenticator.get(t, challenge, "https://alsiberij.com", "alsiberij.com"),
+			credential.PublicKey, credential.SignCount)
+		if err != nil {
+			t.Fatalf("UNEXPECTED ERROR: %v", err)
+		}
+		if signCount != 1 {
+			t.Fatalf("INVALID SIGN COUNT. EXPECTED 1 GOT %d", signCount)
+		}
+
+		response := authenticator.get(t, challenge, "https://alsiberij.com", "alsiberij.com")
+		response.Response.Signature = EncodeId(authenticator.sign([]byte("something else")))
+		_, err = testConfig.VerifyAssertion(challenge, response, credential.PublicKey, signCount)
+		if !errors.Is(err, ErrInvalidSignature) {
+			t.Fatalf("UNEXPECTED ERROR. EXPECTED %v GOT %v", ErrInvalidSignature, err)
+		}
+	}
+}
+
+func TestVerificationErrors(t *testing.T) {
+	authenticator := newEs256Authenticator(t)
+	challenge, _ := NewChallenge()
+	otherChallenge, _ := NewChallenge()
+
+	credential, err := testConfig.VerifyRegistration(challenge, authenticator.create(t, challenge, "https://alsiberij.com", "alsiberij.com"))
+	if err != nil {
+		t.Fatalf("UNEXPECTED ERROR: %v", err)
+	}
+
+	cases := []struct {
+		name     string
+		response AssertionResponse
+		count    uint32
+		err      error
+	}{
+		{"CHALLENGE", authenticator.get(t, otherChallenge, "https://alsiberij.com", "alsiberij.com"), 0, ErrChallengeMismatch},
+		{"ORIGIN", authenticator.get(t, challenge, "https://evil.com", "alsiberij.com"), 0, ErrOriginMismatch},
+		{"RP ID", authenticator.get(t, challenge, "https://alsiberij.com", "evil.com"), 0, ErrRpIdMismatch},
+		{"SIGN COUNT", authenticator.get(t, challenge, "https://alsiberij.com", "alsiberij.com"), 100, ErrSignCountNotGreater},
+	}
+
+	for _, c := range cases {
+		_, err = testConfig.VerifyAssertion(challenge, c.response, credential.PublicKey, c.count)
+		if !errors.Is(err, c.err) {
+			t.Fatalf("%s: UNEXPECTED ERROR. EXPECTED %v GOT %v", c.name, c.err, err)
+		}
+	}
+
+	_, err = testConfig.VerifyRegistration(challenge, authenticator.create(t, otherChallenge, "https://alsiberij.com", "alsiberij.com"))
+	if !errors.Is(err, ErrChallengeMismatch) {
+		t.Fatalf("UNEXPECTED ERROR. EXPECTED %v GOT %v", ErrChallengeMismatch, err)
+	}
+
+	response := authenticator.get(t, challenge, "https://alsiberij.com", "alsiberij.com")
+	_, err = testConfig.VerifyRegistration(challenge, AttestationResponse{Type: TypePublicKey, RawId: response.RawId,
+		Response: struct {
+			ClientDataJSON    string `json:"clientDataJSON"`
+			AttestationObject string `json:"attestationObject"`
+		}{ClientDataJSON: response.Response.ClientDataJSON}})
+	if !errors.Is(err, ErrInvalidType) {
+		t.Fatalf("UNEXPECTED ERROR. EXPECTED %v GOT %v", ErrInvalidType, err)
+	}
+
+	required := testConfig
+	required.UserVerification = UserVerificationRequired
+	_, err = required.VerifyAssertion(challenge, authenticator.get(t, challenge, "https://alsiberij.com", "alsiberij.com"),
+		credential.PublicKey, 0)
+	if !errors.Is(err, ErrUserNotVerified) {
+		t.Fatalf("UNEXPECTED ERROR. EXPECTED %v GOT %v", ErrUserNotVerified, err)
+	}
+}
+
+func TestDecodeCbor(t *testing.T) {
+	encoded := encodeCbor([]cborPair{{1, 2}, {-7, "text"}, {"bytes", []byte{1, 2, 3}}})
+
+	item, n, err := decodeCbor(append(encoded, 0xff))
+	if err != nil {
+		t.Fatalf("UNEXPECTED ERROR: %v", err)
+	}
+	if n != len(encoded) {
+		t.Fatalf("INVALID DECODED LENGTH. EXPECTED %d GOT %d", len(encoded), n)
+	}
+
+	m := item.(map[interface{}]interface{})
+	if m[int64(1)] != int64(2) || m[int64(-7)] != "text" || string(m["bytes"].([]byte)) != "\x01\x02\x03" {
+		t.Fatalf("INVALID DECODED VALUE: %v", m)
+	}
+
+	invalid := [][]byte{
+		{},
+		{0x5f},       // indefinite byte string
+		{0x44, 0x01}, // truncated byte string
+		{0x9b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, // huge array
+		{0xa2, 0x01, 0x01, 0x01, 0x02},                         // duplicate key
+		{0xc2, 0x40},                                           // tag
+	}
+	for _, data := range invalid {
+		_, _, err = decodeCbor(data)
+		if err == nil {
+			t.Fatalf("INVALID CBOR ACCEPTED: %x", data)
+		}
+	}
+}